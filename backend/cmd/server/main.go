@@ -2,16 +2,22 @@ package main
 
 import (
 	"context"
+	"finetune-studio/internal/backends"
 	"finetune-studio/internal/config"
 	"finetune-studio/internal/database"
 	"finetune-studio/internal/handlers"
 	"finetune-studio/internal/logger"
+	"finetune-studio/internal/logmetrics"
 	"finetune-studio/internal/metrics"
 	"finetune-studio/internal/middleware"
 	"finetune-studio/internal/models"
-	"finetune-studio/internal/services/kaggle"
+	"finetune-studio/internal/pipelines"
+	"finetune-studio/internal/queue"
+	"finetune-studio/internal/schedules"
+	"finetune-studio/internal/secrets"
 	"finetune-studio/internal/services/logs"
 	"finetune-studio/internal/storage"
+	"finetune-studio/internal/webhooks"
 	"finetune-studio/internal/worker"
 	"net/http"
 	"os"
@@ -155,9 +161,14 @@ func main() {
 
 		// Worker pool status
 		workerStatus := "up"
+		activeJobs := 0
 		if worker.Pool == nil {
 			workerStatus = "down"
+		} else {
+			activeJobs = worker.Pool.Active()
 		}
+		queuedJobs, _ := queue.Pending()
+		metrics.UpdateWorkerPoolMetrics(activeJobs, int(queuedJobs))
 
 		// Update DB metrics
 		if sqlDB != nil {
@@ -179,7 +190,9 @@ func main() {
 					"response_time": storageLatency.String(),
 				},
 				"workers": gin.H{
-					"status": workerStatus,
+					"status":      workerStatus,
+					"active_jobs": activeJobs,
+					"queued_jobs": queuedJobs,
 				},
 			},
 		})
@@ -191,22 +204,57 @@ func main() {
 	}
 
 	// 9. Initialize services
-	kaggleSvc := kaggle.NewService("/tmp/kaggle_workdir")
+	backends.Register(backends.NewSimulationBackend())
+	backends.Register(backends.NewLocalBackend(cfg.LocalTrainingCommand, cfg.LocalTrainingWorkDir))
 
+	if err := secrets.Init(cfg.SecretsEncryptionKey); err != nil {
+		logger.Fatal("Invalid secrets encryption key", zap.Error(err))
+	}
+	if err := logmetrics.Init(cfg.LogMetricsRulesPath); err != nil {
+		logger.Fatal("Invalid log metrics rules", zap.Error(err))
+	}
+
+	// Kaggle accounts come from the environment and, once a secrets key is
+	// set, from the database
+	defaultBackend := "simulation"
+	envKaggle := cfg.KaggleUsername != "" && cfg.KaggleKey != ""
+	if envKaggle || secrets.Enabled() {
+		username, key := cfg.KaggleUsername, cfg.KaggleKey
+		if !envKaggle {
+			username, key = "", ""
+		}
+		kaggleBackend := backends.NewKaggleBackend(cfg.KaggleAPIURL, username, key, cfg.NotebookTemplatePath)
+		kaggleBackend.Quota.WeeklyGPUHours = cfg.KaggleWeeklyGPUHours
+		kaggleBackend.Quota.MaxConcurrentKernels = cfg.KaggleMaxConcurrentKernels
+		backends.Register(kaggleBackend)
+
+		var storedAccounts int64
+		database.DB.Model(&models.KaggleAccount{}).Where("enabled = ?", true).Count(&storedAccounts)
+		if envKaggle || storedAccounts > 0 {
+			defaultBackend = "kaggle"
+		}
+	}
+	if cfg.DefaultTrainingBackend != "" {
+		defaultBackend = cfg.DefaultTrainingBackend
+	}
+	if err := backends.SetDefault(defaultBackend); err != nil {
+		logger.Fatal("Invalid default training backend", zap.Error(err))
+	}
+
+	// Incomplete jobs are resumed from the durable queue once their lease expires
 	workerPoolSize := getEnvInt("WORKER_POOL_SIZE", 5)
-	worker.Pool = worker.NewWorkerPool(workerPoolSize, kaggleSvc)
+	jobQueue := queue.New(queue.DefaultOwner(), cfg.QueueLeaseDuration)
+	worker.Pool = worker.NewWorkerPool(workerPoolSize, jobQueue, cfg.QueuePollInterval, cfg.WorkerTimeout)
 	worker.Pool.Start()
 
-	// Resume incomplete jobs
-	go func() {
-		var incompleteJobs []models.Job
-		if err := database.DB.Where("status IN ?", []string{"pending", "starting", "running"}).Find(&incompleteJobs).Error; err == nil {
-			for _, j := range incompleteJobs {
-				logger.Info("Resuming incomplete job", zap.Uint("job_id", j.ID), zap.String("status", j.Status))
-				worker.Pool.JobQueue <- j.ID
-			}
-		}
-	}()
+	scheduleRunner := schedules.NewRunner(schedules.DefaultInterval, worker.Pool.JobTimeout, worker.Pool.Notify)
+	scheduleRunner.Start()
+
+	pipelineRunner := pipelines.NewRunner(pipelines.DefaultInterval, worker.Pool.JobTimeout, worker.Pool.Notify)
+	pipelineRunner.Start()
+
+	webhookDispatcher := webhooks.NewDispatcher(webhooks.DefaultInterval)
+	webhookDispatcher.Start()
 
 	logService := logs.NewLogService(storage.Client)
 	logHandler := handlers.NewLogHandler(logService)
@@ -216,8 +264,12 @@ func main() {
 
 	evaluationHandler := handlers.NewEvaluationHandler()
 
+	streamHandler := handlers.NewStreamHandler(allowedOrigins)
+
 	logger.Info("Services initialized",
 		zap.Int("worker_pool_size", workerPoolSize),
+		zap.Strings("training_backends", backends.Names()),
+		zap.String("default_backend", backends.Default()),
 	)
 
 	// 10. Setup routes
@@ -238,9 +290,81 @@ func main() {
 	// Job Routes
 	{
 		v1.POST("/jobs", expensiveLimiter, handlers.CreateJob)
+		v1.POST("/jobs/:id/clone", expensiveLimiter, handlers.CloneJob)
 		v1.GET("/jobs", handlers.ListJobs)
+		v1.GET("/jobs/config-schema", handlers.GetConfigSchema)
 		v1.GET("/jobs/:id", handlers.GetJob)
 		v1.DELETE("/jobs/:id", handlers.CancelJob)
+		v1.GET("/jobs/:id/events", handlers.GetJobEvents)
+		v1.GET("/jobs/:id/events/stream", streamHandler.StreamJobEvents)
+		v1.POST("/jobs/:id/metrics", handlers.CreateJobMetrics)
+		v1.GET("/jobs/:id/metrics", handlers.GetJobMetrics)
+		v1.GET("/jobs/:id/notebook", handlers.GetJobNotebook)
+	}
+
+	// Preset Routes
+	{
+		v1.POST("/presets", handlers.CreatePreset)
+		v1.GET("/presets", handlers.ListPresets)
+		v1.GET("/presets/:id", handlers.GetPreset)
+		v1.GET("/presets/:id/versions", handlers.ListPresetVersions)
+		v1.PUT("/presets/:id", handlers.UpdatePreset)
+		v1.DELETE("/presets/:id", handlers.DeletePreset)
+	}
+
+	// Sweep Routes
+	{
+		v1.POST("/sweeps", expensiveLimiter, handlers.CreateSweep)
+		v1.GET("/sweeps", handlers.ListSweeps)
+		v1.GET("/sweeps/:id", handlers.GetSweep)
+		v1.GET("/sweeps/:id/summary", handlers.GetSweepSummary)
+		v1.DELETE("/sweeps/:id", handlers.CancelSweep)
+	}
+
+	// Schedule Routes
+	{
+		v1.POST("/schedules", handlers.CreateSchedule)
+		v1.GET("/schedules", handlers.ListSchedules)
+		v1.GET("/schedules/:id", handlers.GetSchedule)
+		v1.PUT("/schedules/:id", handlers.UpdateSchedule)
+		v1.DELETE("/schedules/:id", handlers.DeleteSchedule)
+		v1.POST("/schedules/:id/pause", handlers.PauseSchedule)
+		v1.POST("/schedules/:id/resume", handlers.ResumeSchedule)
+		v1.GET("/schedules/:id/runs", handlers.ListScheduleRuns)
+	}
+
+	// Pipeline Routes
+	{
+		v1.POST("/pipelines", handlers.CreatePipeline)
+		v1.GET("/pipelines", handlers.ListPipelines)
+		v1.GET("/pipelines/:id", handlers.GetPipeline)
+		v1.DELETE("/pipelines/:id", handlers.CancelPipeline)
+		v1.POST("/pipelines/:id/retry", handlers.RetryPipeline)
+	}
+
+	// Webhook Routes
+	{
+		v1.POST("/webhooks", handlers.CreateWebhook)
+		v1.GET("/webhooks", handlers.ListWebhooks)
+		v1.GET("/webhooks/:id", handlers.GetWebhook)
+		v1.PUT("/webhooks/:id", handlers.UpdateWebhook)
+		v1.DELETE("/webhooks/:id", handlers.DeleteWebhook)
+		v1.GET("/webhooks/:id/deliveries", handlers.ListWebhookDeliveries)
+		v1.POST("/webhooks/:id/deliveries/:delivery_id/redeliver", handlers.RedeliverWebhookDelivery)
+	}
+
+	// Queue Routes
+	{
+		v1.GET("/queue", handlers.GetQueue)
+	}
+
+	// Backend Routes
+	{
+		v1.GET("/backends/kaggle/quota", handlers.GetKaggleQuota)
+		v1.POST("/backends/kaggle/accounts", handlers.CreateKaggleAccount)
+		v1.GET("/backends/kaggle/accounts", handlers.ListKaggleAccounts)
+		v1.PUT("/backends/kaggle/accounts/:id", handlers.UpdateKaggleAccount)
+		v1.DELETE("/backends/kaggle/accounts/:id", handlers.DeleteKaggleAccount)
 	}
 
 	// Log Routes
@@ -249,6 +373,11 @@ func main() {
 		v1.POST("/jobs/:id/logs", logHandler.CreateLogEntry)
 	}
 
+	// Live job status and metrics (SSE and WebSocket)
+	{
+		v1.GET("/stream", streamHandler.Stream)
+	}
+
 	// Model Routes
 	{
 		v1.GET("/models", modelHandler.ListModels)
@@ -308,9 +437,13 @@ func main() {
 
 	logger.Info("Shutting down server...")
 
-	// Stop accepting new jobs
+	scheduleRunner.Stop()
+	pipelineRunner.Stop()
+	webhookDispatcher.Stop()
+
+	// Stop claiming new jobs and hand running ones back to the queue
 	if worker.Pool != nil {
-		close(worker.Pool.JobQueue)
+		worker.Pool.Stop(10 * time.Second)
 		logger.Info("Worker pool stopped")
 	}
 
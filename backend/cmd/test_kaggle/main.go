@@ -1,6 +1,7 @@
 package main
 
 import (
+	"context"
 	"finetune-studio/internal/config"
 	"finetune-studio/internal/database"
 	"finetune-studio/internal/services/kaggle"
@@ -12,7 +13,10 @@ import (
 )
 
 func main() {
-	cfg := config.LoadConfig()
+	cfg, err := config.LoadConfig()
+	if err != nil {
+		log.Fatalf("❌ Failed to load config: %v", err)
+	}
 
 	// Connect to DB
 	database.Connect(cfg.DatabaseURL)
@@ -25,7 +29,8 @@ func main() {
 		log.Fatal("❌ KAGGLE_USERNAME or KAGGLE_KEY not set. Check .env file.")
 	}
 
-	svc := kaggle.NewService("/tmp/kaggle_test")
+	ctx := context.Background()
+	svc := kaggle.NewService(kaggle.NewClient(cfg.KaggleAPIURL, cfg.KaggleUsername, cfg.KaggleKey))
 	log.Printf("✅ Kaggle Service initialized for user: %s", cfg.KaggleUsername)
 
 	// Test 1: Create a dummy dataset
@@ -34,12 +39,16 @@ func main() {
 	os.MkdirAll("/tmp/kaggle_test", 0755)
 	os.WriteFile(tmpFile, []byte(`[{"text":"hello world", "label":"positive"},{"text":"this is bad","label":"negative"}]`), 0644)
 
-	ref, err := svc.CreateDataset("test-finetune-dataset", tmpFile)
+	ref, err := svc.CreateDataset(ctx, "test-finetune-dataset", tmpFile)
 	if err != nil {
 		log.Fatalf("❌ CreateDataset failed: %v", err)
 	}
 	fmt.Printf("✅ Dataset created: %s\n", ref)
 
+	if err := svc.WaitForDataset(ctx, ref); err != nil {
+		log.Fatalf("❌ Dataset processing failed: %v", err)
+	}
+
 	// Test 2: Push a test kernel
 	log.Println("--- Test 2: Pushing test kernel to Kaggle ---")
 	notebookBytes, err := os.ReadFile("/app/templates/finetune-kernel.ipynb")
@@ -47,7 +56,7 @@ func main() {
 		log.Fatalf("❌ Failed to read notebook: %v", err)
 	}
 
-	kernelRef, err := svc.PushKernel("test-finetune-kernel", notebookBytes, []string{ref})
+	kernelRef, err := svc.PushKernel(ctx, "test-finetune-kernel", notebookBytes, []string{ref})
 	if err != nil {
 		log.Fatalf("❌ PushKernel failed: %v", err)
 	}
@@ -56,16 +65,16 @@ func main() {
 	// Test 3: Poll status
 	log.Println("--- Test 3: Polling kernel status ---")
 	for i := 0; i < 60; i++ { // Poll for up to 30 minutes
-		status, err := svc.GetKernelStatus(kernelRef)
+		status, err := svc.GetKernelStatus(ctx, kernelRef)
 		if err != nil {
 			log.Printf("⚠️  Status poll error: %v", err)
 		} else {
-			fmt.Printf("  [%s] Status: %s\n", time.Now().Format("15:04:05"), status)
-			if status == "completed" {
+			fmt.Printf("  [%s] Status: %s\n", time.Now().Format("15:04:05"), status.Status)
+			if status.Status == kaggle.KernelComplete {
 				fmt.Println("🎉 Kernel completed successfully!")
 				return
-			} else if status == "failed" {
-				fmt.Println("❌ Kernel failed!")
+			} else if status.Status == kaggle.KernelError {
+				fmt.Printf("❌ Kernel failed: %s\n", status.FailureMessage)
 				return
 			}
 		}
@@ -0,0 +1,55 @@
+package backends
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"finetune-studio/internal/database"
+	"finetune-studio/internal/models"
+	"finetune-studio/internal/storage"
+
+	"github.com/minio/minio-go/v7"
+)
+
+// parentAdapters downloads the LoRA adapters of the job's parent model into
+// dir and returns the local file paths, sorted. Jobs without a parent get nil.
+func parentAdapters(ctx context.Context, job *models.Job, dir string) ([]string, error) {
+	if job.ParentModelID == nil {
+		return nil, nil
+	}
+
+	var parent models.Model
+	if err := database.DB.Unscoped().First(&parent, *job.ParentModelID).Error; err != nil {
+		return nil, fmt.Errorf("parent model %d: %w", *job.ParentModelID, err)
+	}
+	prefix := strings.TrimSuffix(parent.LoRAAdaptersPath, "/") + "/"
+
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, err
+	}
+
+	var files []string
+	for object := range storage.Client.ListObjects(ctx, "models", minio.ListObjectsOptions{Prefix: prefix, Recursive: true}) {
+		if object.Err != nil {
+			return nil, fmt.Errorf("failed to list adapters of model %d: %w", parent.ID, object.Err)
+		}
+		// Adapter folders are flat; nested entries would collide once mounted
+		name := path.Base(object.Key)
+		local := filepath.Join(dir, name)
+		if err := storage.Client.FGetObject(ctx, "models", object.Key, local, minio.GetObjectOptions{}); err != nil {
+			return nil, fmt.Errorf("failed to download adapter file %s: %w", object.Key, err)
+		}
+		files = append(files, local)
+	}
+	if len(files) == 0 {
+		return nil, fmt.Errorf("model %d has no LoRA adapter files under %s", parent.ID, prefix)
+	}
+
+	sort.Strings(files)
+	return files, nil
+}
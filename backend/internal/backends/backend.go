@@ -0,0 +1,170 @@
+package backends
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+
+	"finetune-studio/internal/jobs/retry"
+	"finetune-studio/internal/models"
+)
+
+// RunState is the backend-neutral state of a submitted training run
+type RunState string
+
+const (
+	RunQueued    RunState = "queued"
+	RunRunning   RunState = "running"
+	RunCompleted RunState = "completed"
+	RunFailed    RunState = "failed"
+	RunCancelled RunState = "cancelled"
+	RunUnknown   RunState = "unknown"
+)
+
+// Terminal reports whether the run will not change state anymore
+func (s RunState) Terminal() bool {
+	return s == RunCompleted || s == RunFailed || s == RunCancelled
+}
+
+// RunStatus is the result of polling a backend for a run
+type RunStatus struct {
+	State   RunState
+	Message string                 // Failure message or other human readable detail
+	Metrics map[string]interface{} // Replaces the job metrics when non-nil
+}
+
+// Artifact describes a file produced by a run and stored in the models bucket
+type Artifact struct {
+	Name string `json:"name"`
+	Path string `json:"path"` // Object key in the models bucket
+	Size int64  `json:"size"`
+}
+
+// Backend runs training jobs on an execution environment (Kaggle, a local
+// process, a simulation...). The worker pool drives every backend through
+// the same submit → poll → fetch cycle.
+type Backend interface {
+	// Name is the identifier used in the job configuration ("backend" key)
+	Name() string
+	// Submit starts the run and returns a reference used by the other calls
+	Submit(ctx context.Context, job *models.Job) (string, error)
+	// Status polls the run identified by job.RunRef
+	Status(ctx context.Context, job *models.Job) (RunStatus, error)
+	// Cancel stops the run if it is still active
+	Cancel(ctx context.Context, job *models.Job) error
+	// FetchArtifacts makes the run outputs available under {jobID}/ in the models bucket
+	FetchArtifacts(ctx context.Context, job *models.Job) ([]Artifact, error)
+	// FetchLogs returns every log line produced by the run so far
+	FetchLogs(ctx context.Context, job *models.Job) ([]models.LogEntry, error)
+	// PollInterval is how long the worker waits between Status calls
+	PollInterval() time.Duration
+}
+
+// Admitter is implemented by backends with limited capacity. The worker asks
+// before submitting a new run; a refused job stays queued with the reason.
+type Admitter interface {
+	Admit(ctx context.Context, job *models.Job) (admitted bool, reason string, err error)
+}
+
+// Releaser is implemented by backends that hold capacity for a job across
+// its runs. The worker calls Release once the job reached a terminal state,
+// whichever way it got there.
+type Releaser interface {
+	Release(job *models.Job)
+}
+
+// HoldError is returned by Submit when the backend has no capacity for the
+// run right now. The job goes back to the queue instead of failing.
+type HoldError struct {
+	Reason     string
+	RetryAfter time.Duration
+}
+
+func (e *HoldError) Error() string { return e.Reason }
+
+// checkDatasetHash refuses to train on other content than the job is pinned to
+func checkDatasetHash(job *models.Job, hash string) error {
+	if job.DatasetHash == "" || job.DatasetHash == hash {
+		return nil
+	}
+	return retry.Wrap(retry.ClassPermanent, fmt.Errorf("dataset %d content changed since the job was created: sha256 %.12s, expected %.12s",
+		job.DatasetID, hash, job.DatasetHash))
+}
+
+var (
+	mu             sync.RWMutex
+	registry       = make(map[string]Backend)
+	defaultBackend string
+)
+
+// Register makes a backend selectable by name. Registering the same name
+// twice replaces the previous backend.
+func Register(b Backend) {
+	mu.Lock()
+	defer mu.Unlock()
+	registry[b.Name()] = b
+}
+
+// Get returns the backend registered under name
+func Get(name string) (Backend, error) {
+	mu.RLock()
+	defer mu.RUnlock()
+	b, ok := registry[name]
+	if !ok {
+		return nil, fmt.Errorf("unknown training backend %q (available: %v)", name, namesLocked())
+	}
+	return b, nil
+}
+
+// Names lists the registered backends in alphabetical order
+func Names() []string {
+	mu.RLock()
+	defer mu.RUnlock()
+	return namesLocked()
+}
+
+func namesLocked() []string {
+	names := make([]string, 0, len(registry))
+	for name := range registry {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// SetDefault sets the backend used by jobs that don't choose one
+func SetDefault(name string) error {
+	if _, err := Get(name); err != nil {
+		return err
+	}
+	mu.Lock()
+	defaultBackend = name
+	mu.Unlock()
+	return nil
+}
+
+// Default returns the name of the default backend
+func Default() string {
+	mu.RLock()
+	defer mu.RUnlock()
+	return defaultBackend
+}
+
+// Resolve returns the backend name requested by a job configuration
+// ("backend" key), falling back to the default backend.
+func Resolve(configuration []byte) (string, error) {
+	config := make(map[string]interface{})
+	_ = json.Unmarshal(configuration, &config)
+
+	name, _ := config["backend"].(string)
+	if name == "" {
+		name = Default()
+	}
+	if _, err := Get(name); err != nil {
+		return "", err
+	}
+	return name, nil
+}
@@ -0,0 +1,380 @@
+package backends
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"finetune-studio/internal/database"
+	"finetune-studio/internal/events"
+	"finetune-studio/internal/jobs/trainingconfig"
+	"finetune-studio/internal/models"
+	"finetune-studio/internal/notebook"
+	"finetune-studio/internal/services/kaggle"
+	"finetune-studio/internal/storage"
+
+	"github.com/minio/minio-go/v7"
+	"gorm.io/datatypes"
+)
+
+// KaggleBackend trains on Kaggle GPU kernels. Jobs are spread over the
+// accounts stored in the database and the account from the environment.
+type KaggleBackend struct {
+	APIURL       string // Empty uses the public Kaggle API
+	Username     string // Account from the environment, optional
+	Key          string
+	TemplatePath string
+	PollEvery    time.Duration
+	Quota        KaggleQuota // Quota of the environment account, default for stored accounts
+
+	// DatasetPollInterval overrides how often dataset processing is checked
+	DatasetPollInterval time.Duration
+
+	mu       sync.Mutex
+	services map[string]*kaggle.Service
+}
+
+func NewKaggleBackend(apiURL, username, key, templatePath string) *KaggleBackend {
+	return &KaggleBackend{
+		APIURL:       apiURL,
+		Username:     username,
+		Key:          key,
+		TemplatePath: templatePath,
+		PollEvery:    30 * time.Second,
+		Quota:        DefaultKaggleQuota(),
+		services:     make(map[string]*kaggle.Service),
+	}
+}
+
+func (b *KaggleBackend) Name() string { return "kaggle" }
+
+func (b *KaggleBackend) PollInterval() time.Duration { return b.PollEvery }
+
+// Submit uploads the job dataset to Kaggle and pushes the finetune kernel
+func (b *KaggleBackend) Submit(ctx context.Context, job *models.Job) (ref string, err error) {
+	// The GPU slot reserved by Admit is given back when nothing was pushed
+	defer func() {
+		if err != nil {
+			b.sessionFinished(job)
+		}
+	}()
+
+	svc, err := b.serviceFor(job)
+	if err != nil {
+		return "", err
+	}
+
+	// 1. Download dataset from MinIO to temp file
+	tmpDir := fmt.Sprintf("/tmp/job_%d", job.ID)
+	os.MkdirAll(tmpDir, 0755)
+	defer os.RemoveAll(tmpDir)
+
+	datasetFile := fmt.Sprintf("%s/dataset.json", tmpDir)
+	obj, err := storage.Client.GetObject(ctx, "datasets", job.Dataset.FilePath, minio.GetObjectOptions{})
+	if err != nil {
+		return "", fmt.Errorf("failed to download dataset from MinIO: %w", err)
+	}
+
+	buf := new(bytes.Buffer)
+	_, err = buf.ReadFrom(obj)
+	obj.Close()
+	if err != nil {
+		return "", fmt.Errorf("failed to download dataset from MinIO: %w", err)
+	}
+	if err := os.WriteFile(datasetFile, buf.Bytes(), 0644); err != nil {
+		return "", fmt.Errorf("failed to write dataset: %v", err)
+	}
+	log.Printf("[Job %d] Dataset downloaded to %s (%d bytes)", job.ID, datasetFile, buf.Len())
+
+	// 2. Upload dataset to Kaggle, unless its content is already there. The
+	// versions mounted by the kernel must not change until it is pushed.
+	updateStage(job, map[string]interface{}{"stage": "uploading_dataset"})
+	unlock, err := lockDatasets(ctx, svc.Client.Username)
+	if err != nil {
+		return "", fmt.Errorf("failed to lock Kaggle datasets: %w", err)
+	}
+	defer unlock()
+
+	dataset, reused, err := b.kaggleDataset(ctx, svc, job, datasetFile, buf.Bytes())
+	if err != nil {
+		return "", err
+	}
+
+	if err := svc.WaitForDataset(ctx, dataset.Ref); err != nil {
+		return "", fmt.Errorf("dataset %s not ready: %w", dataset.Ref, err)
+	}
+
+	stage := map[string]interface{}{
+		"stage":                  "pushing_kernel",
+		"kaggle_dataset":         dataset.Ref,
+		"kaggle_dataset_version": dataset.Version,
+		"kaggle_dataset_reused":  reused,
+	}
+	datasetRefs := []string{dataset.Ref}
+
+	// 3. Jobs continuing a model mount its adapters as a second dataset
+	adaptersPath := ""
+	adapterFiles, err := parentAdapters(ctx, job, filepath.Join(tmpDir, "adapters"))
+	if err != nil {
+		return "", err
+	}
+	if len(adapterFiles) > 0 {
+		updateStage(job, map[string]interface{}{"stage": "uploading_adapters"})
+		adapters, adaptersReused, err := b.adapterDataset(ctx, svc, job, adapterFiles)
+		if err != nil {
+			return "", err
+		}
+		if err := svc.WaitForDataset(ctx, adapters.Ref); err != nil {
+			return "", fmt.Errorf("dataset %s not ready: %w", adapters.Ref, err)
+		}
+		adaptersPath = strings.TrimSuffix(kaggle.DatasetMountPath(adapters.Ref, ""), "/")
+		datasetRefs = append(datasetRefs, adapters.Ref)
+		stage["kaggle_adapters"] = adapters.Ref
+		stage["kaggle_adapters_version"] = adapters.Version
+		stage["kaggle_adapters_reused"] = adaptersReused
+	}
+
+	// 4. Render the notebook from the job configuration and push the kernel
+	updateStage(job, stage)
+
+	notebookBytes, err := b.renderNotebook(ctx, job, kaggle.DatasetMountPath(dataset.Ref, filepath.Base(datasetFile)), adaptersPath)
+	if err != nil {
+		return "", err
+	}
+
+	kernelSlug := fmt.Sprintf("finetune-job-%d", job.ID)
+	kernelRef, err := svc.PushKernel(ctx, kernelSlug, notebookBytes, datasetRefs)
+	if err != nil {
+		if isQuotaError(err) {
+			return "", &HoldError{Reason: fmt.Sprintf("Kaggle refused the kernel: %v", err), RetryAfter: quotaHoldInterval}
+		}
+		return "", fmt.Errorf("failed to push kernel: %w", err)
+	}
+	b.sessionPushed(job, kernelRef)
+
+	// Kept for API clients that predate pluggable backends
+	job.KaggleKernelID = kernelRef
+	log.Printf("[Job %d] Kernel pushed: %s", job.ID, kernelRef)
+
+	return kernelRef, nil
+}
+
+// renderNotebook injects the job configuration into the notebook template and
+// keeps a copy of the result next to the job
+func (b *KaggleBackend) renderNotebook(ctx context.Context, job *models.Job, datasetPath, adaptersPath string) ([]byte, error) {
+	// Clones render the notebook of their source job to keep its template version
+	var template *notebook.Template
+	var err error
+	if job.TemplateNotebook != "" {
+		template, err = notebook.LoadStored(ctx, job.TemplateNotebook)
+	} else {
+		template, err = notebook.Load(b.TemplatePath)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	cfg, err := trainingconfig.Parse(job.Configuration)
+	if err != nil {
+		return nil, err
+	}
+
+	rendered, err := template.Render(cfg, datasetPath, adaptersPath)
+	if err != nil {
+		return nil, fmt.Errorf("failed to render notebook: %v", err)
+	}
+
+	notebookPath, err := notebook.Store(ctx, job.ID, rendered)
+	if err != nil {
+		return nil, err
+	}
+	job.NotebookPath = notebookPath
+	if job.TemplateNotebook == "" {
+		job.TemplateVersion = template.Version
+	}
+	log.Printf("[Job %d] Notebook rendered from template %s (%s)", job.ID, job.TemplateVersion, notebookPath)
+
+	return rendered, nil
+}
+
+func (b *KaggleBackend) Status(ctx context.Context, job *models.Job) (RunStatus, error) {
+	svc, err := b.serviceFor(job)
+	if err != nil {
+		return RunStatus{State: RunUnknown}, err
+	}
+	status, err := svc.GetKernelStatus(ctx, job.RunRef)
+	if err != nil {
+		return RunStatus{State: RunUnknown}, err
+	}
+
+	result := RunStatus{
+		Metrics: map[string]interface{}{
+			"stage":         "training",
+			"kernel_status": status.Status,
+			"kernel_ref":    job.RunRef,
+		},
+	}
+
+	switch status.Status {
+	case kaggle.KernelComplete:
+		result.State = RunCompleted
+	case kaggle.KernelQueued:
+		result.State = RunQueued
+	case kaggle.KernelRunning, kaggle.KernelCancelRequested:
+		result.State = RunRunning
+		b.sessionStarted(job)
+	case kaggle.KernelError:
+		result.State = RunFailed
+		result.Message = "Kaggle kernel execution failed"
+		if status.FailureMessage != "" {
+			result.Message = fmt.Sprintf("Kaggle kernel execution failed: %s", status.FailureMessage)
+		}
+	case kaggle.KernelCancelAcknowledged:
+		result.State = RunCancelled
+	default:
+		result.State = RunUnknown
+	}
+
+	if result.State.Terminal() {
+		b.sessionFinished(job)
+	}
+	return result, nil
+}
+
+// Cancel stops the kernel so it doesn't keep using GPU quota
+func (b *KaggleBackend) Cancel(ctx context.Context, job *models.Job) error {
+	svc, err := b.serviceFor(job)
+	if err != nil {
+		return err
+	}
+	if err := svc.CancelKernel(ctx, job.RunRef); err != nil {
+		return fmt.Errorf("failed to stop kernel %s: %w", job.RunRef, err)
+	}
+	b.sessionFinished(job)
+	log.Printf("[Job %d] Kaggle kernel %s stopped", job.ID, job.RunRef)
+	return nil
+}
+
+// FetchArtifacts streams the kernel output files into {jobID}/ in the models
+// bucket. Trainer checkpoints are left on Kaggle.
+func (b *KaggleBackend) FetchArtifacts(ctx context.Context, job *models.Job) ([]Artifact, error) {
+	svc, err := b.serviceFor(job)
+	if err != nil {
+		return nil, err
+	}
+	output, err := svc.ListKernelOutput(ctx, job.RunRef)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list kernel outputs: %w", err)
+	}
+
+	var artifacts []Artifact
+	for _, file := range output.Files {
+		name := strings.TrimPrefix(file.FileName, "/kaggle/working/")
+		if name == "" || strings.HasPrefix(name, "outputs/") {
+			continue
+		}
+
+		artifact, err := copyOutput(ctx, svc, job, name, file)
+		if err != nil {
+			return nil, fmt.Errorf("failed to copy kernel output %s: %w", name, err)
+		}
+		artifacts = append(artifacts, artifact)
+	}
+
+	log.Printf("[Job %d] Copied %d kernel outputs to models/%d/", job.ID, len(artifacts), job.ID)
+	return artifacts, nil
+}
+
+func copyOutput(ctx context.Context, svc *kaggle.Service, job *models.Job, name string, file kaggle.OutputFile) (Artifact, error) {
+	body, size, err := svc.OpenOutputFile(ctx, file)
+	if err != nil {
+		return Artifact{}, err
+	}
+	defer body.Close()
+
+	objectName := fmt.Sprintf("%d/%s", job.ID, name)
+	info, err := storage.Client.PutObject(ctx, "models", objectName, body, size, minio.PutObjectOptions{})
+	if err != nil {
+		return Artifact{}, err
+	}
+	return Artifact{Name: name, Path: objectName, Size: info.Size}, nil
+}
+
+// kernelLogLine is one entry of the log Kaggle records for a kernel run
+type kernelLogLine struct {
+	StreamName string  `json:"stream_name"`
+	Time       float64 `json:"time"`
+	Data       string  `json:"data"`
+}
+
+func (b *KaggleBackend) FetchLogs(ctx context.Context, job *models.Job) ([]models.LogEntry, error) {
+	svc, err := b.serviceFor(job)
+	if err != nil {
+		return nil, err
+	}
+	output, err := svc.ListKernelOutput(ctx, job.RunRef)
+	if err != nil {
+		return nil, err
+	}
+	if strings.TrimSpace(output.Log) == "" {
+		return nil, nil
+	}
+
+	var lines []kernelLogLine
+	if err := json.Unmarshal([]byte(output.Log), &lines); err != nil {
+		return nil, fmt.Errorf("failed to parse kernel log: %v", err)
+	}
+
+	start := job.UpdatedAt
+	if job.StartedAt != nil {
+		start = *job.StartedAt
+	}
+
+	var entries []models.LogEntry
+	for _, line := range lines {
+		message := strings.TrimRight(line.Data, "\n")
+		if message == "" {
+			continue
+		}
+		level := "info"
+		if line.StreamName == "stderr" {
+			level = "warning"
+		}
+		entries = append(entries, models.LogEntry{
+			JobID:     job.ID,
+			Level:     level,
+			Message:   message,
+			Source:    b.Name(),
+			Timestamp: start.Add(time.Duration(line.Time * float64(time.Second))),
+		})
+	}
+
+	return entries, nil
+}
+
+// updateStage merges progress metrics into the stored job metrics while a
+// backend is still submitting, keeping the progress read from the logs
+func updateStage(job *models.Job, metrics map[string]interface{}) {
+	merged := make(map[string]interface{})
+	var stored models.Job
+	if database.DB.Select("metrics").First(&stored, job.ID).Error == nil {
+		json.Unmarshal(stored.Metrics, &merged)
+	}
+	for key, value := range metrics {
+		merged[key] = value
+	}
+
+	metricsJSON, _ := json.Marshal(merged)
+	job.Metrics = datatypes.JSON(metricsJSON)
+	if err := database.DB.Save(job).Error; err != nil {
+		return
+	}
+	events.Default.Publish(events.Event{Type: events.TypeMetrics, JobID: job.ID, Metrics: metricsJSON})
+}
@@ -0,0 +1,117 @@
+package backends
+
+import (
+	"fmt"
+	"log"
+
+	"finetune-studio/internal/database"
+	"finetune-studio/internal/models"
+	"finetune-studio/internal/secrets"
+	"finetune-studio/internal/services/kaggle"
+)
+
+// kaggleAccount is an account the backend can run kernels on
+type kaggleAccount struct {
+	Username string
+	Key      string
+	Quota    KaggleQuota
+}
+
+// accounts lists the accounts new jobs may be scheduled on: the enabled
+// accounts stored in the database whose key can be decrypted and the account
+// from the environment
+func (b *KaggleBackend) accounts() ([]kaggleAccount, error) {
+	var stored []models.KaggleAccount
+	if err := database.DB.Where("enabled = ?", true).Order("id").Find(&stored).Error; err != nil {
+		return nil, err
+	}
+
+	accounts := make([]kaggleAccount, 0, len(stored)+1)
+	for _, row := range stored {
+		// One unreadable key must not take the whole pool down
+		account, err := b.storedAccount(row)
+		if err != nil {
+			log.Printf("[Kaggle] Skipping unusable %v", err)
+			continue
+		}
+		accounts = append(accounts, account)
+	}
+
+	if b.Username != "" && !containsAccount(accounts, b.Username) {
+		accounts = append(accounts, kaggleAccount{Username: b.Username, Key: b.Key, Quota: b.Quota})
+	}
+	return accounts, nil
+}
+
+// account returns an account by username, disabled or deleted ones included
+// so that jobs already running on them can finish
+func (b *KaggleBackend) account(username string) (kaggleAccount, error) {
+	var row models.KaggleAccount
+	err := database.DB.Unscoped().Where("username = ?", username).Order("deleted_at DESC NULLS FIRST, id DESC").First(&row).Error
+	if err == nil {
+		return b.storedAccount(row)
+	}
+	if username == b.Username {
+		return kaggleAccount{Username: b.Username, Key: b.Key, Quota: b.Quota}, nil
+	}
+	return kaggleAccount{}, fmt.Errorf("unknown Kaggle account %q", username)
+}
+
+func (b *KaggleBackend) storedAccount(row models.KaggleAccount) (kaggleAccount, error) {
+	key, err := secrets.Decrypt(row.EncryptedKey)
+	if err != nil {
+		return kaggleAccount{}, fmt.Errorf("kaggle account %s: %w", row.Username, err)
+	}
+
+	quota := b.Quota
+	if row.WeeklyGPUHours > 0 {
+		quota.WeeklyGPUHours = row.WeeklyGPUHours
+	}
+	if row.MaxConcurrentKernels > 0 {
+		quota.MaxConcurrentKernels = row.MaxConcurrentKernels
+	}
+	return kaggleAccount{Username: row.Username, Key: key, Quota: quota}, nil
+}
+
+// service returns the API client of an account
+func (b *KaggleBackend) service(account kaggleAccount) *kaggle.Service {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	cacheKey := account.Username + "\x00" + account.Key
+	if svc, ok := b.services[cacheKey]; ok {
+		return svc
+	}
+	svc := kaggle.NewService(kaggle.NewClient(b.APIURL, account.Username, account.Key))
+	if b.DatasetPollInterval > 0 {
+		svc.DatasetPollInterval = b.DatasetPollInterval
+	}
+	b.services[cacheKey] = svc
+	return svc
+}
+
+// serviceFor returns the client of the account the job was scheduled on.
+// Jobs from before the account pool run on the environment account.
+func (b *KaggleBackend) serviceFor(job *models.Job) (*kaggle.Service, error) {
+	username := job.KaggleAccount
+	if username == "" {
+		if b.Username == "" {
+			return nil, fmt.Errorf("job %d has no Kaggle account and KAGGLE_USERNAME is not set", job.ID)
+		}
+		username = b.Username
+	}
+	account, err := b.account(username)
+	if err != nil {
+		return nil, err
+	}
+	return b.service(account), nil
+}
+
+func containsAccount(accounts []kaggleAccount, username string) bool {
+	for _, account := range accounts {
+		if account.Username == username {
+			return true
+		}
+	}
+	return false
+}
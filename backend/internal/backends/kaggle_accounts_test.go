@@ -0,0 +1,33 @@
+package backends
+
+import (
+	"testing"
+
+	"finetune-studio/internal/database"
+	"finetune-studio/internal/database/databasetest"
+	"finetune-studio/internal/models"
+	"finetune-studio/internal/secrets"
+)
+
+func TestAccountsSkipUndecryptableKeys(t *testing.T) {
+	databasetest.Open(t)
+	if err := secrets.Init("000102030405060708090a0b0c0d0e0f101112131415161718191a1b1c1d1e1f"); err != nil {
+		t.Fatal(err)
+	}
+	defer secrets.Init("")
+
+	key, err := secrets.Encrypt("good-key")
+	if err != nil {
+		t.Fatal(err)
+	}
+	database.DB.Create(&models.KaggleAccount{Username: "broken", EncryptedKey: "not-a-ciphertext", Enabled: true})
+	database.DB.Create(&models.KaggleAccount{Username: "good", EncryptedKey: key, Enabled: true})
+
+	accounts, err := NewKaggleBackend("", "", "", "").accounts()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(accounts) != 1 || accounts[0].Username != "good" || accounts[0].Key != "good-key" {
+		t.Fatalf("got accounts %+v, want only good", accounts)
+	}
+}
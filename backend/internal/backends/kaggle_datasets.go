@@ -0,0 +1,184 @@
+package backends
+
+import (
+	"context"
+	"crypto/sha256"
+	"database/sql/driver"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"finetune-studio/internal/database"
+	"finetune-studio/internal/models"
+	"finetune-studio/internal/services/kaggle"
+
+	"gorm.io/gorm"
+)
+
+// datasetUpload is content kernels read from a Kaggle dataset
+type datasetUpload struct {
+	Lineage   string // Uploads of a lineage are versions of one Kaggle dataset
+	Hash      string // SHA-256 of the content
+	Files     []string
+	DatasetID uint // Dataset the content comes from, 0 for model adapters
+	Notes     string
+}
+
+// kaggleDataset returns the Kaggle dataset holding the content of the job
+// dataset. Datasets sharing a name form a lineage.
+func (b *KaggleBackend) kaggleDataset(ctx context.Context, svc *kaggle.Service, job *models.Job, filePath string, content []byte) (models.KaggleDataset, bool, error) {
+	hash := fmt.Sprintf("%x", sha256.Sum256(content))
+	if err := checkDatasetHash(job, hash); err != nil {
+		return models.KaggleDataset{}, false, err
+	}
+	if job.Dataset.ContentHash == "" {
+		// Datasets uploaded before content hashing
+		job.Dataset.ContentHash = hash
+		database.DB.Model(&job.Dataset).Update("content_hash", hash)
+	}
+
+	return b.uploadOnce(ctx, svc, job, datasetUpload{
+		Lineage:   job.Dataset.Name,
+		Hash:      hash,
+		Files:     []string{filePath},
+		DatasetID: job.Dataset.ID,
+		Notes:     fmt.Sprintf("Dataset %d, sha256 %s", job.Dataset.ID, hash[:12]),
+	})
+}
+
+// adapterDataset returns the Kaggle dataset holding the LoRA adapters of the
+// job's parent model
+func (b *KaggleBackend) adapterDataset(ctx context.Context, svc *kaggle.Service, job *models.Job, files []string) (models.KaggleDataset, bool, error) {
+	digest := sha256.New()
+	for _, file := range files {
+		data, err := os.ReadFile(file)
+		if err != nil {
+			return models.KaggleDataset{}, false, err
+		}
+		fmt.Fprintf(digest, "%s\x00%d\x00", filepath.Base(file), len(data))
+		digest.Write(data)
+	}
+	hash := fmt.Sprintf("%x", digest.Sum(nil))
+
+	return b.uploadOnce(ctx, svc, job, datasetUpload{
+		Lineage: fmt.Sprintf("model-%d-adapters", *job.ParentModelID),
+		Hash:    hash,
+		Files:   files,
+		Notes:   fmt.Sprintf("LoRA adapters of model %d, sha256 %s", *job.ParentModelID, hash[:12]),
+	})
+}
+
+// lockDatasets serializes the dataset uploads and kernel pushes of an
+// account, so that content reuse sees every upload and a kernel mounts the
+// dataset versions checked for it before another job versions them again.
+// The lock is held on its own connection: no transaction stays open during
+// the Kaggle calls.
+func lockDatasets(ctx context.Context, account string) (unlock func(), err error) {
+	sqlDB, err := database.DB.DB()
+	if err != nil {
+		return nil, err
+	}
+	conn, err := sqlDB.Conn(ctx)
+	if err != nil {
+		return nil, err
+	}
+	key := "kaggle-datasets:" + account
+	if _, err := conn.ExecContext(ctx, "SELECT pg_advisory_lock(hashtext($1))", key); err != nil {
+		conn.Close()
+		return nil, err
+	}
+
+	return func() {
+		if _, err := conn.ExecContext(context.Background(), "SELECT pg_advisory_unlock(hashtext($1))", key); err != nil {
+			// Drop the connection rather than return it to the pool locked
+			conn.Raw(func(interface{}) error { return driver.ErrBadConn })
+		}
+		conn.Close()
+	}, nil
+}
+
+// uploadOnce returns the Kaggle dataset version holding the content. Content
+// already on Kaggle is reused, new content of a known lineage becomes a new
+// version and anything else a new dataset. The caller holds lockDatasets.
+//
+// Kernels mount the latest version of a dataset, so content that was
+// superseded within its lineage is uploaded again as a new version.
+func (b *KaggleBackend) uploadOnce(ctx context.Context, svc *kaggle.Service, job *models.Job, upload datasetUpload) (models.KaggleDataset, bool, error) {
+	mapping, reused, err := b.upload(ctx, svc, upload)
+	if err != nil {
+		return models.KaggleDataset{}, false, err
+	}
+
+	if reused {
+		log.Printf("[Job %d] Reusing Kaggle dataset %s version %d", job.ID, mapping.Ref, mapping.Version)
+	} else {
+		log.Printf("[Job %d] Uploaded to Kaggle: %s version %d", job.ID, mapping.Ref, mapping.Version)
+	}
+	return mapping, reused, nil
+}
+
+// upload finds or creates the dataset version of the content
+func (b *KaggleBackend) upload(ctx context.Context, svc *kaggle.Service, upload datasetUpload) (models.KaggleDataset, bool, error) {
+	account := svc.Client.Username
+	hash := upload.Hash
+	var mapping models.KaggleDataset
+
+	err := database.DB.Where("account = ? AND content_hash = ?", account, hash).First(&mapping).Error
+	if err == nil {
+		var latest int
+		database.DB.Model(&models.KaggleDataset{}).Where("account = ? AND ref = ?", account, mapping.Ref).
+			Select("MAX(version)").Scan(&latest)
+		if mapping.Version >= latest {
+			return mapping, true, nil
+		}
+
+		// Newer content took over the dataset: upload this content again
+		// so it is what the kernel mounts
+		if _, err := svc.CreateDatasetVersion(ctx, mapping.Ref, upload.Notes, upload.Files...); err != nil {
+			return mapping, false, fmt.Errorf("failed to version dataset %s: %w", mapping.Ref, err)
+		}
+		mapping.Version = latest + 1
+		mapping.DatasetID = upload.DatasetID
+		return mapping, false, database.DB.Save(&mapping).Error
+	}
+	if err != gorm.ErrRecordNotFound {
+		return mapping, false, err
+	}
+
+	var latest models.KaggleDataset
+	err = database.DB.Where("account = ? AND lineage = ?", account, upload.Lineage).Order("version DESC").First(&latest).Error
+	switch {
+	case err == nil:
+		if _, err := svc.CreateDatasetVersion(ctx, latest.Ref, upload.Notes, upload.Files...); err != nil {
+			return mapping, false, fmt.Errorf("failed to version dataset %s: %w", latest.Ref, err)
+		}
+		mapping = models.KaggleDataset{Ref: latest.Ref, Version: latest.Version + 1}
+	case err == gorm.ErrRecordNotFound:
+		ref, err := svc.CreateDataset(ctx, datasetTitle(upload.Lineage, hash), upload.Files...)
+		if err != nil {
+			return mapping, false, fmt.Errorf("failed to upload dataset to Kaggle: %w", err)
+		}
+		mapping = models.KaggleDataset{Ref: ref, Version: 1}
+	default:
+		return mapping, false, err
+	}
+
+	mapping.Account = account
+	mapping.ContentHash = hash
+	mapping.Lineage = upload.Lineage
+	mapping.DatasetID = upload.DatasetID
+	return mapping, false, database.DB.Create(&mapping).Error
+}
+
+// datasetTitle names the Kaggle dataset of a lineage. The hash suffix keeps
+// the slug unique when a name is reused after its mapping was lost.
+func datasetTitle(name, hash string) string {
+	runes := []rune(strings.TrimSpace(name))
+	if len(runes) > 30 {
+		runes = runes[:30]
+	}
+	name = string(runes)
+	return fmt.Sprintf("finetune %s %s", name, hash[:8])
+}
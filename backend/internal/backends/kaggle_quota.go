@@ -0,0 +1,278 @@
+package backends
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"sort"
+	"strings"
+	"time"
+
+	"finetune-studio/internal/database"
+	"finetune-studio/internal/models"
+	"finetune-studio/internal/services/kaggle"
+
+	"gorm.io/gorm"
+)
+
+// KaggleQuota is the GPU budget of a Kaggle account
+type KaggleQuota struct {
+	WeeklyGPUHours       float64
+	MaxConcurrentKernels int
+	ResetWeekday         time.Weekday // The weekly budget resets at 00:00 UTC on this day
+}
+
+// DefaultKaggleQuota matches the free Kaggle GPU tier
+func DefaultKaggleQuota() KaggleQuota {
+	return KaggleQuota{
+		WeeklyGPUHours:       30,
+		MaxConcurrentKernels: 2,
+		ResetWeekday:         time.Saturday,
+	}
+}
+
+const (
+	// staleReservation is how long an admitted job may take to push its
+	// kernel before its reservation stops counting
+	staleReservation = time.Hour
+
+	// defaultJobGPUHours is the estimate used before any run finished
+	defaultJobGPUHours = 1.0
+
+	// quotaHoldInterval is how long a job waits after Kaggle refused a push
+	quotaHoldInterval = 15 * time.Minute
+)
+
+// QuotaReport is the GPU usage of a Kaggle account in the current week
+type QuotaReport struct {
+	Account              string    `json:"account"`
+	WeeklyGPUHours       float64   `json:"weekly_gpu_hours"`
+	UsedGPUHours         float64   `json:"used_gpu_hours"`
+	RemainingGPUHours    float64   `json:"remaining_gpu_hours"`
+	EstimatedJobGPUHours float64   `json:"estimated_job_gpu_hours"` // Average of recent runs
+	ActiveKernels        int       `json:"active_kernels"`
+	MaxConcurrentKernels int       `json:"max_concurrent_kernels"`
+	WeekStartedAt        time.Time `json:"week_started_at"`
+	ResetsAt             time.Time `json:"resets_at"`
+}
+
+// weekStart returns the last reset before now
+func (q KaggleQuota) weekStart(now time.Time) time.Time {
+	now = now.UTC()
+	day := time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, time.UTC)
+	offset := (int(day.Weekday()) - int(q.ResetWeekday) + 7) % 7
+	return day.AddDate(0, 0, -offset)
+}
+
+// QuotaReport computes the GPU usage of every account jobs can run on
+func (b *KaggleBackend) QuotaReport() ([]QuotaReport, error) {
+	accounts, err := b.accounts()
+	if err != nil {
+		return nil, err
+	}
+	now := time.Now()
+	reports := make([]QuotaReport, 0, len(accounts))
+	for _, account := range accounts {
+		report, err := quotaReport(database.DB, account, now)
+		if err != nil {
+			return nil, err
+		}
+		reports = append(reports, report)
+	}
+	return reports, nil
+}
+
+func quotaReport(tx *gorm.DB, account kaggleAccount, now time.Time) (QuotaReport, error) {
+	quota := account.Quota
+	weekStart := quota.weekStart(now)
+	report := QuotaReport{
+		Account:              account.Username,
+		WeeklyGPUHours:       quota.WeeklyGPUHours,
+		MaxConcurrentKernels: quota.MaxConcurrentKernels,
+		WeekStartedAt:        weekStart,
+		ResetsAt:             weekStart.AddDate(0, 0, 7),
+		EstimatedJobGPUHours: defaultJobGPUHours,
+	}
+
+	var sessions []models.KaggleSession
+	err := tx.Where("account = ? AND (finished_at IS NULL OR finished_at > ?)", account.Username, weekStart).Find(&sessions).Error
+	if err != nil {
+		return report, err
+	}
+
+	for _, session := range sessions {
+		if session.FinishedAt == nil && (session.KernelRef != "" || now.Sub(session.ReservedAt) < staleReservation) {
+			report.ActiveKernels++
+		}
+		if session.StartedAt == nil {
+			continue
+		}
+		start, end := *session.StartedAt, now
+		if session.FinishedAt != nil {
+			end = *session.FinishedAt
+		}
+		if start.Before(weekStart) {
+			start = weekStart
+		}
+		if end.After(start) {
+			report.UsedGPUHours += end.Sub(start).Hours()
+		}
+	}
+
+	var recent []models.KaggleSession
+	tx.Where("account = ? AND started_at IS NOT NULL AND finished_at IS NOT NULL", account.Username).
+		Order("finished_at DESC").Limit(10).Find(&recent)
+	if len(recent) > 0 {
+		total := 0.0
+		for _, session := range recent {
+			total += session.FinishedAt.Sub(*session.StartedAt).Hours()
+		}
+		report.EstimatedJobGPUHours = total / float64(len(recent))
+	}
+
+	report.RemainingGPUHours = report.WeeklyGPUHours - report.UsedGPUHours
+	if report.RemainingGPUHours < 0 {
+		report.RemainingGPUHours = 0
+	}
+	return report, nil
+}
+
+// holdReason explains why an account can't take another run, or returns ""
+func (r QuotaReport) holdReason() string {
+	switch {
+	case r.ActiveKernels >= r.MaxConcurrentKernels:
+		return fmt.Sprintf("waiting for a Kaggle kernel slot: %d/%d kernels running on %s",
+			r.ActiveKernels, r.MaxConcurrentKernels, r.Account)
+	case r.UsedGPUHours+r.EstimatedJobGPUHours > r.WeeklyGPUHours:
+		return fmt.Sprintf("waiting for Kaggle GPU quota: %.1fh of %.0fh used on %s, a run needs about %.1fh; quota resets %s",
+			r.UsedGPUHours, r.WeeklyGPUHours, r.Account, r.EstimatedJobGPUHours, r.ResetsAt.Format(time.RFC3339))
+	}
+	return ""
+}
+
+// Admit schedules the job on the account with the most GPU time left that
+// has a free concurrent kernel and enough time for a typical run. The
+// account is recorded on the job so later polls use the same credentials.
+func (b *KaggleBackend) Admit(ctx context.Context, job *models.Job) (bool, string, error) {
+	// A reservation left by a failed attempt is still valid
+	var existing models.KaggleSession
+	err := database.DB.Where("job_id = ? AND finished_at IS NULL", job.ID).First(&existing).Error
+	if err == nil {
+		return true, "", b.assignAccount(job, existing.Account)
+	}
+	if err != gorm.ErrRecordNotFound {
+		return false, "", err
+	}
+
+	accounts, err := b.accounts()
+	if err != nil {
+		return false, "", err
+	}
+	if len(accounts) == 0 {
+		return false, "", fmt.Errorf("no Kaggle account is configured")
+	}
+
+	// Try the accounts with the most GPU time left first
+	now := time.Now()
+	reports := make(map[string]QuotaReport, len(accounts))
+	for _, account := range accounts {
+		report, err := quotaReport(database.DB, account, now)
+		if err != nil {
+			return false, "", err
+		}
+		reports[account.Username] = report
+	}
+	sort.SliceStable(accounts, func(i, j int) bool {
+		return reports[accounts[i].Username].RemainingGPUHours > reports[accounts[j].Username].RemainingGPUHours
+	})
+
+	var reasons []string
+	for _, account := range accounts {
+		admitted, reason, err := b.reserve(job, account)
+		if err != nil {
+			return false, "", err
+		}
+		if admitted {
+			return true, "", b.assignAccount(job, account.Username)
+		}
+		reasons = append(reasons, reason)
+	}
+	return false, strings.Join(reasons, "; "), nil
+}
+
+// reserve creates a session for the job on the account if its quota allows
+// it. Admissions on an account are serialized so the checks see every
+// reservation.
+func (b *KaggleBackend) reserve(job *models.Job, account kaggleAccount) (bool, string, error) {
+	admitted := false
+	reason := ""
+
+	err := database.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Exec("SELECT pg_advisory_xact_lock(hashtext(?))", "kaggle-quota:"+account.Username).Error; err != nil {
+			return err
+		}
+
+		now := time.Now()
+		report, err := quotaReport(tx, account, now)
+		if err != nil {
+			return err
+		}
+		if reason = report.holdReason(); reason != "" {
+			return nil
+		}
+
+		admitted = true
+		return tx.Create(&models.KaggleSession{Account: account.Username, JobID: job.ID, ReservedAt: now}).Error
+	})
+	return admitted, reason, err
+}
+
+// assignAccount records the account the job runs on
+func (b *KaggleBackend) assignAccount(job *models.Job, username string) error {
+	if job.KaggleAccount == username {
+		return nil
+	}
+	job.KaggleAccount = username
+	return database.DB.Model(job).Update("kaggle_account", username).Error
+}
+
+// sessionPushed attaches the pushed kernel to the job reservation
+func (b *KaggleBackend) sessionPushed(job *models.Job, kernelRef string) {
+	database.DB.Model(&models.KaggleSession{}).
+		Where("job_id = ? AND finished_at IS NULL", job.ID).
+		Update("kernel_ref", kernelRef)
+}
+
+// sessionStarted records when the kernel was first seen running
+func (b *KaggleBackend) sessionStarted(job *models.Job) {
+	database.DB.Model(&models.KaggleSession{}).
+		Where("job_id = ? AND finished_at IS NULL AND started_at IS NULL", job.ID).
+		Update("started_at", time.Now())
+}
+
+// sessionFinished closes the job session. Kernels that finished between two
+// polls without being seen running are counted from their reservation.
+func (b *KaggleBackend) sessionFinished(job *models.Job) {
+	now := time.Now()
+	err := database.DB.Model(&models.KaggleSession{}).
+		Where("job_id = ? AND finished_at IS NULL", job.ID).
+		Updates(map[string]interface{}{
+			"started_at":  gorm.Expr("COALESCE(started_at, CASE WHEN kernel_ref <> '' THEN reserved_at END)"),
+			"finished_at": now,
+		}).Error
+	if err != nil {
+		log.Printf("[Job %d] Failed to close Kaggle session: %v", job.ID, err)
+	}
+}
+
+// Release closes the job session so it stops counting as an active kernel
+func (b *KaggleBackend) Release(job *models.Job) {
+	b.sessionFinished(job)
+}
+
+// isQuotaError reports whether Kaggle refused a push for lack of GPU quota
+func isQuotaError(err error) bool {
+	var apiErr *kaggle.APIError
+	return errors.As(err, &apiErr) && apiErr.QuotaExceeded()
+}
@@ -0,0 +1,64 @@
+package backends
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"testing"
+	"time"
+
+	"finetune-studio/internal/database"
+	"finetune-studio/internal/database/databasetest"
+	"finetune-studio/internal/jobs/retry"
+	"finetune-studio/internal/models"
+	"finetune-studio/internal/services/kaggle"
+	"finetune-studio/internal/services/kaggle/kaggletest"
+)
+
+func TestReleaseFreesKernelSlot(t *testing.T) {
+	databasetest.Open(t)
+	b := NewKaggleBackend("", "tester", "secret", "")
+	account := kaggleAccount{Username: "tester", Quota: DefaultKaggleQuota()}
+
+	started := time.Now().Add(-time.Hour)
+	database.DB.Create(&models.KaggleSession{Account: "tester", JobID: 7, KernelRef: "tester/job-7", ReservedAt: started, StartedAt: &started})
+
+	report, err := quotaReport(database.DB, account, time.Now())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if report.ActiveKernels != 1 {
+		t.Fatalf("got %d active kernels before release, want 1", report.ActiveKernels)
+	}
+
+	job := models.Job{}
+	job.ID = 7
+	b.Release(&job)
+
+	later := time.Now().Add(time.Hour)
+	after, err := quotaReport(database.DB, account, later)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if after.ActiveKernels != 0 {
+		t.Fatalf("got %d active kernels after release, want 0", after.ActiveKernels)
+	}
+	if after.UsedGPUHours > report.UsedGPUHours+0.01 {
+		t.Fatalf("released session still accrues GPU time: %.2fh then %.2fh", report.UsedGPUHours, after.UsedGPUHours)
+	}
+}
+
+func TestIsQuotaError(t *testing.T) {
+	refused := retry.Wrap(retry.ClassPermanent, &kaggle.APIError{StatusCode: http.StatusOK, Body: kaggletest.QuotaMessage})
+	if !isQuotaError(fmt.Errorf("failed to push kernel: %w", refused)) {
+		t.Fatal("quota refusal not recognised")
+	}
+	for _, err := range []error{
+		errors.New("failed to create dataset quota-reports: already exists"),
+		&kaggle.APIError{StatusCode: http.StatusBadRequest, Body: "invalid kernel slug finetune-quota"},
+	} {
+		if isQuotaError(err) {
+			t.Errorf("%v taken for a quota refusal", err)
+		}
+	}
+}
@@ -0,0 +1,31 @@
+package backends
+
+import (
+	"encoding/json"
+	"testing"
+
+	"finetune-studio/internal/database"
+	"finetune-studio/internal/database/databasetest"
+	"finetune-studio/internal/models"
+
+	"gorm.io/datatypes"
+)
+
+func TestUpdateStageKeepsProgress(t *testing.T) {
+	databasetest.Open(t)
+	job := models.Job{Status: "starting", Metrics: datatypes.JSON(`{"stage": "queued"}`)}
+	database.DB.Create(&job)
+	// Written by the log processing behind the worker's back
+	database.DB.Model(&models.Job{}).Where("id = ?", job.ID).Update("metrics", datatypes.JSON(`{"stage": "queued", "progress": {"loss": 1.5}}`))
+
+	updateStage(&job, map[string]interface{}{"stage": "uploading_dataset"})
+
+	var stored models.Job
+	database.DB.First(&stored, job.ID)
+	var metrics map[string]interface{}
+	json.Unmarshal(stored.Metrics, &metrics)
+	progress, _ := metrics["progress"].(map[string]interface{})
+	if metrics["stage"] != "uploading_dataset" || progress["loss"] != 1.5 {
+		t.Fatalf("unexpected metrics %s", stored.Metrics)
+	}
+}
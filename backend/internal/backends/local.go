@@ -0,0 +1,311 @@
+package backends
+
+import (
+	"bufio"
+	"context"
+	"crypto/sha256"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+
+	"finetune-studio/internal/models"
+	"finetune-studio/internal/storage"
+
+	"github.com/minio/minio-go/v7"
+)
+
+// LocalBackend trains by running a command on the API host. The command
+// receives the job through environment variables:
+//
+//	JOB_ID       job identifier
+//	DATASET_PATH local copy of the dataset file
+//	CONFIG_PATH  job configuration as JSON
+//	OUTPUT_DIR   directory whose content is uploaded to {jobID}/ in the models bucket
+//	PARENT_ADAPTERS_DIR LoRA adapters to continue training from, empty for fresh adapters
+type LocalBackend struct {
+	Command string
+	WorkDir string
+
+	mu   sync.Mutex
+	runs map[string]context.CancelFunc // Keyed by run directory
+}
+
+func NewLocalBackend(command, workDir string) *LocalBackend {
+	return &LocalBackend{
+		Command: command,
+		WorkDir: workDir,
+		runs:    make(map[string]context.CancelFunc),
+	}
+}
+
+func (b *LocalBackend) Name() string { return "local" }
+
+func (b *LocalBackend) PollInterval() time.Duration { return 5 * time.Second }
+
+func (b *LocalBackend) Submit(ctx context.Context, job *models.Job) (string, error) {
+	if b.Command == "" {
+		return "", fmt.Errorf("LOCAL_TRAINING_COMMAND is not set")
+	}
+
+	// Each attempt runs in its own directory so a retry never sees the exit
+	// code, logs or outputs of the previous one
+	runDir := filepath.Join(b.WorkDir, fmt.Sprintf("job_%d", job.ID), fmt.Sprintf("attempt_%d", job.Attempts))
+	outputDir := filepath.Join(runDir, "outputs")
+	if err := os.MkdirAll(outputDir, 0755); err != nil {
+		return "", err
+	}
+	// Left over when the attempt is submitted again after a restart
+	if err := os.Remove(filepath.Join(runDir, "exit_code")); err != nil && !os.IsNotExist(err) {
+		return "", err
+	}
+
+	datasetFile := filepath.Join(runDir, "dataset"+filepath.Ext(job.Dataset.FilePath))
+	if err := storage.Client.FGetObject(ctx, "datasets", job.Dataset.FilePath, datasetFile, minio.GetObjectOptions{}); err != nil {
+		return "", fmt.Errorf("failed to download dataset from MinIO: %w", err)
+	}
+	hash, err := fileHash(datasetFile)
+	if err != nil {
+		return "", err
+	}
+	if err := checkDatasetHash(job, hash); err != nil {
+		return "", err
+	}
+
+	adapterFiles, err := parentAdapters(ctx, job, filepath.Join(runDir, "parent_adapters"))
+	if err != nil {
+		return "", err
+	}
+	adaptersDir := ""
+	if len(adapterFiles) > 0 {
+		adaptersDir = filepath.Dir(adapterFiles[0])
+	}
+
+	configFile := filepath.Join(runDir, "config.json")
+	if err := os.WriteFile(configFile, job.Configuration, 0644); err != nil {
+		return "", fmt.Errorf("failed to write configuration: %v", err)
+	}
+
+	logFile, err := os.Create(filepath.Join(runDir, "train.log"))
+	if err != nil {
+		return "", err
+	}
+
+	// The process outlives the Submit call, so it is bound to its own context
+	// that only Cancel ends. The command runs in its own process group so the
+	// signals reach the training processes it started, not only the shell.
+	// SIGTERM first gives them a chance to clean up.
+	runCtx, stop := context.WithCancel(context.Background())
+	cmd := exec.CommandContext(runCtx, "sh", "-c", b.Command)
+	cmd.SysProcAttr = &syscall.SysProcAttr{Setpgid: true}
+	cmd.Cancel = func() error {
+		pgid := cmd.Process.Pid
+		time.AfterFunc(cmd.WaitDelay, func() { syscall.Kill(-pgid, syscall.SIGKILL) })
+		err := syscall.Kill(-pgid, syscall.SIGTERM)
+		if err == syscall.ESRCH {
+			return os.ErrProcessDone
+		}
+		return err
+	}
+	cmd.WaitDelay = 10 * time.Second
+	cmd.Dir = runDir
+	cmd.Stdout = logFile
+	cmd.Stderr = logFile
+	cmd.Env = append(os.Environ(),
+		fmt.Sprintf("JOB_ID=%d", job.ID),
+		"DATASET_PATH="+datasetFile,
+		"CONFIG_PATH="+configFile,
+		"OUTPUT_DIR="+outputDir,
+		"PARENT_ADAPTERS_DIR="+adaptersDir,
+	)
+
+	if err := cmd.Start(); err != nil {
+		stop()
+		logFile.Close()
+		return "", fmt.Errorf("failed to start training command: %v", err)
+	}
+
+	b.mu.Lock()
+	b.runs[runDir] = stop
+	b.mu.Unlock()
+
+	go func() {
+		exitCode := 0
+		if err := cmd.Wait(); err != nil {
+			exitCode = -1
+			if exitErr, ok := err.(*exec.ExitError); ok {
+				exitCode = exitErr.ExitCode()
+			}
+		}
+		stop()
+		logFile.Close()
+		if err := writeExitCode(runDir, exitCode); err != nil {
+			log.Printf("[Job %d] Failed to record exit code %d: %v", job.ID, exitCode, err)
+		}
+
+		b.mu.Lock()
+		delete(b.runs, runDir)
+		b.mu.Unlock()
+	}()
+
+	log.Printf("[Job %d] Local training started (pid %d) in %s", job.ID, cmd.Process.Pid, runDir)
+	return runDir, nil
+}
+
+func (b *LocalBackend) Status(ctx context.Context, job *models.Job) (RunStatus, error) {
+	// The run is forgotten only after its exit code was written, so the exit
+	// code is read after looking the run up
+	b.mu.Lock()
+	_, running := b.runs[job.RunRef]
+	b.mu.Unlock()
+
+	exitCode, exited, err := readExitCode(job.RunRef)
+	if err != nil {
+		return RunStatus{}, err
+	}
+	if exited {
+		if exitCode == 0 {
+			return RunStatus{State: RunCompleted}, nil
+		}
+		return RunStatus{
+			State:   RunFailed,
+			Message: fmt.Sprintf("Training command exited with code %d", exitCode),
+		}, nil
+	}
+
+	if running {
+		return RunStatus{
+			State:   RunRunning,
+			Metrics: map[string]interface{}{"stage": "training", "mode": "local"},
+		}, nil
+	}
+
+	// No exit code and no process: the server restarted while it was running
+	return RunStatus{State: RunFailed, Message: "Local training process was lost (server restarted?)"}, nil
+}
+
+// writeExitCode records how a run ended. The file is renamed into place so
+// Status never reads it half written.
+func writeExitCode(runDir string, exitCode int) error {
+	tmp := filepath.Join(runDir, "exit_code.tmp")
+	if err := os.WriteFile(tmp, []byte(strconv.Itoa(exitCode)), 0644); err != nil {
+		return err
+	}
+	return os.Rename(tmp, filepath.Join(runDir, "exit_code"))
+}
+
+// readExitCode returns the exit code of a run, if it ended
+func readExitCode(runDir string) (int, bool, error) {
+	data, err := os.ReadFile(filepath.Join(runDir, "exit_code"))
+	if os.IsNotExist(err) {
+		return 0, false, nil
+	}
+	if err != nil {
+		return 0, false, err
+	}
+	exitCode, err := strconv.Atoi(strings.TrimSpace(string(data)))
+	if err != nil {
+		return 0, false, fmt.Errorf("invalid exit code in %s: %q", runDir, data)
+	}
+	return exitCode, true, nil
+}
+
+func (b *LocalBackend) Cancel(ctx context.Context, job *models.Job) error {
+	b.mu.Lock()
+	stop, ok := b.runs[job.RunRef]
+	b.mu.Unlock()
+
+	if ok {
+		stop()
+	}
+	return nil
+}
+
+// fileHash returns the SHA-256 of a file
+func fileHash(path string) (string, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return "", err
+	}
+	defer file.Close()
+
+	digest := sha256.New()
+	if _, err := io.Copy(digest, file); err != nil {
+		return "", err
+	}
+	return fmt.Sprintf("%x", digest.Sum(nil)), nil
+}
+
+// FetchArtifacts uploads OUTPUT_DIR to {jobID}/ in the models bucket
+func (b *LocalBackend) FetchArtifacts(ctx context.Context, job *models.Job) ([]Artifact, error) {
+	outputDir := filepath.Join(job.RunRef, "outputs")
+
+	var artifacts []Artifact
+	err := filepath.Walk(outputDir, func(path string, info os.FileInfo, err error) error {
+		if err != nil || info.IsDir() {
+			return err
+		}
+
+		rel, err := filepath.Rel(outputDir, path)
+		if err != nil {
+			return err
+		}
+		objectName := fmt.Sprintf("%d/%s", job.ID, filepath.ToSlash(rel))
+
+		if _, err := storage.Client.FPutObject(ctx, "models", objectName, path, minio.PutObjectOptions{}); err != nil {
+			return fmt.Errorf("failed to upload %s: %v", rel, err)
+		}
+
+		artifacts = append(artifacts, Artifact{
+			Name: filepath.ToSlash(rel),
+			Path: objectName,
+			Size: info.Size(),
+		})
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return artifacts, nil
+}
+
+func (b *LocalBackend) FetchLogs(ctx context.Context, job *models.Job) ([]models.LogEntry, error) {
+	logPath := filepath.Join(job.RunRef, "train.log")
+	file, err := os.Open(logPath)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	timestamp := time.Now()
+	if info, err := file.Stat(); err == nil {
+		timestamp = info.ModTime()
+	}
+
+	var entries []models.LogEntry
+	scanner := bufio.NewScanner(file)
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+	for scanner.Scan() {
+		line := scanner.Text()
+		if line == "" {
+			continue
+		}
+		entries = append(entries, models.LogEntry{
+			JobID:     job.ID,
+			Level:     "info",
+			Message:   line,
+			Source:    b.Name(),
+			Timestamp: timestamp,
+		})
+	}
+
+	return entries, scanner.Err()
+}
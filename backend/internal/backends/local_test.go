@@ -0,0 +1,208 @@
+package backends
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"syscall"
+	"testing"
+	"time"
+
+	"finetune-studio/internal/jobs/retry"
+	"finetune-studio/internal/models"
+	"finetune-studio/internal/storage"
+
+	"github.com/minio/minio-go/v7"
+	"github.com/minio/minio-go/v7/pkg/credentials"
+)
+
+// fakeObjectStore serves the same small dataset for every object
+func fakeObjectStore(t *testing.T) {
+	t.Helper()
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Length", "2")
+		w.Header().Set("Content-Type", "application/json")
+		w.Header().Set("ETag", `"d751713988987e9331980363e24189ce"`)
+		w.Header().Set("Last-Modified", time.Now().UTC().Format(http.TimeFormat))
+		if r.Method == http.MethodGet {
+			w.Write([]byte("[]"))
+		}
+	}))
+	t.Cleanup(server.Close)
+
+	client, err := minio.New(strings.TrimPrefix(server.URL, "http://"), &minio.Options{
+		Creds:  credentials.NewStaticV4("test", "test", ""),
+		Region: "us-east-1",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	previous := storage.Client
+	storage.Client = client
+	t.Cleanup(func() { storage.Client = previous })
+}
+
+func waitForRun(t *testing.T, b *LocalBackend, job *models.Job, want RunState) RunStatus {
+	t.Helper()
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		status, err := b.Status(context.Background(), job)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if status.State == want {
+			return status
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("run %s is %s, want %s", job.RunRef, status.State, want)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+func TestLocalRetryRunsInItsOwnDirectory(t *testing.T) {
+	fakeObjectStore(t)
+	// The first attempt fails after the second one started; the second
+	// runs until cancelled
+	b := NewLocalBackend(`case "$PWD" in */attempt_1) sleep 0.3; exit 3;; esac; exec sleep 5`, t.TempDir())
+
+	first := models.Job{Attempts: 1, Dataset: models.Dataset{FilePath: "1/data.json"}}
+	first.ID = 1
+	ref, err := b.Submit(context.Background(), &first)
+	if err != nil {
+		t.Fatal(err)
+	}
+	first.RunRef = ref
+
+	second := first
+	second.Attempts = 2
+	if second.RunRef, err = b.Submit(context.Background(), &second); err != nil {
+		t.Fatal(err)
+	}
+	if second.RunRef == first.RunRef {
+		t.Fatalf("both attempts run in %s", ref)
+	}
+
+	status := waitForRun(t, b, &first, RunFailed)
+	if !strings.Contains(status.Message, "code 3") {
+		t.Fatalf("unexpected first attempt failure %q", status.Message)
+	}
+	// The end of the first attempt must not affect the second
+	waitForRun(t, b, &second, RunRunning)
+
+	if err := b.Cancel(context.Background(), &second); err != nil {
+		t.Fatal(err)
+	}
+	waitForRun(t, b, &second, RunFailed)
+}
+
+func TestLocalRefusesOtherDatasetContent(t *testing.T) {
+	fakeObjectStore(t)
+	b := NewLocalBackend("true", t.TempDir())
+
+	job := models.Job{Attempts: 1, Dataset: models.Dataset{FilePath: "1/data.json"}, DatasetHash: "0123456789ab"}
+	job.ID = 1
+	_, err := b.Submit(context.Background(), &job)
+	if err == nil || retry.Classify(err) != retry.ClassPermanent {
+		t.Fatalf("got %v, want a permanent error", err)
+	}
+}
+
+// processRunning reports whether a process exists and has not exited.
+// Orphans nobody reaps stay behind as zombies.
+func processRunning(pid int) bool {
+	stat, err := os.ReadFile(fmt.Sprintf("/proc/%d/stat", pid))
+	if err != nil {
+		return syscall.Kill(pid, 0) == nil
+	}
+	fields := strings.Fields(string(stat[strings.LastIndexByte(string(stat), ')')+1:]))
+	return len(fields) > 0 && fields[0] != "Z"
+}
+
+func TestLocalCancelStopsChildProcesses(t *testing.T) {
+	fakeObjectStore(t)
+	b := NewLocalBackend(`sleep 30 & echo $! > child_pid; wait`, t.TempDir())
+
+	job := models.Job{Attempts: 1, Dataset: models.Dataset{FilePath: "1/data.json"}}
+	job.ID = 1
+	ref, err := b.Submit(context.Background(), &job)
+	if err != nil {
+		t.Fatal(err)
+	}
+	job.RunRef = ref
+
+	var pid int
+	deadline := time.Now().Add(5 * time.Second)
+	for pid == 0 {
+		data, _ := os.ReadFile(filepath.Join(ref, "child_pid"))
+		pid, _ = strconv.Atoi(strings.TrimSpace(string(data)))
+		if pid == 0 && time.Now().After(deadline) {
+			t.Fatal("training command did not start its child")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	if err := b.Cancel(context.Background(), &job); err != nil {
+		t.Fatal(err)
+	}
+	waitForRun(t, b, &job, RunFailed)
+
+	deadline = time.Now().Add(5 * time.Second)
+	for processRunning(pid) {
+		if time.Now().After(deadline) {
+			syscall.Kill(pid, syscall.SIGKILL)
+			t.Fatalf("child process %d still running after cancel", pid)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+func TestLocalStatusReadsExitCodeAfterTheRun(t *testing.T) {
+	b := NewLocalBackend("true", t.TempDir())
+	job := models.Job{RunRef: t.TempDir()}
+	status := func() RunStatus {
+		t.Helper()
+		status, err := b.Status(context.Background(), &job)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return status
+	}
+
+	b.runs[job.RunRef] = func() {}
+	if got := status(); got.State != RunRunning {
+		t.Fatalf("tracked run without an exit code is %s", got.State)
+	}
+
+	// The exit code is written before the run is forgotten
+	if err := writeExitCode(job.RunRef, 0); err != nil {
+		t.Fatal(err)
+	}
+	if got := status(); got.State != RunCompleted {
+		t.Fatalf("run that exited 0 is %s", got.State)
+	}
+	delete(b.runs, job.RunRef)
+	if got := status(); got.State != RunCompleted {
+		t.Fatalf("forgotten run that exited 0 is %s", got.State)
+	}
+	if _, err := os.Stat(filepath.Join(job.RunRef, "exit_code.tmp")); !os.IsNotExist(err) {
+		t.Fatalf("temporary exit code file left behind: %v", err)
+	}
+
+	if err := os.WriteFile(filepath.Join(job.RunRef, "exit_code"), nil, 0644); err != nil {
+		t.Fatal(err)
+	}
+	if got, err := b.Status(context.Background(), &job); err == nil {
+		t.Fatalf("empty exit code read as %s", got.State)
+	}
+
+	os.Remove(filepath.Join(job.RunRef, "exit_code"))
+	if got := status(); got.State != RunFailed || !strings.Contains(got.Message, "lost") {
+		t.Fatalf("run without process nor exit code is %s (%s)", got.State, got.Message)
+	}
+}
@@ -0,0 +1,46 @@
+package backends
+
+import (
+	"path"
+	"strings"
+)
+
+// Manifest groups the artifacts of a run by role. It is stored as the
+// model's files.
+type Manifest struct {
+	LoRAAdapters []Artifact `json:"lora_adapters"`
+	GGUF         []Artifact `json:"gguf"`
+	Metrics      *Artifact  `json:"metrics,omitempty"`
+	Logs         []Artifact `json:"logs"`
+	Other        []Artifact `json:"other"`
+	TotalSize    int64      `json:"total_size"`
+}
+
+// NewManifest sorts artifacts into the manifest sections
+func NewManifest(artifacts []Artifact) Manifest {
+	m := Manifest{
+		LoRAAdapters: []Artifact{},
+		GGUF:         []Artifact{},
+		Logs:         []Artifact{},
+		Other:        []Artifact{},
+	}
+
+	for _, artifact := range artifacts {
+		m.TotalSize += artifact.Size
+		name := artifact.Name
+		switch {
+		case strings.HasPrefix(name, "lora_adapters/"):
+			m.LoRAAdapters = append(m.LoRAAdapters, artifact)
+		case strings.HasSuffix(name, ".gguf"):
+			m.GGUF = append(m.GGUF, artifact)
+		case name == "metrics.json" && m.Metrics == nil:
+			a := artifact
+			m.Metrics = &a
+		case path.Ext(name) == ".log" || strings.HasPrefix(name, "logs/") || path.Base(name) == "trainer_state.json":
+			m.Logs = append(m.Logs, artifact)
+		default:
+			m.Other = append(m.Other, artifact)
+		}
+	}
+	return m
+}
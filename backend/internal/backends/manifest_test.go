@@ -0,0 +1,126 @@
+package backends
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"sort"
+	"strings"
+	"sync"
+	"testing"
+
+	"finetune-studio/internal/database/databasetest"
+	"finetune-studio/internal/models"
+	"finetune-studio/internal/services/kaggle/kaggletest"
+	"finetune-studio/internal/storage"
+
+	"github.com/minio/minio-go/v7"
+	"github.com/minio/minio-go/v7/pkg/credentials"
+)
+
+// recordingObjectStore keeps the objects put into it by path
+func recordingObjectStore(t *testing.T) map[string]string {
+	t.Helper()
+	var mu sync.Mutex
+	objects := make(map[string]string)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPut {
+			http.Error(w, "not found", http.StatusNotFound)
+			return
+		}
+		body, _ := io.ReadAll(r.Body)
+		mu.Lock()
+		objects[strings.TrimPrefix(r.URL.Path, "/")] = string(body)
+		mu.Unlock()
+		w.Header().Set("ETag", `"d41d8cd98f00b204e9800998ecf8427e"`)
+	}))
+	t.Cleanup(server.Close)
+
+	// Anonymous requests send the plain object instead of signed chunks
+	client, err := minio.New(strings.TrimPrefix(server.URL, "http://"), &minio.Options{
+		Creds:  credentials.NewStaticV4("", "", ""),
+		Region: "us-east-1",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	previous := storage.Client
+	storage.Client = client
+	t.Cleanup(func() { storage.Client = previous })
+	return objects
+}
+
+func TestNewManifest(t *testing.T) {
+	m := NewManifest([]Artifact{
+		{Name: "lora_adapters/adapter_config.json", Size: 10},
+		{Name: "lora_adapters/adapter_model.safetensors", Size: 100},
+		{Name: "gguf/unsloth.Q4_K_M.gguf", Size: 1000},
+		{Name: "metrics.json", Size: 5},
+		{Name: "train.log", Size: 1},
+		{Name: "logs/events.out", Size: 1},
+		{Name: "trainer_state.json", Size: 1},
+		{Name: "README.md", Size: 2},
+	})
+
+	if len(m.LoRAAdapters) != 2 || len(m.GGUF) != 1 || len(m.Logs) != 3 || len(m.Other) != 1 {
+		t.Fatalf("unexpected sections %+v", m)
+	}
+	if m.Metrics == nil || m.Metrics.Name != "metrics.json" {
+		t.Fatalf("metrics not found: %+v", m.Metrics)
+	}
+	if m.TotalSize != 1120 {
+		t.Fatalf("total size %d, want 1120", m.TotalSize)
+	}
+
+	// Sections are never null in the stored files
+	empty := NewManifest(nil)
+	if empty.LoRAAdapters == nil || empty.GGUF == nil || empty.Logs == nil || empty.Other == nil || empty.Metrics != nil {
+		t.Fatalf("unexpected empty manifest %+v", empty)
+	}
+}
+
+func TestFetchArtifactsCopiesKernelOutputs(t *testing.T) {
+	databasetest.Open(t)
+	objects := recordingObjectStore(t)
+	server := kaggletest.NewServer()
+	defer server.Close()
+
+	script := kaggletest.DefaultScript()
+	script.Outputs["outputs/checkpoint-10/optimizer.pt"] = []byte("checkpoint")
+	server.SetScript(script)
+
+	b := NewKaggleBackend(server.APIURL(), "tester", "secret", "")
+	job := models.Job{Backend: "kaggle"}
+	job.ID = 7
+	svc, err := b.serviceFor(&job)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if job.RunRef, err = svc.PushKernel(context.Background(), "finetune-job-7", []byte(`{}`), nil); err != nil {
+		t.Fatal(err)
+	}
+
+	artifacts, err := b.FetchArtifacts(context.Background(), &job)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var names []string
+	for _, artifact := range artifacts {
+		names = append(names, artifact.Name)
+		if artifact.Path != "7/"+artifact.Name {
+			t.Errorf("%s copied to %s", artifact.Name, artifact.Path)
+		}
+		if want := string(script.Outputs[artifact.Name]); objects["models/"+artifact.Path] != want || artifact.Size != int64(len(want)) {
+			t.Errorf("%s stored as %q (%d bytes), want %q", artifact.Name, objects["models/"+artifact.Path], artifact.Size, want)
+		}
+	}
+	sort.Strings(names)
+	if got := strings.Join(names, " "); got != "gguf/unsloth.Q4_K_M.gguf lora_adapters/adapter_config.json lora_adapters/adapter_model.safetensors metrics.json" {
+		t.Fatalf("copied %s", got)
+	}
+	if len(objects) != len(artifacts) {
+		t.Fatalf("stored %d objects for %d artifacts", len(objects), len(artifacts))
+	}
+}
@@ -29,6 +29,14 @@ type Config struct {
 	// Kaggle
 	KaggleUsername string
 	KaggleKey      string
+	KaggleAPIURL   string // Empty uses the public Kaggle API
+
+	KaggleWeeklyGPUHours       float64
+	KaggleMaxConcurrentKernels int
+
+	// Encrypts credentials stored in the database, such as Kaggle accounts and
+	// webhook secrets
+	SecretsEncryptionKey string
 
 	// Security
 	AllowedOrigins                string
@@ -40,6 +48,17 @@ type Config struct {
 	WorkerPoolSize int
 	WorkerTimeout  time.Duration
 
+	// Job queue
+	QueueLeaseDuration time.Duration
+	QueuePollInterval  time.Duration
+
+	// Training backends
+	DefaultTrainingBackend string
+	LocalTrainingCommand   string
+	LocalTrainingWorkDir   string
+	NotebookTemplatePath   string
+	LogMetricsRulesPath    string // Empty uses the built-in log metrics rules
+
 	// Logging
 	LogLevel  string
 	LogFormat string
@@ -64,12 +83,23 @@ func LoadConfig() (*Config, error) {
 		MinioBucket:                  getEnv("MINIO_BUCKET", "finetune-models"),
 		KaggleUsername:               getEnv("KAGGLE_USERNAME", ""),
 		KaggleKey:                    getEnv("KAGGLE_KEY", ""),
+		KaggleAPIURL:                 getEnv("KAGGLE_API_URL", ""),
+		KaggleWeeklyGPUHours:         getEnvFloat("KAGGLE_WEEKLY_GPU_HOURS", 30),
+		KaggleMaxConcurrentKernels:   getEnvInt("KAGGLE_MAX_CONCURRENT_KERNELS", 2),
+		SecretsEncryptionKey:         getEnv("SECRETS_ENCRYPTION_KEY", ""),
 		AllowedOrigins:               getEnv("ALLOWED_ORIGINS", "*"),
 		RateLimitRequestsPerMinute:   getEnvInt("RATE_LIMIT_REQUESTS_PER_MINUTE", 100),
 		RateLimitExpensiveEndpoints:  getEnvInt("RATE_LIMIT_EXPENSIVE_ENDPOINTS", 10),
 		MaxRequestSizeMB:             getEnvInt("MAX_REQUEST_SIZE_MB", 10),
 		WorkerPoolSize:               getEnvInt("WORKER_POOL_SIZE", 5),
 		WorkerTimeout:                getEnvDuration("WORKER_TIMEOUT", 24*time.Hour),
+		QueueLeaseDuration:           getEnvDuration("QUEUE_LEASE_DURATION", 2*time.Minute),
+		QueuePollInterval:            getEnvDuration("QUEUE_POLL_INTERVAL", 5*time.Second),
+		DefaultTrainingBackend:       getEnv("DEFAULT_TRAINING_BACKEND", ""),
+		LocalTrainingCommand:         getEnv("LOCAL_TRAINING_COMMAND", ""),
+		LocalTrainingWorkDir:         getEnv("LOCAL_TRAINING_WORKDIR", "/tmp/local_training"),
+		NotebookTemplatePath:         getEnv("NOTEBOOK_TEMPLATE_PATH", "/app/templates/finetune-kernel.ipynb"),
+		LogMetricsRulesPath:          getEnv("LOG_METRICS_RULES_PATH", ""),
 		LogLevel:                     getEnv("LOG_LEVEL", "info"),
 		LogFormat:                    getEnv("LOG_FORMAT", "console"),
 		MetricsEnabled:               getEnv("METRICS_ENABLED", "true") == "true",
@@ -78,9 +108,12 @@ func LoadConfig() (*Config, error) {
 	// Validate required fields in production
 	if cfg.AppEnv == "production" {
 		required := map[string]string{
-			"DATABASE_URL":    cfg.DatabaseURL,
-			"KAGGLE_USERNAME": cfg.KaggleUsername,
-			"KAGGLE_KEY":      cfg.KaggleKey,
+			"DATABASE_URL": cfg.DatabaseURL,
+		}
+		// Without an encryption key the environment holds the only Kaggle account
+		if cfg.SecretsEncryptionKey == "" {
+			required["KAGGLE_USERNAME"] = cfg.KaggleUsername
+			required["KAGGLE_KEY"] = cfg.KaggleKey
 		}
 		for key, value := range required {
 			if value == "" {
@@ -108,6 +141,15 @@ func getEnvInt(key string, fallback int) int {
 	return fallback
 }
 
+func getEnvFloat(key string, fallback float64) float64 {
+	if value, exists := os.LookupEnv(key); exists {
+		if floatVal, err := strconv.ParseFloat(value, 64); err == nil {
+			return floatVal
+		}
+	}
+	return fallback
+}
+
 func getEnvDuration(key string, fallback time.Duration) time.Duration {
 	if value, exists := os.LookupEnv(key); exists {
 		if duration, err := time.ParseDuration(value); err == nil {
@@ -0,0 +1,48 @@
+// Package databasetest points database.DB at a fresh in-memory SQLite
+// database for unit tests. Row locks are ignored by the SQLite dialect;
+// Postgres-only SQL such as advisory locks and jsonb operators is not
+// available and stays covered by the integration tests.
+package databasetest
+
+import (
+	"fmt"
+	"sync/atomic"
+	"testing"
+
+	"finetune-studio/internal/database"
+
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+	"gorm.io/gorm/logger"
+)
+
+var counter atomic.Int64
+
+// Open migrates a new database, installs it as database.DB for the duration
+// of the test and returns it
+func Open(t testing.TB) *gorm.DB {
+	t.Helper()
+
+	// A single connection keeps the in-memory database alive and shared
+	dsn := fmt.Sprintf("file:test%d?mode=memory&cache=shared&_foreign_keys=off", counter.Add(1))
+	db, err := gorm.Open(sqlite.Open(dsn), &gorm.Config{Logger: logger.Default.LogMode(logger.Silent)})
+	if err != nil {
+		t.Fatalf("failed to open test database: %v", err)
+	}
+	sqlDB, err := db.DB()
+	if err != nil {
+		t.Fatal(err)
+	}
+	sqlDB.SetMaxOpenConns(1)
+	if err := db.AutoMigrate(database.Models()...); err != nil {
+		t.Fatalf("failed to migrate test database: %v", err)
+	}
+
+	previous := database.DB
+	database.DB = db
+	t.Cleanup(func() {
+		database.DB = previous
+		sqlDB.Close()
+	})
+	return db
+}
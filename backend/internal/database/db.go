@@ -35,10 +35,15 @@ func Connect(databaseURL string) {
 	log.Println("✅ Connected to PostgreSQL successfully")
 
 	// AutoMigrate models
-	err = DB.AutoMigrate(&models.Dataset{}, &models.Job{}, &models.Model{}, &models.Evaluation{}, &models.LogEntry{})
+	err = DB.AutoMigrate(Models()...)
 	if err != nil {
 		log.Printf("❌ AutoMigrate failed: %v", err)
 	} else {
 		log.Println("✅ Database schema migrated successfully")
 	}
 }
+
+// Models lists every migrated model
+func Models() []interface{} {
+	return []interface{}{&models.Dataset{}, &models.Job{}, &models.Model{}, &models.Evaluation{}, &models.LogEntry{}, &models.JobEvent{}, &models.Preset{}, &models.PresetVersion{}, &models.Sweep{}, &models.KaggleDataset{}, &models.KaggleSession{}, &models.KaggleAccount{}, &models.Schedule{}, &models.ScheduleRun{}, &models.Pipeline{}, &models.PipelineStep{}, &models.Webhook{}, &models.OutboxEvent{}, &models.WebhookDelivery{}, &models.JobMetricPoint{}}
+}
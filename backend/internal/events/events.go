@@ -0,0 +1,135 @@
+// Package events is an in-process pub/sub of job status and metric changes,
+// used to push live updates to stream clients. Only changes made by this
+// replica are published; stream handlers re-read the database periodically
+// to pick up the rest.
+package events
+
+import (
+	"encoding/json"
+	"sync"
+	"time"
+)
+
+// Event types
+const (
+	TypeSnapshot = "snapshot" // Current state of a job, sent when a client subscribes
+	TypeStatus   = "status"
+	TypeMetrics  = "metrics"
+)
+
+// bufferSize is the number of events a subscriber may fall behind by before
+// it is dropped
+const bufferSize = 64
+
+// Event is a change of a job
+type Event struct {
+	Type           string          `json:"type"`
+	JobID          uint            `json:"job_id"`
+	Status         string          `json:"status,omitempty"`
+	PreviousStatus string          `json:"previous_status,omitempty"`
+	Reason         string          `json:"reason,omitempty"`
+	Metrics        json.RawMessage `json:"metrics,omitempty"`
+	Time           time.Time       `json:"time"`
+}
+
+// Broker fans published events out to the subscribers of each job
+type Broker struct {
+	mu   sync.Mutex
+	subs map[*Subscription]struct{}
+}
+
+// Default is the broker fed by the worker and the job state machine
+var Default = NewBroker()
+
+func NewBroker() *Broker {
+	return &Broker{subs: make(map[*Subscription]struct{})}
+}
+
+// Subscription receives the events of a set of jobs on C. C is closed when
+// the subscription is closed or when the subscriber fell too far behind, in
+// which case clients should resubscribe and start from a snapshot.
+type Subscription struct {
+	C <-chan Event
+
+	c      chan Event
+	broker *Broker
+	jobs   map[uint]bool
+}
+
+// Subscribe starts receiving the events of the given jobs
+func (b *Broker) Subscribe(jobIDs ...uint) *Subscription {
+	c := make(chan Event, bufferSize)
+	s := &Subscription{C: c, c: c, broker: b, jobs: make(map[uint]bool)}
+	for _, id := range jobIDs {
+		s.jobs[id] = true
+	}
+
+	b.mu.Lock()
+	b.subs[s] = struct{}{}
+	b.mu.Unlock()
+	return s
+}
+
+// Publish sends an event to every subscriber of its job without blocking
+func (b *Broker) Publish(event Event) {
+	if event.Time.IsZero() {
+		event.Time = time.Now()
+	}
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	for s := range b.subs {
+		if !s.jobs[event.JobID] {
+			continue
+		}
+		select {
+		case s.c <- event:
+		default:
+			b.drop(s)
+		}
+	}
+}
+
+// drop removes a subscription and closes its channel. Callers hold b.mu.
+func (b *Broker) drop(s *Subscription) {
+	if _, ok := b.subs[s]; ok {
+		delete(b.subs, s)
+		close(s.c)
+	}
+}
+
+// Add subscribes to more jobs
+func (s *Subscription) Add(jobIDs ...uint) {
+	s.broker.mu.Lock()
+	defer s.broker.mu.Unlock()
+	for _, id := range jobIDs {
+		s.jobs[id] = true
+	}
+}
+
+// Remove stops receiving the events of some jobs
+func (s *Subscription) Remove(jobIDs ...uint) {
+	s.broker.mu.Lock()
+	defer s.broker.mu.Unlock()
+	for _, id := range jobIDs {
+		delete(s.jobs, id)
+	}
+}
+
+// Jobs returns the subscribed job ids
+func (s *Subscription) Jobs() []uint {
+	s.broker.mu.Lock()
+	defer s.broker.mu.Unlock()
+	ids := make([]uint, 0, len(s.jobs))
+	for id := range s.jobs {
+		ids = append(ids, id)
+	}
+	return ids
+}
+
+// Close ends the subscription. It is safe to call more than once.
+func (s *Subscription) Close() {
+	s.broker.mu.Lock()
+	defer s.broker.mu.Unlock()
+	s.broker.drop(s)
+}
@@ -0,0 +1,45 @@
+package events
+
+import "testing"
+
+func TestPublishRoutesByJob(t *testing.T) {
+	b := NewBroker()
+	s := b.Subscribe(1)
+	defer s.Close()
+
+	b.Publish(Event{Type: TypeStatus, JobID: 2, Status: "running"})
+	b.Publish(Event{Type: TypeStatus, JobID: 1, Status: "running"})
+	if got := <-s.C; got.JobID != 1 || got.Time.IsZero() {
+		t.Fatalf("got %+v, want a timestamped event of job 1", got)
+	}
+
+	s.Add(2)
+	s.Remove(1)
+	b.Publish(Event{Type: TypeMetrics, JobID: 1})
+	b.Publish(Event{Type: TypeMetrics, JobID: 2})
+	if got := <-s.C; got.JobID != 2 {
+		t.Fatalf("got event of job %d, want job 2", got.JobID)
+	}
+	if len(s.C) != 0 {
+		t.Fatalf("%d unexpected events queued", len(s.C))
+	}
+}
+
+func TestSlowSubscriberIsDropped(t *testing.T) {
+	b := NewBroker()
+	s := b.Subscribe(1)
+
+	for i := 0; i <= bufferSize; i++ {
+		b.Publish(Event{Type: TypeMetrics, JobID: 1})
+	}
+	received := 0
+	for range s.C {
+		received++
+	}
+	if received != bufferSize {
+		t.Fatalf("received %d events before the channel closed, want %d", received, bufferSize)
+	}
+
+	// Closing a dropped subscription is a no-op
+	s.Close()
+}
@@ -0,0 +1,60 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+	"time"
+
+	"finetune-studio/internal/backends"
+	"finetune-studio/internal/database"
+	"finetune-studio/internal/models"
+
+	"github.com/gin-gonic/gin"
+)
+
+// GetKaggleQuota handles GET /api/v1/backends/kaggle/quota. It reports the
+// usage of every account and lists the jobs waiting for quota.
+func GetKaggleQuota(c *gin.Context) {
+	backend, err := backends.Get("kaggle")
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Kaggle backend is not configured"})
+		return
+	}
+	kaggleBackend, ok := backend.(*backends.KaggleBackend)
+	if !ok {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Kaggle backend is not configured"})
+		return
+	}
+
+	reports, err := kaggleBackend.QuotaReport()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to compute Kaggle quota"})
+		return
+	}
+
+	var held []models.Job
+	database.DB.Select("id", "status", "metrics", "next_attempt_at").
+		Where("backend = ? AND status IN ? AND next_attempt_at > ?", "kaggle", []string{"pending", "retrying"}, time.Now()).
+		Where("metrics->>'stage' = ?", "held").
+		Order("created_at, id").
+		Find(&held)
+
+	heldJobs := make([]gin.H, 0, len(held))
+	for _, job := range held {
+		var metrics struct {
+			HoldReason string `json:"hold_reason"`
+		}
+		json.Unmarshal(job.Metrics, &metrics)
+		heldJobs = append(heldJobs, gin.H{
+			"job_id":          job.ID,
+			"status":          job.Status,
+			"reason":          metrics.HoldReason,
+			"next_attempt_at": job.NextAttemptAt,
+		})
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"accounts":  reports,
+		"held_jobs": heldJobs,
+	})
+}
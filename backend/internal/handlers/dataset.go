@@ -3,6 +3,7 @@ package handlers
 import (
 	"bytes"
 	"context"
+	"crypto/sha256"
 	"encoding/json"
 	"fmt"
 	"io"
@@ -110,6 +111,7 @@ func UploadDataset(c *gin.Context) {
 		Name:              name,
 		Description:       description,
 		FilePath:          objectName,
+		ContentHash:       fmt.Sprintf("%x", sha256.Sum256(content)),
 		Type:              datasetType,
 		NumExamples:       validationResult.Stats.NumExamples,
 		AvgLength:         validationResult.Stats.AvgLength,
@@ -8,9 +8,11 @@ import (
 
 	"finetune-studio/internal/database"
 	"finetune-studio/internal/models"
+	"finetune-studio/internal/outbox"
 
 	"github.com/gin-gonic/gin"
 	"gorm.io/datatypes"
+	"gorm.io/gorm"
 )
 
 type EvaluationHandler struct{}
@@ -65,7 +67,13 @@ func (h *EvaluationHandler) CreateEvaluation(c *gin.Context) {
 		Examples:      datatypes.JSON([]byte("[]")),
 	}
 
-	if err := database.DB.Create(&evaluation).Error; err != nil {
+	err = database.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Create(&evaluation).Error; err != nil {
+			return err
+		}
+		return outbox.Add(tx, outbox.EvaluationCreated, outbox.Evaluation(&evaluation))
+	})
+	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create evaluation"})
 		return
 	}
@@ -177,6 +185,10 @@ func (h *EvaluationHandler) UpdateEvaluation(c *gin.Context) {
 	}
 
 	// Update fields
+	event := ""
+	if updates.Status != "" && updates.Status != evaluation.Status {
+		event = outbox.EvaluationStatus(updates.Status)
+	}
 	if updates.Status != "" {
 		evaluation.Status = updates.Status
 		
@@ -200,7 +212,16 @@ func (h *EvaluationHandler) UpdateEvaluation(c *gin.Context) {
 		evaluation.ErrorMessage = updates.ErrorMessage
 	}
 
-	if err := database.DB.Save(&evaluation).Error; err != nil {
+	err := database.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Save(&evaluation).Error; err != nil {
+			return err
+		}
+		if event == "" {
+			return nil
+		}
+		return outbox.Add(tx, event, outbox.Evaluation(&evaluation))
+	})
+	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update evaluation"})
 		return
 	}
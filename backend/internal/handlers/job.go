@@ -2,22 +2,40 @@ package handlers
 
 import (
 	"encoding/json"
+	"errors"
 	"fmt"
 	"net/http"
 	"strconv"
-	"time"
 
 	"finetune-studio/internal/database"
+	"finetune-studio/internal/jobs"
+	"finetune-studio/internal/jobs/statemachine"
+	"finetune-studio/internal/jobs/trainingconfig"
+	"finetune-studio/internal/logger"
 	"finetune-studio/internal/models"
+	"finetune-studio/internal/notebook"
+	"finetune-studio/internal/presets"
+	"finetune-studio/internal/storage"
 	"finetune-studio/internal/worker"
 
 	"github.com/gin-gonic/gin"
-	"gorm.io/datatypes"
+	"github.com/minio/minio-go/v7"
+	"go.uber.org/zap"
+	"gorm.io/gorm"
 )
 
 type CreateJobRequest struct {
-	DatasetID     uint                   `json:"dataset_id" binding:"required"`
-	Configuration map[string]interface{} `json:"configuration"`
+	DatasetID     uint            `json:"dataset_id" binding:"required"`
+	Configuration json.RawMessage `json:"configuration"` // trainingconfig.TrainingConfig plus reserved keys
+
+	// Optional preset the configuration overrides; version 0 uses the latest
+	PresetID      *uint `json:"preset_id"`
+	PresetVersion int   `json:"preset_version"`
+
+	// Optional ready model whose LoRA adapters training continues from
+	ParentModelID *uint `json:"parent_model_id"`
+
+	jobs.Scheduling
 }
 
 // CreateJob handles POST /api/v1/jobs
@@ -35,27 +53,148 @@ func CreateJob(c *gin.Context) {
 		return
 	}
 
-	// Create Job in DB
-	configJSON, _ := json.Marshal(req.Configuration)
-	job := models.Job{
-		DatasetID:     req.DatasetID,
-		Status:        "pending",
-		Configuration: datatypes.JSON(configJSON),
-		Metrics:       datatypes.JSON([]byte("{}")),
+	// Apply the configuration on top of the preset when one is given
+	configJSON := []byte(req.Configuration)
+	presetVersion := 0
+	if req.PresetID != nil {
+		var err error
+		configJSON, presetVersion, err = presets.JobConfig(database.DB, *req.PresetID, req.PresetVersion, req.Configuration)
+		if err != nil {
+			respondPresetError(c, err)
+			return
+		}
 	}
 
-	if err := database.DB.Create(&job).Error; err != nil {
+	job, err := jobs.New(req.DatasetID, configJSON, worker.Pool.JobTimeout)
+	if err != nil {
+		respondConfigError(c, err)
+		return
+	}
+	job.PresetID = req.PresetID
+	job.PresetVersion = presetVersion
+	if err := req.Scheduling.Apply(job); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if req.ParentModelID != nil {
+		if err := jobs.SetParent(job, *req.ParentModelID); err != nil {
+			respondParentError(c, err)
+			return
+		}
+	}
+
+	err = database.DB.Transaction(func(tx *gorm.DB) error {
+		return jobs.Create(tx, job, statemachine.ActorAPI, "created")
+	})
+	if err != nil {
+		logger.Error("Failed to create job", zap.Error(err))
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create job"})
 		return
 	}
 
-	// Enqueue Job
-	select {
-	case worker.Pool.JobQueue <- job.ID:
-		c.JSON(http.StatusCreated, job)
-	default:
-		c.JSON(http.StatusServiceUnavailable, gin.H{"error": "Job queue is full"})
+	// The pending row is the queue entry; wake a worker to pick it up
+	worker.Pool.Notify()
+	c.JSON(http.StatusCreated, job)
+}
+
+// respondConfigError reports an invalid training configuration field by field
+func respondConfigError(c *gin.Context, err error) {
+	var validationErr *trainingconfig.ValidationError
+	if errors.As(err, &validationErr) {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error":  "Invalid training configuration",
+			"fields": validationErr.Fields,
+		})
+		return
 	}
+	c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+}
+
+type CloneJobRequest struct {
+	DatasetID     uint            `json:"dataset_id"`    // Defaults to the source job dataset
+	Configuration json.RawMessage `json:"configuration"` // Overrides on top of the source configuration
+
+	// Scheduling overrides; the source job values are kept otherwise
+	Priority  *int   `json:"priority"`
+	Submitter string `json:"submitter"`
+	Project   string `json:"project"`
+}
+
+// CloneJob handles POST /api/v1/jobs/:id/clone. The new job starts from the
+// resolved configuration, dataset and template version of the source job.
+func CloneJob(c *gin.Context) {
+	var source models.Job
+	if err := database.DB.First(&source, c.Param("id")).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Job not found"})
+		return
+	}
+
+	var req CloneJobRequest
+	if c.Request.ContentLength != 0 {
+		if err := c.ShouldBindJSON(&req); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+	}
+
+	if req.DatasetID != 0 {
+		var dataset models.Dataset
+		if err := database.DB.First(&dataset, req.DatasetID).Error; err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Dataset not found"})
+			return
+		}
+	}
+
+	job, err := jobs.Clone(&source, req.DatasetID, req.Configuration, worker.Pool.JobTimeout)
+	if err != nil {
+		if errors.Is(err, jobs.ErrParentModelNotFound) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "The parent model of the source job no longer exists"})
+			return
+		}
+		respondConfigError(c, err)
+		return
+	}
+
+	scheduling := jobs.Scheduling{Priority: job.Priority, Submitter: job.Submitter, Project: job.Project}
+	if req.Priority != nil {
+		scheduling.Priority = *req.Priority
+	}
+	if req.Submitter != "" {
+		scheduling.Submitter = req.Submitter
+	}
+	if req.Project != "" {
+		scheduling.Project = req.Project
+	}
+	if err := scheduling.Apply(job); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	err = database.DB.Transaction(func(tx *gorm.DB) error {
+		return jobs.Create(tx, job, statemachine.ActorAPI, fmt.Sprintf("cloned from job %d", source.ID))
+	})
+	if err != nil {
+		logger.Error("Failed to create job", zap.Error(err))
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create job"})
+		return
+	}
+
+	worker.Pool.Notify()
+	c.JSON(http.StatusCreated, job)
+}
+
+// respondParentError reports a parent model that can't be trained further
+func respondParentError(c *gin.Context, err error) {
+	if errors.Is(err, jobs.ErrParentModelNotFound) {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Parent model not found"})
+		return
+	}
+	c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+}
+
+// GetConfigSchema handles GET /api/v1/jobs/config-schema
+func GetConfigSchema(c *gin.Context) {
+	c.JSON(http.StatusOK, trainingconfig.Schema())
 }
 
 // ListJobs handles GET /api/v1/jobs
@@ -110,14 +249,82 @@ func CancelJob(c *gin.Context) {
 		return
 	}
 
-	if job.Status == "completed" || job.Status == "failed" {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "Cannot cancel a completed or failed job"})
+	if err := worker.Pool.RequestCancel(&job, statemachine.ActorAPI, "cancelled by user"); err != nil {
+		var transitionErr *statemachine.TransitionError
+		if errors.As(err, &transitionErr) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("Cannot cancel a %s job", job.Status)})
+			return
+		}
+		if errors.Is(err, statemachine.ErrConcurrentUpdate) {
+			c.JSON(http.StatusConflict, gin.H{"error": "Job status changed, retry the request"})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to cancel job"})
+		return
+	}
+
+	if job.Status == string(statemachine.Cancelling) {
+		c.JSON(http.StatusAccepted, gin.H{"message": "Cancellation requested", "status": job.Status})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Job marked as cancelled", "status": job.Status})
+}
+
+// GetJobNotebook handles GET /api/v1/jobs/:id/notebook and returns the
+// rendered notebook that was pushed for the job
+func GetJobNotebook(c *gin.Context) {
+	id := c.Param("id")
+	var job models.Job
+
+	if err := database.DB.First(&job, id).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Job not found"})
+		return
+	}
+
+	if job.NotebookPath == "" {
+		c.JSON(http.StatusNotFound, gin.H{"error": "No notebook was rendered for this job"})
 		return
 	}
 
-	job.Status = "cancelled"
-	job.Metrics = datatypes.JSON([]byte(fmt.Sprintf(`{"cancelled_at": "%s"}`, time.Now().Format(time.RFC3339))))
-	database.DB.Save(&job)
+	obj, err := storage.Client.GetObject(c.Request.Context(), notebook.Bucket, job.NotebookPath, minio.GetObjectOptions{})
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch notebook"})
+		return
+	}
+	defer obj.Close()
+
+	info, err := obj.Stat()
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Notebook not found in storage"})
+		return
+	}
+
+	c.Header("X-Template-Version", job.TemplateVersion)
+	c.DataFromReader(http.StatusOK, info.Size, "application/x-ipynb+json", obj, map[string]string{
+		"Content-Disposition": fmt.Sprintf(`attachment; filename="job-%d.ipynb"`, job.ID),
+	})
+}
+
+// GetJobEvents handles GET /api/v1/jobs/:id/events
+func GetJobEvents(c *gin.Context) {
+	id := c.Param("id")
+	var job models.Job
 
-	c.JSON(http.StatusOK, gin.H{"message": "Job marked as cancelled"})
+	if err := database.DB.First(&job, id).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Job not found"})
+		return
+	}
+
+	events, err := statemachine.Events(job.ID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch job events"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"job_id": job.ID,
+		"status": job.Status,
+		"events": events,
+	})
 }
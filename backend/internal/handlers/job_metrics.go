@@ -0,0 +1,112 @@
+package handlers
+
+import (
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"finetune-studio/internal/database"
+	"finetune-studio/internal/jobs/series"
+	"finetune-studio/internal/models"
+
+	"github.com/gin-gonic/gin"
+)
+
+// maxDownsample bounds the points per series a client may ask for
+const maxDownsample = 10000
+
+type MetricPointsRequest struct {
+	Entries []series.Entry `json:"entries" binding:"required"`
+}
+
+// CreateJobMetrics handles POST /api/v1/jobs/:id/metrics (for kernels to push
+// the metrics they log at each step). Entries already recorded for a step
+// are ignored, so a kernel may resend a batch.
+func CreateJobMetrics(c *gin.Context) {
+	var job models.Job
+	if err := database.DB.First(&job, c.Param("id")).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Job not found"})
+		return
+	}
+
+	var req MetricPointsRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	points, err := series.Points(job.ID, req.Entries, time.Now())
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	recorded, err := series.Record(points)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to save metric points"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"received": len(points), "recorded": recorded})
+}
+
+// GetJobMetrics handles GET /api/v1/jobs/:id/metrics?names=loss,learning_rate&downsample=500.
+// Jobs listed in compare=2,3 are returned alongside, for overlaying their
+// curves on one chart.
+func GetJobMetrics(c *gin.Context) {
+	var job models.Job
+	if err := database.DB.First(&job, c.Param("id")).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Job not found"})
+		return
+	}
+
+	compare, err := parseJobIDs(c.Query("compare"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	jobIDs := []uint{job.ID}
+	seen := map[uint]bool{job.ID: true}
+	for _, id := range compare {
+		if !seen[id] {
+			seen[id] = true
+			jobIDs = append(jobIDs, id)
+		}
+	}
+	var found int64
+	database.DB.Model(&models.Job{}).Where("id IN ?", jobIDs).Count(&found)
+	if int(found) != len(jobIDs) {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Compared job not found"})
+		return
+	}
+
+	var names []string
+	for _, name := range strings.Split(c.Query("names"), ",") {
+		if name = strings.TrimSpace(name); name != "" {
+			names = append(names, name)
+		}
+	}
+
+	downsample, err := strconv.Atoi(c.DefaultQuery("downsample", strconv.Itoa(series.DefaultDownsample)))
+	if err != nil || downsample < 0 || downsample > maxDownsample {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "downsample must be between 0 (every point) and " + strconv.Itoa(maxDownsample)})
+		return
+	}
+
+	result, err := series.Query(jobIDs, names, downsample)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch metrics"})
+		return
+	}
+	available, err := series.Names(jobIDs)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch metrics"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"job_ids": jobIDs,
+		"names":   available,
+		"series":  result,
+	})
+}
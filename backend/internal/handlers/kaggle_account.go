@@ -0,0 +1,152 @@
+package handlers
+
+import (
+	"net/http"
+	"strings"
+
+	"finetune-studio/internal/database"
+	"finetune-studio/internal/models"
+	"finetune-studio/internal/secrets"
+
+	"github.com/gin-gonic/gin"
+)
+
+type KaggleAccountRequest struct {
+	Username             string   `json:"username"`
+	Key                  string   `json:"key"`
+	Enabled              *bool    `json:"enabled"`
+	WeeklyGPUHours       *float64 `json:"weekly_gpu_hours"`       // 0 uses KAGGLE_WEEKLY_GPU_HOURS
+	MaxConcurrentKernels *int     `json:"max_concurrent_kernels"` // 0 uses KAGGLE_MAX_CONCURRENT_KERNELS
+}
+
+// CreateKaggleAccount handles POST /api/v1/backends/kaggle/accounts
+func CreateKaggleAccount(c *gin.Context) {
+	if !secrets.Enabled() {
+		c.JSON(http.StatusServiceUnavailable, gin.H{"error": "SECRETS_ENCRYPTION_KEY must be set to store Kaggle accounts"})
+		return
+	}
+
+	var req KaggleAccountRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	req.Username = strings.TrimSpace(req.Username)
+	if req.Username == "" || req.Key == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "username and key are required"})
+		return
+	}
+
+	account := models.KaggleAccount{Username: req.Username, Enabled: true}
+	if !applyKaggleAccountRequest(c, &account, req) {
+		return
+	}
+
+	var existing int64
+	database.DB.Model(&models.KaggleAccount{}).Where("username = ?", account.Username).Count(&existing)
+	if existing > 0 {
+		c.JSON(http.StatusConflict, gin.H{"error": "This Kaggle account is already registered"})
+		return
+	}
+
+	if err := database.DB.Create(&account).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to save Kaggle account"})
+		return
+	}
+
+	c.JSON(http.StatusCreated, account)
+}
+
+// ListKaggleAccounts handles GET /api/v1/backends/kaggle/accounts
+func ListKaggleAccounts(c *gin.Context) {
+	var accounts []models.KaggleAccount
+	if err := database.DB.Order("username").Find(&accounts).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch Kaggle accounts"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"data": accounts})
+}
+
+// UpdateKaggleAccount handles PUT /api/v1/backends/kaggle/accounts/:id. A
+// key in the request replaces the stored one.
+func UpdateKaggleAccount(c *gin.Context) {
+	var account models.KaggleAccount
+	if err := database.DB.First(&account, c.Param("id")).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Kaggle account not found"})
+		return
+	}
+
+	var req KaggleAccountRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if req.Username != "" && req.Username != account.Username {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Kaggle accounts cannot be renamed, register a new account instead"})
+		return
+	}
+	if req.Key != "" && !secrets.Enabled() {
+		c.JSON(http.StatusServiceUnavailable, gin.H{"error": "SECRETS_ENCRYPTION_KEY must be set to store Kaggle accounts"})
+		return
+	}
+
+	if !applyKaggleAccountRequest(c, &account, req) {
+		return
+	}
+	if err := database.DB.Save(&account).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update Kaggle account"})
+		return
+	}
+
+	c.JSON(http.StatusOK, account)
+}
+
+// DeleteKaggleAccount handles DELETE /api/v1/backends/kaggle/accounts/:id.
+// No new jobs are scheduled on the account; running ones keep its
+// credentials until they finish.
+func DeleteKaggleAccount(c *gin.Context) {
+	var account models.KaggleAccount
+	if err := database.DB.First(&account, c.Param("id")).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Kaggle account not found"})
+		return
+	}
+
+	if err := database.DB.Delete(&account).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to delete Kaggle account"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Kaggle account deleted"})
+}
+
+// applyKaggleAccountRequest copies the set fields of req onto account,
+// encrypting the key. It responds and returns false on invalid input.
+func applyKaggleAccountRequest(c *gin.Context, account *models.KaggleAccount, req KaggleAccountRequest) bool {
+	if req.Enabled != nil {
+		account.Enabled = *req.Enabled
+	}
+	if req.WeeklyGPUHours != nil {
+		if *req.WeeklyGPUHours < 0 {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "weekly_gpu_hours cannot be negative"})
+			return false
+		}
+		account.WeeklyGPUHours = *req.WeeklyGPUHours
+	}
+	if req.MaxConcurrentKernels != nil {
+		if *req.MaxConcurrentKernels < 0 {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "max_concurrent_kernels cannot be negative"})
+			return false
+		}
+		account.MaxConcurrentKernels = *req.MaxConcurrentKernels
+	}
+	if req.Key != "" {
+		encrypted, err := secrets.Encrypt(req.Key)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to encrypt Kaggle key"})
+			return false
+		}
+		account.EncryptedKey = encrypted
+	}
+	return true
+}
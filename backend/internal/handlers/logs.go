@@ -6,6 +6,7 @@ import (
 	"strconv"
 	"time"
 
+	"finetune-studio/internal/logmetrics"
 	"finetune-studio/internal/models"
 	"finetune-studio/internal/services/logs"
 
@@ -150,6 +151,7 @@ func (h *LogHandler) CreateLogEntry(c *gin.Context) {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to save log"})
 		return
 	}
+	logmetrics.Process(entry.JobID, []models.LogEntry{entry})
 
 	c.JSON(http.StatusCreated, entry)
 }
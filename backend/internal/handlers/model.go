@@ -43,6 +43,14 @@ func (h *ModelHandler) ListModels(c *gin.Context) {
 		query = query.Where("status = ?", status)
 	}
 
+	if parentID := c.Query("parent_model_id"); parentID != "" {
+		query = query.Where("parent_model_id = ?", parentID)
+	}
+
+	if production := c.Query("production"); production != "" {
+		query = query.Where("production = ?", production == "true")
+	}
+
 	if dateFrom := c.Query("date_from"); dateFrom != "" {
 		query = query.Where("created_at >= ?", dateFrom)
 	}
@@ -122,10 +130,16 @@ func (h *ModelHandler) GetModel(c *gin.Context) {
 		json.Unmarshal(model.Files, &files)
 	}
 
+	// Models trained further from this one
+	var children []models.Model
+	database.DB.Select("id", "name", "status", "job_id", "created_at").
+		Where("parent_model_id = ?", model.ID).Order("created_at").Find(&children)
+
 	response := gin.H{
 		"model":          model,
 		"download_links": downloadLinks,
 		"files":          files,
+		"children":       children,
 	}
 
 	c.JSON(http.StatusOK, response)
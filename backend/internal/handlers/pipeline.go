@@ -0,0 +1,222 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"finetune-studio/internal/database"
+	"finetune-studio/internal/jobs"
+	"finetune-studio/internal/jobs/statemachine"
+	"finetune-studio/internal/models"
+	"finetune-studio/internal/pipelines"
+	"finetune-studio/internal/presets"
+	"finetune-studio/internal/sweeps"
+	"finetune-studio/internal/worker"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+type CreatePipelineRequest struct {
+	Name          string          `json:"name"`
+	DatasetID     uint            `json:"dataset_id" binding:"required"`
+	Configuration json.RawMessage `json:"configuration"` // Configuration of the training job
+	PresetID      *uint           `json:"preset_id"`
+	PresetVersion int             `json:"preset_version"`
+
+	HoldoutFraction float64 `json:"holdout_fraction"` // Defaults to 0.1
+	Seed            *int64  `json:"seed"`
+	Metric          string  `json:"metric"` // Evaluation metric, defaults to eval_loss
+	Goal            string  `json:"goal"`
+
+	jobs.Scheduling // Applied to the training job
+}
+
+// CreatePipeline handles POST /api/v1/pipelines. The training configuration
+// is validated up front so a pipeline doesn't fail after the split.
+func CreatePipeline(c *gin.Context) {
+	var req CreatePipelineRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	if req.HoldoutFraction == 0 {
+		req.HoldoutFraction = 0.1
+	}
+	if req.HoldoutFraction <= 0 || req.HoldoutFraction > 0.5 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "holdout_fraction must be greater than 0 and at most 0.5"})
+		return
+	}
+	if req.Metric == "" {
+		req.Metric = "eval_loss"
+	}
+	if req.Goal == "" {
+		req.Goal = sweeps.GoalMinimize
+	}
+	if req.Goal != sweeps.GoalMinimize && req.Goal != sweeps.GoalMaximize {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "goal must be minimize or maximize"})
+		return
+	}
+
+	var dataset models.Dataset
+	if err := database.DB.First(&dataset, req.DatasetID).Error; err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Dataset not found"})
+		return
+	}
+	if dataset.Type != "json" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Pipelines need a JSON dataset to split off the holdout set"})
+		return
+	}
+
+	configJSON := []byte(req.Configuration)
+	presetVersion := 0
+	if req.PresetID != nil {
+		var err error
+		configJSON, presetVersion, err = presets.JobConfig(database.DB, *req.PresetID, req.PresetVersion, req.Configuration)
+		if err != nil {
+			respondPresetError(c, err)
+			return
+		}
+	}
+	job, err := jobs.New(req.DatasetID, configJSON, worker.Pool.JobTimeout)
+	if err != nil {
+		respondConfigError(c, err)
+		return
+	}
+	if err := req.Scheduling.Apply(job); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	seed := time.Now().UnixNano()
+	if req.Seed != nil {
+		seed = *req.Seed
+	}
+
+	pipeline := models.Pipeline{
+		Name:            req.Name,
+		DatasetID:       dataset.ID,
+		PresetID:        req.PresetID,
+		PresetVersion:   presetVersion,
+		Configuration:   job.Configuration,
+		HoldoutFraction: req.HoldoutFraction,
+		Seed:            seed,
+		Metric:          req.Metric,
+		Goal:            req.Goal,
+		Priority:        job.Priority,
+		Submitter:       job.Submitter,
+		Project:         job.Project,
+	}
+	err = database.DB.Transaction(func(tx *gorm.DB) error {
+		if err := pipelines.Create(tx, &pipeline); err != nil {
+			return err
+		}
+		if pipeline.Name == "" {
+			pipeline.Name = fmt.Sprintf("Pipeline %d", pipeline.ID)
+			return tx.Model(&pipeline).Update("name", pipeline.Name).Error
+		}
+		return nil
+	})
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create pipeline"})
+		return
+	}
+
+	c.JSON(http.StatusCreated, pipeline)
+}
+
+// ListPipelines handles GET /api/v1/pipelines
+func ListPipelines(c *gin.Context) {
+	page, _ := strconv.Atoi(c.DefaultQuery("page", "1"))
+	limit, _ := strconv.Atoi(c.DefaultQuery("limit", "10"))
+	offset := (page - 1) * limit
+
+	query := database.DB.Model(&models.Pipeline{})
+	if status := c.Query("status"); status != "" {
+		query = query.Where("status = ?", status)
+	}
+
+	var total int64
+	query.Count(&total)
+
+	var pipelineList []models.Pipeline
+	if err := query.Offset(offset).Limit(limit).Order("created_at desc").Find(&pipelineList).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch pipelines"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"data":  pipelineList,
+		"total": total,
+		"page":  page,
+		"limit": limit,
+	})
+}
+
+// GetPipeline handles GET /api/v1/pipelines/:id and includes the steps
+func GetPipeline(c *gin.Context) {
+	var pipeline models.Pipeline
+	err := database.DB.Preload("Steps", func(db *gorm.DB) *gorm.DB { return db.Order("id") }).
+		First(&pipeline, c.Param("id")).Error
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Pipeline not found"})
+		return
+	}
+
+	c.JSON(http.StatusOK, pipeline)
+}
+
+// CancelPipeline handles DELETE /api/v1/pipelines/:id. The training job is
+// cancelled too when it is still running.
+func CancelPipeline(c *gin.Context) {
+	var pipeline models.Pipeline
+	if err := database.DB.First(&pipeline, c.Param("id")).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Pipeline not found"})
+		return
+	}
+	if pipelines.IsFinished(pipeline.Status) {
+		c.JSON(http.StatusConflict, gin.H{"error": fmt.Sprintf("Pipeline is already %s", pipeline.Status)})
+		return
+	}
+
+	if err := pipelines.Cancel(pipeline.ID); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to cancel pipeline"})
+		return
+	}
+
+	if pipeline.JobID != nil {
+		var job models.Job
+		if database.DB.First(&job, *pipeline.JobID).Error == nil &&
+			!statemachine.IsTerminal(statemachine.State(job.Status)) && job.Status != string(statemachine.Cancelling) {
+			worker.Pool.RequestCancel(&job, statemachine.ActorAPI, fmt.Sprintf("pipeline %d cancelled by user", pipeline.ID))
+		}
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Pipeline cancelled"})
+}
+
+// RetryPipeline handles POST /api/v1/pipelines/:id/retry and runs the failed
+// steps of a pipeline again, along with the steps skipped behind them
+func RetryPipeline(c *gin.Context) {
+	var pipeline models.Pipeline
+	if err := database.DB.First(&pipeline, c.Param("id")).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Pipeline not found"})
+		return
+	}
+
+	if err := pipelines.Retry(pipeline.ID); err != nil {
+		if errors.Is(err, pipelines.ErrNotRetryable) {
+			c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to retry pipeline"})
+		return
+	}
+
+	GetPipeline(c)
+}
@@ -0,0 +1,179 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"finetune-studio/internal/database"
+	"finetune-studio/internal/models"
+	"finetune-studio/internal/presets"
+
+	"github.com/gin-gonic/gin"
+)
+
+type PresetRequest struct {
+	Name          string          `json:"name" binding:"required"`
+	Description   string          `json:"description"`
+	Configuration json.RawMessage `json:"configuration" binding:"required"`
+}
+
+// CreatePreset handles POST /api/v1/presets
+func CreatePreset(c *gin.Context) {
+	var req PresetRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	var existing int64
+	database.DB.Model(&models.Preset{}).Where("name = ?", req.Name).Count(&existing)
+	if existing > 0 {
+		c.JSON(http.StatusConflict, gin.H{"error": "A preset with this name already exists"})
+		return
+	}
+
+	preset, err := presets.Create(req.Name, req.Description, req.Configuration)
+	if err != nil {
+		respondPresetError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusCreated, preset)
+}
+
+// ListPresets handles GET /api/v1/presets
+func ListPresets(c *gin.Context) {
+	var presetList []models.Preset
+	page, _ := strconv.Atoi(c.DefaultQuery("page", "1"))
+	limit, _ := strconv.Atoi(c.DefaultQuery("limit", "50"))
+	offset := (page - 1) * limit
+
+	query := database.DB.Model(&models.Preset{})
+	if search := c.Query("search"); search != "" {
+		query = query.Where("name ILIKE ?", "%"+search+"%")
+	}
+
+	var total int64
+	query.Count(&total)
+
+	if err := query.Offset(offset).Limit(limit).Order("name").Find(&presetList).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch presets"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"data":  presetList,
+		"total": total,
+		"page":  page,
+		"limit": limit,
+	})
+}
+
+// GetPreset handles GET /api/v1/presets/:id. The version query parameter
+// selects an older version.
+func GetPreset(c *gin.Context) {
+	var preset models.Preset
+	if err := database.DB.First(&preset, c.Param("id")).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Preset not found"})
+		return
+	}
+
+	if v := c.Query("version"); v != "" {
+		version, err := strconv.Atoi(v)
+		if err != nil || version < 1 {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "version must be a positive integer"})
+			return
+		}
+		snapshot, err := presets.Version(database.DB, preset.ID, version)
+		if err != nil {
+			respondPresetError(c, err)
+			return
+		}
+		preset.Version = snapshot.Version
+		preset.Description = snapshot.Description
+		preset.Configuration = snapshot.Configuration
+	}
+
+	c.JSON(http.StatusOK, preset)
+}
+
+// ListPresetVersions handles GET /api/v1/presets/:id/versions
+func ListPresetVersions(c *gin.Context) {
+	var preset models.Preset
+	if err := database.DB.First(&preset, c.Param("id")).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Preset not found"})
+		return
+	}
+
+	var versions []models.PresetVersion
+	if err := database.DB.Where("preset_id = ?", preset.ID).Order("version desc").Find(&versions).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch preset versions"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"preset_id": preset.ID,
+		"name":      preset.Name,
+		"versions":  versions,
+	})
+}
+
+// UpdatePreset handles PUT /api/v1/presets/:id and stores a new version
+func UpdatePreset(c *gin.Context) {
+	var preset models.Preset
+	if err := database.DB.First(&preset, c.Param("id")).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Preset not found"})
+		return
+	}
+
+	var req PresetRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if req.Name != preset.Name {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Presets cannot be renamed, create a new preset instead"})
+		return
+	}
+
+	if err := presets.Update(&preset, req.Description, req.Configuration); err != nil {
+		respondPresetError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, preset)
+}
+
+// DeletePreset handles DELETE /api/v1/presets/:id. Versions are kept so
+// jobs created from the preset stay reproducible.
+func DeletePreset(c *gin.Context) {
+	var preset models.Preset
+	if err := database.DB.First(&preset, c.Param("id")).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Preset not found"})
+		return
+	}
+
+	if err := database.DB.Delete(&preset).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to delete preset"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Preset deleted"})
+}
+
+// respondPresetError maps preset lookup and validation errors to responses
+func respondPresetError(c *gin.Context, err error) {
+	switch {
+	case errors.Is(err, presets.ErrNotFound):
+		c.JSON(http.StatusNotFound, gin.H{"error": "Preset not found"})
+	case errors.Is(err, presets.ErrVersionNotFound):
+		c.JSON(http.StatusNotFound, gin.H{"error": "Preset version not found"})
+	case strings.Contains(err.Error(), "idx_presets_name"):
+		c.JSON(http.StatusConflict, gin.H{"error": "A preset with this name already exists"})
+	default:
+		respondConfigError(c, err)
+	}
+}
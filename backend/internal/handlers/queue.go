@@ -0,0 +1,22 @@
+package handlers
+
+import (
+	"net/http"
+
+	"finetune-studio/internal/queue"
+	"finetune-studio/internal/worker"
+
+	"github.com/gin-gonic/gin"
+)
+
+// GetQueue handles GET /api/v1/queue and lists the jobs waiting to start in
+// the order workers will claim them, with an estimated start time
+func GetQueue(c *gin.Context) {
+	snapshot, err := queue.Waiting(worker.Pool.Workers)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to read the job queue"})
+		return
+	}
+
+	c.JSON(http.StatusOK, snapshot)
+}
@@ -0,0 +1,240 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"finetune-studio/internal/database"
+	"finetune-studio/internal/models"
+	"finetune-studio/internal/schedules"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/datatypes"
+)
+
+type ScheduleRequest struct {
+	Name          string          `json:"name" binding:"required"`
+	Cron          string          `json:"cron" binding:"required"`
+	Timezone      string          `json:"timezone"`
+	PresetID      uint            `json:"preset_id" binding:"required"`
+	PresetVersion int             `json:"preset_version"` // 0 follows the latest version
+	DatasetName   string          `json:"dataset_name" binding:"required"`
+	Configuration json.RawMessage `json:"configuration"`
+	Priority      int             `json:"priority"`
+	Submitter     string          `json:"submitter"`
+	Project       string          `json:"project"`
+	SkipUnchanged *bool           `json:"skip_unchanged"` // Defaults to true
+	Paused        bool            `json:"paused"`
+}
+
+// apply copies the request onto a schedule and validates it
+func (req ScheduleRequest) apply(schedule *models.Schedule) error {
+	schedule.Name = req.Name
+	schedule.Cron = req.Cron
+	schedule.Timezone = req.Timezone
+	schedule.PresetID = req.PresetID
+	schedule.PresetVersion = req.PresetVersion
+	schedule.DatasetName = req.DatasetName
+	schedule.Configuration = datatypes.JSON(req.Configuration)
+	schedule.Priority = req.Priority
+	schedule.Submitter = req.Submitter
+	schedule.Project = req.Project
+	schedule.SkipUnchanged = req.SkipUnchanged == nil || *req.SkipUnchanged
+	schedule.Paused = req.Paused
+	return schedules.Prepare(schedule, time.Now())
+}
+
+// CreateSchedule handles POST /api/v1/schedules
+func CreateSchedule(c *gin.Context) {
+	var req ScheduleRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	var schedule models.Schedule
+	if err := req.apply(&schedule); err != nil {
+		respondPresetError(c, err)
+		return
+	}
+
+	var existing int64
+	database.DB.Model(&models.Schedule{}).Where("name = ?", schedule.Name).Count(&existing)
+	if existing > 0 {
+		c.JSON(http.StatusConflict, gin.H{"error": "A schedule with this name already exists"})
+		return
+	}
+
+	if err := database.DB.Create(&schedule).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create schedule"})
+		return
+	}
+
+	c.JSON(http.StatusCreated, schedule)
+}
+
+// ListSchedules handles GET /api/v1/schedules
+func ListSchedules(c *gin.Context) {
+	var scheduleList []models.Schedule
+	if err := database.DB.Order("name").Find(&scheduleList).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch schedules"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"data": scheduleList})
+}
+
+// GetSchedule handles GET /api/v1/schedules/:id
+func GetSchedule(c *gin.Context) {
+	var schedule models.Schedule
+	if err := database.DB.First(&schedule, c.Param("id")).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Schedule not found"})
+		return
+	}
+
+	c.JSON(http.StatusOK, schedule)
+}
+
+// UpdateSchedule handles PUT /api/v1/schedules/:id. The next run is
+// computed again from the new cron expression.
+func UpdateSchedule(c *gin.Context) {
+	var schedule models.Schedule
+	if err := database.DB.First(&schedule, c.Param("id")).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Schedule not found"})
+		return
+	}
+
+	var req ScheduleRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if err := req.apply(&schedule); err != nil {
+		respondPresetError(c, err)
+		return
+	}
+
+	if err := database.DB.Save(&schedule).Error; err != nil {
+		respondScheduleSaveError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, schedule)
+}
+
+// DeleteSchedule handles DELETE /api/v1/schedules/:id. Jobs it created are
+// left untouched.
+func DeleteSchedule(c *gin.Context) {
+	var schedule models.Schedule
+	if err := database.DB.First(&schedule, c.Param("id")).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Schedule not found"})
+		return
+	}
+
+	if err := database.DB.Delete(&schedule).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to delete schedule"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Schedule deleted"})
+}
+
+// PauseSchedule handles POST /api/v1/schedules/:id/pause
+func PauseSchedule(c *gin.Context) {
+	setSchedulePaused(c, true)
+}
+
+// ResumeSchedule handles POST /api/v1/schedules/:id/resume. Firings missed
+// while paused are not caught up.
+func ResumeSchedule(c *gin.Context) {
+	setSchedulePaused(c, false)
+}
+
+func setSchedulePaused(c *gin.Context, paused bool) {
+	var schedule models.Schedule
+	if err := database.DB.First(&schedule, c.Param("id")).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Schedule not found"})
+		return
+	}
+
+	schedule.Paused = paused
+	schedule.NextRunAt = nil
+	if !paused {
+		if err := schedules.Prepare(&schedule, time.Now()); err != nil {
+			respondPresetError(c, err)
+			return
+		}
+	}
+	if err := database.DB.Model(&schedule).Select("paused", "next_run_at").Updates(&schedule).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update schedule"})
+		return
+	}
+
+	c.JSON(http.StatusOK, schedule)
+}
+
+// ListScheduleRuns handles GET /api/v1/schedules/:id/runs, newest first
+func ListScheduleRuns(c *gin.Context) {
+	var schedule models.Schedule
+	if err := database.DB.First(&schedule, c.Param("id")).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Schedule not found"})
+		return
+	}
+
+	page, _ := strconv.Atoi(c.DefaultQuery("page", "1"))
+	limit, _ := strconv.Atoi(c.DefaultQuery("limit", "20"))
+	offset := (page - 1) * limit
+
+	query := database.DB.Model(&models.ScheduleRun{}).Where("schedule_id = ?", schedule.ID)
+	if status := c.Query("status"); status != "" {
+		query = query.Where("status = ?", status)
+	}
+
+	var total int64
+	query.Count(&total)
+
+	var runs []models.ScheduleRun
+	if err := query.Order("id DESC").Offset(offset).Limit(limit).Find(&runs).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch schedule runs"})
+		return
+	}
+
+	// Attach the current status of the jobs created
+	var jobIDs []uint
+	for _, run := range runs {
+		if run.JobID != nil {
+			jobIDs = append(jobIDs, *run.JobID)
+		}
+	}
+	if len(jobIDs) > 0 {
+		var jobList []models.Job
+		database.DB.Unscoped().Select("id", "status").Where("id IN ?", jobIDs).Find(&jobList)
+		statuses := make(map[uint]string, len(jobList))
+		for _, job := range jobList {
+			statuses[job.ID] = job.Status
+		}
+		for i := range runs {
+			if runs[i].JobID != nil {
+				runs[i].JobStatus = statuses[*runs[i].JobID]
+			}
+		}
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"data":  runs,
+		"total": total,
+		"page":  page,
+		"limit": limit,
+	})
+}
+
+func respondScheduleSaveError(c *gin.Context, err error) {
+	if strings.Contains(err.Error(), "idx_schedules_name") {
+		c.JSON(http.StatusConflict, gin.H{"error": "A schedule with this name already exists"})
+		return
+	}
+	c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update schedule"})
+}
@@ -0,0 +1,387 @@
+package handlers
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"finetune-studio/internal/database"
+	"finetune-studio/internal/events"
+	"finetune-studio/internal/jobs/statemachine"
+	"finetune-studio/internal/models"
+
+	"github.com/gin-gonic/gin"
+	"github.com/gorilla/websocket"
+)
+
+const (
+	// streamRefreshInterval is how often streams re-read their jobs from the
+	// database, picking up changes made by other replicas, and send a
+	// heartbeat
+	streamRefreshInterval = 15 * time.Second
+
+	// maxStreamJobs bounds the jobs a single stream subscribes to
+	maxStreamJobs = 100
+
+	streamWriteTimeout = 10 * time.Second
+)
+
+type StreamHandler struct {
+	upgrader websocket.Upgrader
+}
+
+// NewStreamHandler accepts WebSocket connections from the same origin or from
+// the allowed CORS origins ("*" allows any)
+func NewStreamHandler(allowedOrigins []string) *StreamHandler {
+	return &StreamHandler{
+		upgrader: websocket.Upgrader{
+			ReadBufferSize:  1024,
+			WriteBufferSize: 1024,
+			CheckOrigin: func(r *http.Request) bool {
+				origin := r.Header.Get("Origin")
+				if origin == "" {
+					return true
+				}
+				for _, allowed := range allowedOrigins {
+					if allowed = strings.TrimSpace(allowed); allowed == "*" || allowed == origin {
+						return true
+					}
+				}
+				u, err := url.Parse(origin)
+				return err == nil && u.Host == r.Host
+			},
+		},
+	}
+}
+
+// streamRequest is a message of a WebSocket client
+type streamRequest struct {
+	Action string `json:"action"` // subscribe or unsubscribe
+	JobIDs []uint `json:"job_ids"`
+}
+
+// StreamJobEvents handles GET /api/v1/jobs/:id/events/stream (SSE). It sends a
+// snapshot of the job, then its status and metric changes as they happen,
+// and an end event once the job reached a terminal state.
+func (h *StreamHandler) StreamJobEvents(c *gin.Context) {
+	var job models.Job
+	if err := database.DB.First(&job, c.Param("id")).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Job not found"})
+		return
+	}
+
+	sub := events.Default.Subscribe(job.ID)
+	defer sub.Close()
+	serveSSE(c, sub, true)
+}
+
+// Stream handles GET /api/v1/stream, carrying the events of every job the
+// client subscribed to. Plain requests get SSE for the jobs in ?jobs=1,2,3;
+// WebSocket clients may also send {"action": "subscribe"|"unsubscribe",
+// "job_ids": [...]} messages to change their subscriptions.
+func (h *StreamHandler) Stream(c *gin.Context) {
+	jobIDs, err := parseJobIDs(c.Query("jobs"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	if websocket.IsWebSocketUpgrade(c.Request) {
+		h.serveWebSocket(c, jobIDs)
+		return
+	}
+
+	if len(jobIDs) == 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "jobs is required, e.g. ?jobs=1,2"})
+		return
+	}
+	sub := events.Default.Subscribe(jobIDs...)
+	defer sub.Close()
+	serveSSE(c, sub, false)
+}
+
+// serveSSE writes the events of a subscription as server-sent events named
+// after the event type. With endOnTerminal, the stream ends once every
+// subscribed job reached a terminal state.
+func serveSSE(c *gin.Context, sub *events.Subscription, endOnTerminal bool) {
+	c.Header("Content-Type", "text/event-stream")
+	c.Header("Cache-Control", "no-cache")
+	c.Header("Connection", "keep-alive")
+	c.Header("X-Accel-Buffering", "no")
+
+	state := streamState{}
+	send := func(list []events.Event) bool {
+		for _, event := range list {
+			data, _ := json.Marshal(event)
+			fmt.Fprintf(c.Writer, "event: %s\ndata: %s\n\n", event.Type, data)
+		}
+		if endOnTerminal && state.allTerminal() {
+			fmt.Fprintf(c.Writer, "event: end\ndata: {}\n\n")
+			c.Writer.Flush()
+			return false
+		}
+		c.Writer.Flush()
+		return true
+	}
+
+	initial, err := state.refresh(sub.Jobs())
+	if err != nil {
+		fmt.Fprintf(c.Writer, "event: error\ndata: Failed to load jobs\n\n")
+		c.Writer.Flush()
+		return
+	}
+	if !send(initial) {
+		return
+	}
+
+	ticker := time.NewTicker(streamRefreshInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case event, ok := <-sub.C:
+			if !ok {
+				// Dropped for falling behind; the client reconnects and
+				// starts from a new snapshot
+				return
+			}
+			state.record(event)
+			if !send([]events.Event{event}) {
+				return
+			}
+
+		case <-ticker.C:
+			changed, err := state.refresh(sub.Jobs())
+			if err != nil || len(changed) == 0 {
+				fmt.Fprintf(c.Writer, ": heartbeat\n\n")
+				c.Writer.Flush()
+				continue
+			}
+			if !send(changed) {
+				return
+			}
+
+		case <-c.Request.Context().Done():
+			return
+		}
+	}
+}
+
+// serveWebSocket sends the events of the subscribed jobs as JSON messages
+// and applies the subscription requests of the client
+func (h *StreamHandler) serveWebSocket(c *gin.Context, jobIDs []uint) {
+	conn, err := h.upgrader.Upgrade(c.Writer, c.Request, nil)
+	if err != nil {
+		// The upgrader already replied
+		return
+	}
+	defer conn.Close()
+
+	sub := events.Default.Subscribe(jobIDs...)
+	defer sub.Close()
+
+	// Only this goroutine writes to the connection; the reader hands requests
+	// over and closes readerDone when the client goes away
+	requests := make(chan streamRequest)
+	readerDone := make(chan struct{})
+	stopped := make(chan struct{})
+	defer close(stopped)
+	go func() {
+		defer close(readerDone)
+		conn.SetReadLimit(4096)
+		conn.SetReadDeadline(time.Now().Add(2 * streamRefreshInterval))
+		conn.SetPongHandler(func(string) error {
+			return conn.SetReadDeadline(time.Now().Add(2 * streamRefreshInterval))
+		})
+		for {
+			var req streamRequest
+			if err := conn.ReadJSON(&req); err != nil {
+				var syntaxErr *json.SyntaxError
+				var typeErr *json.UnmarshalTypeError
+				if errors.As(err, &syntaxErr) || errors.As(err, &typeErr) {
+					req = streamRequest{Action: "invalid"}
+				} else {
+					return
+				}
+			}
+			select {
+			case requests <- req:
+			case <-stopped:
+				return
+			}
+		}
+	}()
+
+	state := streamState{}
+	write := func(v interface{}) bool {
+		conn.SetWriteDeadline(time.Now().Add(streamWriteTimeout))
+		return conn.WriteJSON(v) == nil
+	}
+	send := func(list []events.Event) bool {
+		for _, event := range list {
+			if !write(event) {
+				return false
+			}
+		}
+		return true
+	}
+
+	initial, err := state.refresh(jobIDs)
+	if err != nil || !send(initial) {
+		return
+	}
+
+	ticker := time.NewTicker(streamRefreshInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case req := <-requests:
+			switch req.Action {
+			case "subscribe":
+				if len(sub.Jobs())+len(req.JobIDs) > maxStreamJobs {
+					if !write(gin.H{"type": "error", "error": fmt.Sprintf("at most %d jobs per stream", maxStreamJobs)}) {
+						return
+					}
+					continue
+				}
+				sub.Add(req.JobIDs...)
+				added, err := state.refresh(req.JobIDs)
+				if err != nil {
+					added = nil
+				}
+				if !send(added) {
+					return
+				}
+			case "unsubscribe":
+				sub.Remove(req.JobIDs...)
+				state.forget(req.JobIDs)
+			default:
+				if !write(gin.H{"type": "error", "error": `action must be "subscribe" or "unsubscribe"`}) {
+					return
+				}
+			}
+
+		case event, ok := <-sub.C:
+			if !ok {
+				conn.WriteControl(websocket.CloseMessage,
+					websocket.FormatCloseMessage(websocket.CloseTryAgainLater, "client fell behind"),
+					time.Now().Add(streamWriteTimeout))
+				return
+			}
+			state.record(event)
+			if !send([]events.Event{event}) {
+				return
+			}
+
+		case <-ticker.C:
+			if changed, err := state.refresh(sub.Jobs()); err == nil && !send(changed) {
+				return
+			}
+			if err := conn.WriteControl(websocket.PingMessage, nil, time.Now().Add(streamWriteTimeout)); err != nil {
+				return
+			}
+
+		case <-readerDone:
+			return
+		}
+	}
+}
+
+// streamState is what a stream client was last sent for each job, so
+// refreshes from the database only send the jobs that changed
+type streamState map[uint]events.Event
+
+// refresh loads jobs and returns snapshots of the ones whose status or
+// metrics differ from what the client was sent. Unknown jobs are skipped.
+func (s streamState) refresh(jobIDs []uint) ([]events.Event, error) {
+	if len(jobIDs) == 0 {
+		return nil, nil
+	}
+	var jobList []models.Job
+	if err := database.DB.Select("id", "status", "metrics", "updated_at").Find(&jobList, jobIDs).Error; err != nil {
+		return nil, err
+	}
+
+	var changed []events.Event
+	for _, job := range jobList {
+		event := events.Event{
+			Type:   events.TypeSnapshot,
+			JobID:  job.ID,
+			Status: job.Status,
+			Time:   job.UpdatedAt,
+		}
+		if len(job.Metrics) > 0 {
+			event.Metrics = json.RawMessage(job.Metrics)
+		}
+		if s.record(event) {
+			changed = append(changed, event)
+		}
+	}
+	return changed, nil
+}
+
+// record notes an event as sent and reports whether it told the client
+// something new
+func (s streamState) record(event events.Event) bool {
+	last, seen := s[event.JobID]
+	next := last
+	if event.Status != "" {
+		next.Status = event.Status
+	}
+	if event.Metrics != nil {
+		next.Metrics = canonicalJSON(event.Metrics)
+	}
+	s[event.JobID] = next
+	return !seen || next.Status != last.Status || !bytes.Equal(next.Metrics, last.Metrics)
+}
+
+func (s streamState) forget(jobIDs []uint) {
+	for _, id := range jobIDs {
+		delete(s, id)
+	}
+}
+
+// allTerminal reports whether every known job reached a terminal state
+func (s streamState) allTerminal() bool {
+	for _, last := range s {
+		if !statemachine.IsTerminal(statemachine.State(last.Status)) {
+			return false
+		}
+	}
+	return len(s) > 0
+}
+
+// canonicalJSON re-encodes a document so the metrics stored by Postgres and
+// the ones published by the worker compare equal
+func canonicalJSON(raw json.RawMessage) json.RawMessage {
+	var v interface{}
+	if err := json.Unmarshal(raw, &v); err != nil {
+		return raw
+	}
+	out, _ := json.Marshal(v)
+	return out
+}
+
+// parseJobIDs parses a comma separated list of job ids
+func parseJobIDs(raw string) ([]uint, error) {
+	var ids []uint
+	for _, part := range strings.Split(raw, ",") {
+		if part = strings.TrimSpace(part); part == "" {
+			continue
+		}
+		id, err := strconv.ParseUint(part, 10, 32)
+		if err != nil {
+			return nil, fmt.Errorf("invalid job id %q", part)
+		}
+		ids = append(ids, uint(id))
+	}
+	if len(ids) > maxStreamJobs {
+		return nil, fmt.Errorf("at most %d jobs per stream", maxStreamJobs)
+	}
+	return ids, nil
+}
@@ -0,0 +1,319 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"finetune-studio/internal/database"
+	"finetune-studio/internal/jobs"
+	"finetune-studio/internal/jobs/statemachine"
+	"finetune-studio/internal/jobs/trainingconfig"
+	"finetune-studio/internal/models"
+	"finetune-studio/internal/presets"
+	"finetune-studio/internal/sweeps"
+	"finetune-studio/internal/worker"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/datatypes"
+	"gorm.io/gorm"
+)
+
+type CreateSweepRequest struct {
+	Name          string          `json:"name"`
+	DatasetID     uint            `json:"dataset_id" binding:"required"`
+	Configuration json.RawMessage `json:"configuration"` // Base configuration shared by every trial
+	PresetID      *uint           `json:"preset_id"`
+	PresetVersion int             `json:"preset_version"`
+
+	Strategy       string       `json:"strategy"` // grid (default), random
+	SearchSpace    sweeps.Space `json:"search_space" binding:"required"`
+	NumTrials      int          `json:"num_trials"` // Random strategy only
+	Seed           *int64       `json:"seed"`       // Random strategy only
+	MaxConcurrency int          `json:"max_concurrency"`
+	Metric         string       `json:"metric"`
+	Goal           string       `json:"goal"`
+
+	jobs.Scheduling // Applied to every trial
+}
+
+// CreateSweep handles POST /api/v1/sweeps
+func CreateSweep(c *gin.Context) {
+	var req CreateSweepRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	if req.Strategy == "" {
+		req.Strategy = sweeps.StrategyGrid
+	}
+	if req.MaxConcurrency == 0 {
+		req.MaxConcurrency = 2
+	}
+	if req.MaxConcurrency < 1 || req.MaxConcurrency > 20 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "max_concurrency must be between 1 and 20"})
+		return
+	}
+	if req.Metric == "" {
+		req.Metric = "loss"
+	}
+	if req.Goal == "" {
+		req.Goal = sweeps.GoalMinimize
+	}
+	if req.Goal != sweeps.GoalMinimize && req.Goal != sweeps.GoalMaximize {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "goal must be minimize or maximize"})
+		return
+	}
+
+	var dataset models.Dataset
+	if err := database.DB.First(&dataset, req.DatasetID).Error; err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Dataset not found"})
+		return
+	}
+
+	baseConfig := []byte(req.Configuration)
+	presetVersion := 0
+	if req.PresetID != nil {
+		var err error
+		baseConfig, presetVersion, err = presets.JobConfig(database.DB, *req.PresetID, req.PresetVersion, req.Configuration)
+		if err != nil {
+			respondPresetError(c, err)
+			return
+		}
+	}
+	baseConfig, _, err := trainingconfig.Resolve(baseConfig)
+	if err != nil {
+		respondConfigError(c, err)
+		return
+	}
+
+	seed := time.Now().UnixNano()
+	if req.Seed != nil {
+		seed = *req.Seed
+	}
+	trials, err := req.SearchSpace.Expand(req.Strategy, req.NumTrials, seed)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	// Build every trial first so an invalid point rejects the whole sweep
+	children := make([]*models.Job, len(trials))
+	for i, trial := range trials {
+		merged, err := trainingconfig.Merge(baseConfig, trial.JSON())
+		if err == nil {
+			children[i], err = jobs.New(req.DatasetID, merged, worker.Pool.JobTimeout)
+		}
+		if err == nil {
+			err = req.Scheduling.Apply(children[i])
+		}
+		if err != nil {
+			var validationErr *trainingconfig.ValidationError
+			if errors.As(err, &validationErr) {
+				c.JSON(http.StatusBadRequest, gin.H{
+					"error":  fmt.Sprintf("Trial %d has an invalid training configuration", i+1),
+					"trial":  trial,
+					"fields": validationErr.Fields,
+				})
+				return
+			}
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		children[i].PresetID = req.PresetID
+		children[i].PresetVersion = presetVersion
+		children[i].SweepParams = datatypes.JSON(trial.JSON())
+	}
+
+	spaceJSON, _ := json.Marshal(req.SearchSpace)
+	sweep := models.Sweep{
+		Name:              req.Name,
+		DatasetID:         req.DatasetID,
+		Strategy:          req.Strategy,
+		SearchSpace:       datatypes.JSON(spaceJSON),
+		BaseConfiguration: datatypes.JSON(baseConfig),
+		MaxConcurrency:    req.MaxConcurrency,
+		Metric:            req.Metric,
+		Goal:              req.Goal,
+	}
+
+	err = database.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Create(&sweep).Error; err != nil {
+			return err
+		}
+		if sweep.Name == "" {
+			sweep.Name = fmt.Sprintf("Sweep %d", sweep.ID)
+			if err := tx.Model(&sweep).Update("name", sweep.Name).Error; err != nil {
+				return err
+			}
+		}
+		for i, child := range children {
+			child.SweepID = &sweep.ID
+			reason := fmt.Sprintf("trial %d/%d of sweep %d", i+1, len(children), sweep.ID)
+			if err := jobs.Create(tx, child, statemachine.ActorAPI, reason); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create sweep"})
+		return
+	}
+
+	worker.Pool.Notify()
+
+	sweep.Jobs = make([]models.Job, len(children))
+	for i, child := range children {
+		sweep.Jobs[i] = *child
+	}
+	c.JSON(http.StatusCreated, sweep)
+}
+
+// ListSweeps handles GET /api/v1/sweeps
+func ListSweeps(c *gin.Context) {
+	var sweepList []models.Sweep
+	page, _ := strconv.Atoi(c.DefaultQuery("page", "1"))
+	limit, _ := strconv.Atoi(c.DefaultQuery("limit", "10"))
+	offset := (page - 1) * limit
+
+	var total int64
+	database.DB.Model(&models.Sweep{}).Count(&total)
+
+	if err := database.DB.Preload("Dataset").Offset(offset).Limit(limit).Order("created_at desc").Find(&sweepList).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch sweeps"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"data":  sweepList,
+		"total": total,
+		"page":  page,
+		"limit": limit,
+	})
+}
+
+// GetSweep handles GET /api/v1/sweeps/:id
+func GetSweep(c *gin.Context) {
+	var sweep models.Sweep
+	err := database.DB.Preload("Dataset").
+		Preload("Jobs", func(db *gorm.DB) *gorm.DB { return db.Order("id") }).
+		First(&sweep, c.Param("id")).Error
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Sweep not found"})
+		return
+	}
+
+	counts := make(map[string]int)
+	for _, job := range sweep.Jobs {
+		counts[job.Status]++
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"sweep":         sweep,
+		"status":        sweepStatus(sweep.Jobs),
+		"status_counts": counts,
+	})
+}
+
+// GetSweepSummary handles GET /api/v1/sweeps/:id/summary and ranks the
+// trials by the sweep metric, or by the metric and goal query parameters
+func GetSweepSummary(c *gin.Context) {
+	var sweep models.Sweep
+	err := database.DB.Preload("Jobs", func(db *gorm.DB) *gorm.DB { return db.Order("id") }).
+		First(&sweep, c.Param("id")).Error
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Sweep not found"})
+		return
+	}
+
+	metric := c.DefaultQuery("metric", sweep.Metric)
+	goal := c.DefaultQuery("goal", sweep.Goal)
+	if goal != sweeps.GoalMinimize && goal != sweeps.GoalMaximize {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "goal must be minimize or maximize"})
+		return
+	}
+
+	jobIDs := make([]uint, len(sweep.Jobs))
+	for i, job := range sweep.Jobs {
+		jobIDs[i] = job.ID
+	}
+	var trialModels []models.Model
+	database.DB.Where("job_id IN ?", jobIDs).Find(&trialModels)
+	modelsByJob := make(map[uint]models.Model)
+	for _, model := range trialModels {
+		modelsByJob[*model.JobID] = model
+	}
+
+	results := make([]sweeps.Result, len(sweep.Jobs))
+	for i, job := range sweep.Jobs {
+		result := sweeps.Result{JobID: job.ID, Status: job.Status}
+		json.Unmarshal(job.SweepParams, &result.Params)
+
+		var trainingMetrics []byte
+		if model, ok := modelsByJob[job.ID]; ok {
+			modelID := model.ID
+			result.ModelID = &modelID
+			trainingMetrics = model.TrainingMetrics
+		}
+		if v, ok := sweeps.MetricValue(metric, trainingMetrics, job.Metrics); ok {
+			result.Value = &v
+		}
+		results[i] = result
+	}
+	sweeps.Rank(results, goal)
+
+	response := gin.H{
+		"sweep_id": sweep.ID,
+		"status":   sweepStatus(sweep.Jobs),
+		"metric":   metric,
+		"goal":     goal,
+		"trials":   results,
+	}
+	if len(results) > 0 && results[0].Rank == 1 {
+		response["best"] = results[0]
+	}
+	c.JSON(http.StatusOK, response)
+}
+
+// CancelSweep handles DELETE /api/v1/sweeps/:id and cancels every
+// unfinished trial
+func CancelSweep(c *gin.Context) {
+	var sweep models.Sweep
+	if err := database.DB.Preload("Jobs").First(&sweep, c.Param("id")).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Sweep not found"})
+		return
+	}
+
+	cancelled := 0
+	for i := range sweep.Jobs {
+		job := &sweep.Jobs[i]
+		if statemachine.IsTerminal(statemachine.State(job.Status)) || job.Status == string(statemachine.Cancelling) {
+			continue
+		}
+		reason := fmt.Sprintf("sweep %d cancelled by user", sweep.ID)
+		if err := worker.Pool.RequestCancel(job, statemachine.ActorAPI, reason); err == nil {
+			cancelled++
+		}
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"message":   "Sweep cancelled",
+		"cancelled": cancelled,
+		"status":    sweepStatus(sweep.Jobs),
+	})
+}
+
+// sweepStatus summarises the trials: running while any trial is unfinished
+func sweepStatus(trials []models.Job) string {
+	for _, job := range trials {
+		if !statemachine.IsTerminal(statemachine.State(job.Status)) {
+			return "running"
+		}
+	}
+	return "completed"
+}
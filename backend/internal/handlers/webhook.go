@@ -0,0 +1,222 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"finetune-studio/internal/database"
+	"finetune-studio/internal/models"
+	"finetune-studio/internal/secrets"
+	"finetune-studio/internal/webhooks"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/datatypes"
+)
+
+type WebhookRequest struct {
+	URL         string   `json:"url"`
+	Description *string  `json:"description"`
+	Secret      string   `json:"secret"` // Generated on creation when empty
+	Events      []string `json:"events"` // Event types or "job.*" patterns; empty subscribes to everything
+	Enabled     *bool    `json:"enabled"`
+}
+
+// CreateWebhook handles POST /api/v1/webhooks. The signing secret is only
+// returned by this call.
+func CreateWebhook(c *gin.Context) {
+	if !secrets.Enabled() {
+		c.JSON(http.StatusServiceUnavailable, gin.H{"error": "SECRETS_ENCRYPTION_KEY must be set to store webhook secrets"})
+		return
+	}
+
+	var req WebhookRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if req.Secret == "" {
+		secret, err := webhooks.NewSecret()
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to generate webhook secret"})
+			return
+		}
+		req.Secret = secret
+	}
+
+	webhook := models.Webhook{Enabled: true, Events: datatypes.JSON([]byte("[]"))}
+	if !applyWebhookRequest(c, &webhook, req) {
+		return
+	}
+
+	if err := database.DB.Create(&webhook).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to save webhook"})
+		return
+	}
+
+	c.JSON(http.StatusCreated, gin.H{"webhook": webhook, "secret": req.Secret})
+}
+
+// ListWebhooks handles GET /api/v1/webhooks
+func ListWebhooks(c *gin.Context) {
+	var webhookList []models.Webhook
+	if err := database.DB.Order("id").Find(&webhookList).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch webhooks"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"data": webhookList, "event_types": webhooks.EventTypes()})
+}
+
+// GetWebhook handles GET /api/v1/webhooks/:id
+func GetWebhook(c *gin.Context) {
+	var webhook models.Webhook
+	if err := database.DB.First(&webhook, c.Param("id")).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Webhook not found"})
+		return
+	}
+
+	c.JSON(http.StatusOK, webhook)
+}
+
+// UpdateWebhook handles PUT /api/v1/webhooks/:id. A secret in the request
+// replaces the stored one.
+func UpdateWebhook(c *gin.Context) {
+	var webhook models.Webhook
+	if err := database.DB.First(&webhook, c.Param("id")).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Webhook not found"})
+		return
+	}
+
+	var req WebhookRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if req.URL == "" {
+		req.URL = webhook.URL
+	}
+	if req.Events == nil {
+		json.Unmarshal(webhook.Events, &req.Events)
+	}
+	if req.Secret != "" && !secrets.Enabled() {
+		c.JSON(http.StatusServiceUnavailable, gin.H{"error": "SECRETS_ENCRYPTION_KEY must be set to store webhook secrets"})
+		return
+	}
+
+	if !applyWebhookRequest(c, &webhook, req) {
+		return
+	}
+	if err := database.DB.Save(&webhook).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update webhook"})
+		return
+	}
+
+	c.JSON(http.StatusOK, webhook)
+}
+
+// DeleteWebhook handles DELETE /api/v1/webhooks/:id. Pending deliveries are
+// not sent.
+func DeleteWebhook(c *gin.Context) {
+	var webhook models.Webhook
+	if err := database.DB.First(&webhook, c.Param("id")).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Webhook not found"})
+		return
+	}
+
+	if err := database.DB.Delete(&webhook).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to delete webhook"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Webhook deleted"})
+}
+
+// ListWebhookDeliveries handles GET /api/v1/webhooks/:id/deliveries, newest first
+func ListWebhookDeliveries(c *gin.Context) {
+	var webhook models.Webhook
+	if err := database.DB.First(&webhook, c.Param("id")).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Webhook not found"})
+		return
+	}
+
+	page, _ := strconv.Atoi(c.DefaultQuery("page", "1"))
+	limit, _ := strconv.Atoi(c.DefaultQuery("limit", "20"))
+	offset := (page - 1) * limit
+
+	query := database.DB.Model(&models.WebhookDelivery{}).Where("webhook_id = ?", webhook.ID)
+	if status := c.Query("status"); status != "" {
+		query = query.Where("status = ?", status)
+	}
+	if eventType := c.Query("event_type"); eventType != "" {
+		query = query.Where("event_type = ?", eventType)
+	}
+
+	var total int64
+	query.Count(&total)
+
+	var deliveries []models.WebhookDelivery
+	if err := query.Order("id DESC").Offset(offset).Limit(limit).Find(&deliveries).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch deliveries"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"data":  deliveries,
+		"total": total,
+		"page":  page,
+		"limit": limit,
+	})
+}
+
+// RedeliverWebhookDelivery handles POST
+// /api/v1/webhooks/:id/deliveries/:delivery_id/redeliver
+func RedeliverWebhookDelivery(c *gin.Context) {
+	var delivery models.WebhookDelivery
+	if err := database.DB.Where("webhook_id = ?", c.Param("id")).First(&delivery, c.Param("delivery_id")).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Delivery not found"})
+		return
+	}
+
+	if err := webhooks.Redeliver(delivery.ID); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to queue delivery"})
+		return
+	}
+
+	c.JSON(http.StatusAccepted, gin.H{"message": "Delivery queued"})
+}
+
+// applyWebhookRequest validates req and copies it onto webhook, encrypting
+// the secret. It responds and returns false on invalid input.
+func applyWebhookRequest(c *gin.Context, webhook *models.Webhook, req WebhookRequest) bool {
+	req.URL = strings.TrimSpace(req.URL)
+	if err := webhooks.ValidateURL(req.URL); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return false
+	}
+	if err := webhooks.ValidateFilter(req.Events); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error(), "event_types": webhooks.EventTypes()})
+		return false
+	}
+
+	webhook.URL = req.URL
+	if req.Description != nil {
+		webhook.Description = *req.Description
+	}
+	if req.Enabled != nil {
+		webhook.Enabled = *req.Enabled
+	}
+	events, _ := json.Marshal(append([]string{}, req.Events...))
+	webhook.Events = datatypes.JSON(events)
+
+	if req.Secret != "" {
+		encrypted, err := secrets.Encrypt(req.Secret)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to encrypt webhook secret"})
+			return false
+		}
+		webhook.EncryptedSecret = encrypted
+	}
+	return true
+}
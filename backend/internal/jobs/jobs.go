@@ -0,0 +1,196 @@
+// Package jobs builds training jobs from validated configurations. It is
+// shared by every entry point that creates jobs (API, sweeps) so they all
+// apply the same checks.
+package jobs
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"finetune-studio/internal/backends"
+	"finetune-studio/internal/database"
+	"finetune-studio/internal/jobs/retry"
+	"finetune-studio/internal/jobs/statemachine"
+	"finetune-studio/internal/jobs/trainingconfig"
+	"finetune-studio/internal/models"
+	"finetune-studio/internal/outbox"
+
+	"gorm.io/datatypes"
+	"gorm.io/gorm"
+)
+
+// New validates a job configuration and returns a pending job for it. The
+// stored configuration has every training field resolved. Invalid training
+// fields are reported as a *trainingconfig.ValidationError.
+func New(datasetID uint, configuration []byte, defaultTimeout time.Duration) (*models.Job, error) {
+	configJSON, _, err := trainingconfig.Resolve(configuration)
+	if err != nil {
+		return nil, err
+	}
+
+	backend, err := backends.Resolve(configJSON)
+	if err != nil {
+		return nil, err
+	}
+
+	if _, err := retry.PolicyFromConfig(configJSON); err != nil {
+		return nil, err
+	}
+
+	if _, err := Timeout(configJSON, defaultTimeout); err != nil {
+		return nil, err
+	}
+
+	return &models.Job{
+		DatasetID:     datasetID,
+		Status:        string(statemachine.Pending),
+		Backend:       backend,
+		Configuration: datatypes.JSON(configJSON),
+		Metrics:       datatypes.JSON([]byte("{}")),
+	}, nil
+}
+
+// Priorities accepted on jobs; 0 is the default
+const (
+	MinPriority = -10
+	MaxPriority = 10
+)
+
+// Scheduling holds the fields that order a job in the queue
+type Scheduling struct {
+	Priority  int    `json:"priority"`
+	Submitter string `json:"submitter"`
+	Project   string `json:"project"`
+}
+
+// Apply validates the scheduling fields and sets them on the job
+func (s Scheduling) Apply(job *models.Job) error {
+	if s.Priority < MinPriority || s.Priority > MaxPriority {
+		return fmt.Errorf("priority must be between %d and %d", MinPriority, MaxPriority)
+	}
+	job.Priority = s.Priority
+	job.Submitter = strings.TrimSpace(s.Submitter)
+	job.Project = strings.TrimSpace(s.Project)
+	return nil
+}
+
+// ErrParentModelNotFound is returned by SetParent for an unknown model
+var ErrParentModelNotFound = errors.New("parent model not found")
+
+// SetParent makes the job continue training from the LoRA adapters of a
+// ready model. The job must train the same base model.
+func SetParent(job *models.Job, parentModelID uint) error {
+	var parent models.Model
+	if err := database.DB.First(&parent, parentModelID).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return ErrParentModelNotFound
+		}
+		return err
+	}
+	if parent.Status != "ready" {
+		return fmt.Errorf("parent model %d is %s, only ready models can be trained further", parent.ID, parent.Status)
+	}
+	if parent.LoRAAdaptersPath == "" {
+		return fmt.Errorf("parent model %d has no LoRA adapters", parent.ID)
+	}
+
+	cfg, err := trainingconfig.Parse(job.Configuration)
+	if err != nil {
+		return err
+	}
+	if parent.BaseModel != "" && parent.BaseModel != cfg.BaseModel {
+		return fmt.Errorf("parent model %d was trained on %s, the job configuration uses %s", parent.ID, parent.BaseModel, cfg.BaseModel)
+	}
+
+	job.ParentModelID = &parent.ID
+	return nil
+}
+
+// Clone builds a pending job from an earlier one: its resolved configuration
+// with overrides on top, its dataset version unless datasetID is set, its preset,
+// parent model and scheduling. Kaggle jobs render the notebook the source
+// job ran, so the clone uses the same template version.
+func Clone(source *models.Job, datasetID uint, overrides []byte, defaultTimeout time.Duration) (*models.Job, error) {
+	merged, err := trainingconfig.Merge(source.Configuration, overrides)
+	if err != nil {
+		return nil, err
+	}
+	if datasetID == 0 {
+		datasetID = source.DatasetID
+	}
+
+	job, err := New(datasetID, merged, defaultTimeout)
+	if err != nil {
+		return nil, err
+	}
+	job.SourceJobID = &source.ID
+	if datasetID == source.DatasetID {
+		job.DatasetHash = source.DatasetHash
+	}
+	job.PresetID = source.PresetID
+	job.PresetVersion = source.PresetVersion
+	job.Priority = source.Priority
+	job.Submitter = source.Submitter
+	job.Project = source.Project
+
+	if source.ParentModelID != nil {
+		if err := SetParent(job, *source.ParentModelID); err != nil {
+			return nil, err
+		}
+	}
+
+	// The template only applies to the backend that rendered it
+	if source.NotebookPath != "" && job.Backend == source.Backend {
+		job.TemplateNotebook = source.NotebookPath
+		job.TemplateVersion = source.TemplateVersion
+	}
+	return job, nil
+}
+
+// Create inserts a job built by New, pinned to the current content of its
+// dataset, and records its creation event and webhook event in the same
+// transaction
+func Create(tx *gorm.DB, job *models.Job, actor, reason string) error {
+	if job.DatasetHash == "" {
+		var dataset models.Dataset
+		if err := tx.Select("content_hash").First(&dataset, job.DatasetID).Error; err == nil {
+			job.DatasetHash = dataset.ContentHash
+		}
+	}
+	if err := tx.Create(job).Error; err != nil {
+		return err
+	}
+	err := tx.Create(&models.JobEvent{
+		JobID:     job.ID,
+		ToStatus:  job.Status,
+		Actor:     actor,
+		Reason:    reason,
+		CreatedAt: job.CreatedAt,
+	}).Error
+	if err != nil {
+		return err
+	}
+	return outbox.Add(tx, outbox.JobCreated, statemachine.EventPayload(job, "", statemachine.State(job.Status), actor, reason))
+}
+
+// Timeout reads the "timeout" key of a job configuration ("6h", "90m")
+func Timeout(configuration []byte, fallback time.Duration) (time.Duration, error) {
+	var config struct {
+		Timeout string `json:"timeout"`
+	}
+	if err := json.Unmarshal(configuration, &config); err != nil || config.Timeout == "" {
+		return fallback, nil
+	}
+
+	timeout, err := time.ParseDuration(config.Timeout)
+	if err != nil {
+		return fallback, fmt.Errorf("invalid timeout %q: %v", config.Timeout, err)
+	}
+	if timeout <= 0 {
+		return fallback, fmt.Errorf("invalid timeout %q: must be positive", config.Timeout)
+	}
+	return timeout, nil
+}
@@ -0,0 +1,84 @@
+package jobs
+
+import (
+	"testing"
+	"time"
+
+	"finetune-studio/internal/backends"
+	"finetune-studio/internal/database"
+	"finetune-studio/internal/database/databasetest"
+	"finetune-studio/internal/jobs/statemachine"
+	"finetune-studio/internal/models"
+)
+
+func TestClonePinsDatasetVersion(t *testing.T) {
+	databasetest.Open(t)
+	backends.Register(backends.NewSimulationBackend())
+
+	dataset := models.Dataset{Name: "reviews", ContentHash: "aaaa"}
+	other := models.Dataset{Name: "reviews-v2", ContentHash: "bbbb"}
+	database.DB.Create(&dataset)
+	database.DB.Create(&other)
+
+	source, err := New(dataset.ID, []byte(`{"backend": "simulation"}`), time.Hour)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := Create(database.DB, source, statemachine.ActorAPI, "test"); err != nil {
+		t.Fatal(err)
+	}
+	if source.DatasetHash != "aaaa" {
+		t.Fatalf("source pinned to %q, want the dataset content aaaa", source.DatasetHash)
+	}
+
+	// The clone keeps the version of its source even if the dataset changed
+	database.DB.Model(&dataset).Update("content_hash", "cccc")
+	clone, err := Clone(source, 0, nil, time.Hour)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := Create(database.DB, clone, statemachine.ActorAPI, "test"); err != nil {
+		t.Fatal(err)
+	}
+	if clone.DatasetID != dataset.ID || clone.DatasetHash != "aaaa" || *clone.SourceJobID != source.ID {
+		t.Fatalf("clone trains on dataset %d %q", clone.DatasetID, clone.DatasetHash)
+	}
+
+	onOther, err := Clone(source, other.ID, nil, time.Hour)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := Create(database.DB, onOther, statemachine.ActorAPI, "test"); err != nil {
+		t.Fatal(err)
+	}
+	if onOther.DatasetHash != "bbbb" {
+		t.Fatalf("clone on another dataset pinned to %q, want bbbb", onOther.DatasetHash)
+	}
+}
+
+func TestTimeout(t *testing.T) {
+	tests := []struct {
+		configuration string
+		want          time.Duration
+		invalid       bool
+	}{
+		{`{"timeout": "90m"}`, 90 * time.Minute, false},
+		{`{"learning_rate": 0.0002}`, 6 * time.Hour, false},
+		{`{"timeout": ""}`, 6 * time.Hour, false},
+		{`{"timeout": "soon"}`, 6 * time.Hour, true},
+		{`{"timeout": "-1h"}`, 6 * time.Hour, true},
+		{`{"timeout": "0s"}`, 6 * time.Hour, true},
+	}
+	for _, tt := range tests {
+		got, err := Timeout([]byte(tt.configuration), 6*time.Hour)
+		if got != tt.want || (err != nil) != tt.invalid {
+			t.Errorf("Timeout(%s) = %s, %v", tt.configuration, got, err)
+		}
+	}
+
+	// New rejects configurations whose timeout can't be read
+	backends.Register(backends.NewSimulationBackend())
+	if _, err := New(1, []byte(`{"backend": "simulation", "timeout": "soon"}`), time.Hour); err == nil {
+		t.Error("New accepted an invalid timeout")
+	}
+}
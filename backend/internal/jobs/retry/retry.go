@@ -0,0 +1,236 @@
+package retry
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"net"
+	"net/http"
+	"regexp"
+	"strconv"
+	"syscall"
+	"time"
+)
+
+// ErrorClass groups failures by how they should be handled
+type ErrorClass string
+
+const (
+	ClassNetwork   ErrorClass = "network"    // Connection resets, DNS failures, dropped sockets
+	ClassTimeout   ErrorClass = "timeout"    // Request or command timeouts
+	ClassRateLimit ErrorClass = "rate_limit" // HTTP 429 and equivalents
+	ClassServer    ErrorClass = "server"     // HTTP 5xx from a remote service
+	ClassRunFailed ErrorClass = "run_failed" // The training run itself failed
+	ClassPermanent ErrorClass = "permanent"  // Anything retrying will not fix
+)
+
+var knownClasses = []ErrorClass{ClassNetwork, ClassTimeout, ClassRateLimit, ClassServer, ClassRunFailed, ClassPermanent}
+
+// Error is an error tagged with its class
+type Error struct {
+	Class ErrorClass
+	Err   error
+}
+
+func (e *Error) Error() string { return e.Err.Error() }
+
+func (e *Error) Unwrap() error { return e.Err }
+
+// Wrap tags err with a class. A nil err stays nil.
+func Wrap(class ErrorClass, err error) error {
+	if err == nil {
+		return nil
+	}
+	return &Error{Class: class, Err: err}
+}
+
+// Classify returns the class of err. Tagged errors keep their class, other
+// errors are classified from their type and message.
+func Classify(err error) ErrorClass {
+	var tagged *Error
+	if errors.As(err, &tagged) {
+		return tagged.Class
+	}
+	if errors.Is(err, context.DeadlineExceeded) {
+		return ClassTimeout
+	}
+	var netErr net.Error
+	if errors.As(err, &netErr) {
+		if netErr.Timeout() {
+			return ClassTimeout
+		}
+		return ClassNetwork
+	}
+	if errors.Is(err, io.EOF) || errors.Is(err, io.ErrUnexpectedEOF) ||
+		errors.Is(err, syscall.ECONNRESET) || errors.Is(err, syscall.ECONNREFUSED) || errors.Is(err, syscall.EPIPE) {
+		return ClassNetwork
+	}
+	return ClassifyMessage(err.Error())
+}
+
+// ClassifyStatus classifies an HTTP response status
+func ClassifyStatus(code int) ErrorClass {
+	switch {
+	case code == http.StatusTooManyRequests:
+		return ClassRateLimit
+	case code == http.StatusRequestTimeout:
+		return ClassTimeout
+	case code >= 500 && code <= 599:
+		return ClassServer
+	}
+	return ClassPermanent
+}
+
+var (
+	// statusPattern finds an HTTP status code where messages put one: after
+	// "HTTP", "status" or "code", or leading the message ("503 Service Unavailable")
+	statusPattern = regexp.MustCompile(`(?i)(?:^\s*|\b(?:http(?:/[\d.]+)?|status(?:\s+code)?|code)[\s:=]*)([1-5]\d\d)\b`)
+
+	messagePatterns = []struct {
+		class   ErrorClass
+		pattern *regexp.Regexp
+	}{
+		{ClassRateLimit, regexp.MustCompile(`(?i)\btoo many requests\b|\brate[ -]?limit`)},
+		{ClassTimeout, regexp.MustCompile(`(?i)\btimed out\b|\btimeout\b|\bdeadline exceeded\b`)},
+		{ClassNetwork, regexp.MustCompile(`(?i)\bconnection (?:reset|refused)\b|\bbroken pipe\b|\bno such host\b|` +
+			`\b(?:unexpected )?eof\b|\bmax retries exceeded\b|\bremotedisconnected\b|` +
+			`\btemporary failure in name resolution\b|\bnetwork is unreachable\b`)},
+		{ClassServer, regexp.MustCompile(`(?i)\binternal server error\b|\bbad gateway\b|\bservice unavailable\b`)},
+	}
+)
+
+// ClassifyMessage classifies an error from its text, for errors that only
+// come back as output of an external tool. Status codes are only read where
+// a status is expected, and phrases only match whole words, so a job ID or a
+// word containing "500" or "eof" doesn't count.
+func ClassifyMessage(message string) ErrorClass {
+	if match := statusPattern.FindStringSubmatch(message); match != nil {
+		code, _ := strconv.Atoi(match[1])
+		if class := ClassifyStatus(code); class != ClassPermanent {
+			return class
+		}
+	}
+	for _, candidate := range messagePatterns {
+		if candidate.pattern.MatchString(message) {
+			return candidate.class
+		}
+	}
+	return ClassPermanent
+}
+
+// Duration is a time.Duration written as "30s" / "5m" in JSON
+type Duration time.Duration
+
+func (d Duration) MarshalJSON() ([]byte, error) {
+	return json.Marshal(time.Duration(d).String())
+}
+
+func (d *Duration) UnmarshalJSON(data []byte) error {
+	var s string
+	if err := json.Unmarshal(data, &s); err != nil {
+		return fmt.Errorf("duration must be a string like \"30s\" or \"5m\"")
+	}
+	parsed, err := time.ParseDuration(s)
+	if err != nil {
+		return err
+	}
+	*d = Duration(parsed)
+	return nil
+}
+
+// Policy decides whether and when a failed job is attempted again
+type Policy struct {
+	MaxAttempts    int          `json:"max_attempts"`
+	InitialBackoff Duration     `json:"initial_backoff"`
+	MaxBackoff     Duration     `json:"max_backoff"`
+	Multiplier     float64      `json:"multiplier"`
+	RetryOn        []ErrorClass `json:"retry_on"`
+}
+
+// DefaultPolicy retries infrastructure failures but not failed runs
+func DefaultPolicy() Policy {
+	return Policy{
+		MaxAttempts:    3,
+		InitialBackoff: Duration(time.Minute),
+		MaxBackoff:     Duration(30 * time.Minute),
+		Multiplier:     2,
+		RetryOn:        []ErrorClass{ClassNetwork, ClassTimeout, ClassRateLimit, ClassServer},
+	}
+}
+
+// PolicyFromConfig reads the "retry" key of a job configuration on top of
+// the default policy
+func PolicyFromConfig(configuration []byte) (Policy, error) {
+	policy := DefaultPolicy()
+
+	var config struct {
+		Retry json.RawMessage `json:"retry"`
+	}
+	if err := json.Unmarshal(configuration, &config); err != nil || len(config.Retry) == 0 || string(config.Retry) == "null" {
+		return policy, nil
+	}
+
+	if err := json.Unmarshal(config.Retry, &policy); err != nil {
+		return DefaultPolicy(), fmt.Errorf("invalid retry policy: %v", err)
+	}
+	if err := policy.Validate(); err != nil {
+		return DefaultPolicy(), err
+	}
+	return policy, nil
+}
+
+// Validate checks the policy values
+func (p Policy) Validate() error {
+	if p.MaxAttempts < 1 || p.MaxAttempts > 20 {
+		return fmt.Errorf("invalid retry policy: max_attempts must be between 1 and 20")
+	}
+	if p.InitialBackoff <= 0 {
+		return fmt.Errorf("invalid retry policy: initial_backoff must be positive")
+	}
+	if p.MaxBackoff < p.InitialBackoff {
+		return fmt.Errorf("invalid retry policy: max_backoff must be at least initial_backoff")
+	}
+	if p.Multiplier < 1 {
+		return fmt.Errorf("invalid retry policy: multiplier must be at least 1")
+	}
+	for _, class := range p.RetryOn {
+		if !isKnownClass(class) {
+			return fmt.Errorf("invalid retry policy: unknown error class %q (known: %v)", class, knownClasses)
+		}
+	}
+	return nil
+}
+
+func isKnownClass(class ErrorClass) bool {
+	for _, known := range knownClasses {
+		if class == known {
+			return true
+		}
+	}
+	return false
+}
+
+// Retryable reports whether failures of this class are transient under the policy
+func (p Policy) Retryable(class ErrorClass) bool {
+	for _, c := range p.RetryOn {
+		if c == class {
+			return true
+		}
+	}
+	return false
+}
+
+// Backoff returns the delay before the attempt following attempt n (1-based)
+func (p Policy) Backoff(n int) time.Duration {
+	if n < 1 {
+		n = 1
+	}
+	delay := float64(p.InitialBackoff) * math.Pow(p.Multiplier, float64(n-1))
+	if delay > float64(p.MaxBackoff) {
+		return time.Duration(p.MaxBackoff)
+	}
+	return time.Duration(delay)
+}
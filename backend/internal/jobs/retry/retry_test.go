@@ -0,0 +1,114 @@
+package retry
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"syscall"
+	"testing"
+	"time"
+)
+
+func TestClassifyMessage(t *testing.T) {
+	tests := []struct {
+		message string
+		want    ErrorClass
+	}{
+		{"429 Too Many Requests", ClassRateLimit},
+		{"kaggle: rate limited, slow down", ClassRateLimit},
+		{"HTTP 503: upstream unavailable", ClassServer},
+		{"request failed with status code 502", ClassServer},
+		{"Internal Server Error", ClassServer},
+		{"504 Gateway Timeout", ClassServer},
+		{"read: connection reset by peer", ClassNetwork},
+		{"unexpected EOF", ClassNetwork},
+		{"context deadline exceeded", ClassTimeout},
+		{"HTTP 403: forbidden", ClassPermanent},
+		// Numbers and words that only contain a status code or "eof"
+		{"kernel finetune-job-1500 not found", ClassPermanent},
+		{"job 500 has no dataset", ClassPermanent},
+		{"invalid geofence in configuration", ClassPermanent},
+		{"dataset sha256 e3b0c44298fc500a... does not match", ClassPermanent},
+	}
+	for _, tt := range tests {
+		if got := ClassifyMessage(tt.message); got != tt.want {
+			t.Errorf("ClassifyMessage(%q) = %s, want %s", tt.message, got, tt.want)
+		}
+	}
+}
+
+func TestClassifyErrorTypes(t *testing.T) {
+	tests := []struct {
+		err  error
+		want ErrorClass
+	}{
+		{Wrap(ClassRunFailed, errors.New("HTTP 500")), ClassRunFailed},
+		{fmt.Errorf("poll: %w", context.DeadlineExceeded), ClassTimeout},
+		{fmt.Errorf("download: %w", io.ErrUnexpectedEOF), ClassNetwork},
+		{fmt.Errorf("dial: %w", syscall.ECONNREFUSED), ClassNetwork},
+		{errors.New("model 500 not found"), ClassPermanent},
+	}
+	for _, tt := range tests {
+		if got := Classify(tt.err); got != tt.want {
+			t.Errorf("Classify(%v) = %s, want %s", tt.err, got, tt.want)
+		}
+	}
+}
+
+func TestBackoffGrowsUpToTheCap(t *testing.T) {
+	p := DefaultPolicy()
+	want := []time.Duration{time.Minute, 2 * time.Minute, 4 * time.Minute, 8 * time.Minute, 16 * time.Minute, 30 * time.Minute, 30 * time.Minute}
+	for i, w := range want {
+		if got := p.Backoff(i + 1); got != w {
+			t.Errorf("Backoff(%d) = %s, want %s", i+1, got, w)
+		}
+	}
+	if got := p.Backoff(0); got != time.Minute {
+		t.Errorf("Backoff(0) = %s, want the initial backoff", got)
+	}
+}
+
+func TestDefaultPolicyRetriesInfrastructureOnly(t *testing.T) {
+	p := DefaultPolicy()
+	for _, class := range []ErrorClass{ClassNetwork, ClassTimeout, ClassRateLimit, ClassServer} {
+		if !p.Retryable(class) {
+			t.Errorf("%s not retried", class)
+		}
+	}
+	for _, class := range []ErrorClass{ClassRunFailed, ClassPermanent} {
+		if p.Retryable(class) {
+			t.Errorf("%s retried", class)
+		}
+	}
+}
+
+func TestPolicyFromConfig(t *testing.T) {
+	p, err := PolicyFromConfig([]byte(`{"retry": {"max_attempts": 5, "initial_backoff": "10s", "retry_on": ["run_failed"]}}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if p.MaxAttempts != 5 || p.Backoff(1) != 10*time.Second || p.MaxBackoff != DefaultPolicy().MaxBackoff {
+		t.Fatalf("unexpected policy %+v", p)
+	}
+	if !p.Retryable(ClassRunFailed) || p.Retryable(ClassNetwork) {
+		t.Fatalf("retry_on not replaced: %v", p.RetryOn)
+	}
+
+	if p, err := PolicyFromConfig([]byte(`{"learning_rate": 0.0002}`)); err != nil || p.MaxAttempts != DefaultPolicy().MaxAttempts {
+		t.Fatalf("configuration without retry key: %+v, %v", p, err)
+	}
+
+	for _, invalid := range []string{
+		`{"retry": {"max_attempts": 0}}`,
+		`{"retry": {"max_attempts": 21}}`,
+		`{"retry": {"initial_backoff": "10m", "max_backoff": "1m"}}`,
+		`{"retry": {"multiplier": 0.5}}`,
+		`{"retry": {"initial_backoff": 30}}`,
+		`{"retry": {"retry_on": ["flaky"]}}`,
+	} {
+		if _, err := PolicyFromConfig([]byte(invalid)); err == nil {
+			t.Errorf("accepted %s", invalid)
+		}
+	}
+}
@@ -0,0 +1,276 @@
+// Package series stores the training metric time series of jobs and reads
+// them back, downsampled, as Chart.js datasets
+package series
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"sort"
+	"time"
+
+	"finetune-studio/internal/database"
+	"finetune-studio/internal/models"
+
+	"gorm.io/gorm/clause"
+)
+
+const (
+	// MaxEntries bounds the entries of a single ingestion request
+	MaxEntries = 1000
+
+	// DefaultDownsample is the number of points a series is reduced to when
+	// the caller doesn't ask for another
+	DefaultDownsample = 1000
+
+	maxNameLength = 64
+)
+
+// Entry is the set of metric values logged at one training step
+type Entry struct {
+	Step      int64              `json:"step"`
+	Epoch     *float64           `json:"epoch,omitempty"`
+	Timestamp *time.Time         `json:"timestamp,omitempty"` // Time of ingestion when omitted
+	Values    map[string]float64 `json:"values"`
+}
+
+// Series is one metric of one job, shaped as a Chart.js dataset
+type Series struct {
+	JobID uint    `json:"job_id"`
+	Name  string  `json:"name"`
+	Label string  `json:"label"`
+	Total int     `json:"total"` // Number of points before downsampling
+	Data  []Point `json:"data"`
+}
+
+// Point is a Chart.js point whose x is the training step
+type Point struct {
+	X     int64    `json:"x"`
+	Y     float64  `json:"y"`
+	Epoch *float64 `json:"epoch,omitempty"`
+}
+
+// Points validates entries and flattens them into the points of a job
+func Points(jobID uint, entries []Entry, now time.Time) ([]models.JobMetricPoint, error) {
+	if len(entries) > MaxEntries {
+		return nil, fmt.Errorf("at most %d entries per request", MaxEntries)
+	}
+
+	var points []models.JobMetricPoint
+	for i, entry := range entries {
+		if entry.Step < 0 {
+			return nil, fmt.Errorf("entries[%d]: step must not be negative", i)
+		}
+		if len(entry.Values) == 0 {
+			return nil, fmt.Errorf("entries[%d]: values is required", i)
+		}
+		timestamp := now
+		if entry.Timestamp != nil {
+			timestamp = *entry.Timestamp
+		}
+		for _, name := range sortedNames(entry.Values) {
+			if name == "" || len(name) > maxNameLength {
+				return nil, fmt.Errorf("entries[%d]: metric names must be 1 to %d characters", i, maxNameLength)
+			}
+			points = append(points, models.JobMetricPoint{
+				JobID:     jobID,
+				Name:      name,
+				Step:      entry.Step,
+				Epoch:     entry.Epoch,
+				Value:     entry.Values[name],
+				Timestamp: timestamp,
+			})
+		}
+	}
+	return points, nil
+}
+
+// Record stores points and returns how many were new. A point already
+// recorded for the same job, metric and step is kept, so ingestion may be
+// retried.
+func Record(points []models.JobMetricPoint) (int64, error) {
+	if len(points) == 0 {
+		return 0, nil
+	}
+	result := database.DB.Clauses(clause.OnConflict{DoNothing: true}).CreateInBatches(points, 500)
+	return result.RowsAffected, result.Error
+}
+
+// snapshotCounters are the snapshot fields that locate a point rather than
+// being a metric
+var snapshotCounters = map[string]bool{
+	"step": true, "global_step": true, "total_steps": true,
+	"epoch": true, "total_epochs": true,
+}
+
+// FromSnapshot turns the numeric fields of a job metrics snapshot into
+// points. The step is the snapshot's step, or its epoch for backends that
+// only report whole epochs; snapshots with neither yield no points.
+func FromSnapshot(jobID uint, metrics map[string]interface{}, now time.Time) []models.JobMetricPoint {
+	var epoch *float64
+	if value, ok := number(metrics["epoch"]); ok {
+		epoch = &value
+	}
+
+	var step int64
+	if value, ok := number(metrics["step"]); ok {
+		step = int64(value)
+	} else if value, ok := number(metrics["global_step"]); ok {
+		step = int64(value)
+	} else if epoch != nil && *epoch == math.Trunc(*epoch) {
+		step = int64(*epoch)
+	} else {
+		return nil
+	}
+
+	var points []models.JobMetricPoint
+	for name, raw := range metrics {
+		value, ok := number(raw)
+		if !ok || snapshotCounters[name] || len(name) > maxNameLength {
+			continue
+		}
+		points = append(points, models.JobMetricPoint{
+			JobID:     jobID,
+			Name:      name,
+			Step:      step,
+			Epoch:     epoch,
+			Value:     value,
+			Timestamp: now,
+		})
+	}
+	return points
+}
+
+// Query returns the series of jobs in the order of jobIDs, restricted to
+// names when any are given, each downsampled to at most threshold points (0
+// keeps every point)
+func Query(jobIDs []uint, names []string, threshold int) ([]Series, error) {
+	query := database.DB.Where("job_id IN ?", jobIDs)
+	if len(names) > 0 {
+		query = query.Where("name IN ?", names)
+	}
+	var points []models.JobMetricPoint
+	if err := query.Order("job_id, name, step").Find(&points).Error; err != nil {
+		return nil, err
+	}
+
+	byJob := make(map[uint][]*Series)
+	for i := 0; i < len(points); {
+		current := &Series{
+			JobID: points[i].JobID,
+			Name:  points[i].Name,
+			Label: fmt.Sprintf("Job %d · %s", points[i].JobID, points[i].Name),
+		}
+		for ; i < len(points) && points[i].JobID == current.JobID && points[i].Name == current.Name; i++ {
+			current.Data = append(current.Data, Point{X: points[i].Step, Y: points[i].Value, Epoch: points[i].Epoch})
+		}
+		current.Total = len(current.Data)
+		current.Data = Downsample(current.Data, threshold)
+		byJob[current.JobID] = append(byJob[current.JobID], current)
+	}
+
+	result := []Series{}
+	for _, id := range jobIDs {
+		for _, s := range byJob[id] {
+			result = append(result, *s)
+		}
+	}
+	return result, nil
+}
+
+// Names returns the metric names recorded for any of the jobs
+func Names(jobIDs []uint) ([]string, error) {
+	names := []string{}
+	err := database.DB.Model(&models.JobMetricPoint{}).
+		Where("job_id IN ?", jobIDs).
+		Distinct().
+		Order("name").
+		Pluck("name", &names).Error
+	return names, err
+}
+
+// Downsample reduces points to at most threshold with the
+// largest-triangle-three-buckets algorithm, which keeps the first and last
+// points and the peaks that shape the curve. A threshold of 0 keeps every
+// point.
+func Downsample(points []Point, threshold int) []Point {
+	if threshold <= 0 || len(points) <= threshold {
+		return points
+	}
+	if threshold < 3 {
+		threshold = 3
+	}
+
+	sampled := make([]Point, 0, threshold)
+	sampled = append(sampled, points[0])
+
+	// Points between the first and the last are split into threshold-2
+	// buckets; each bucket keeps the point forming the largest triangle with
+	// the previously kept point and the average of the next bucket
+	every := float64(len(points)-2) / float64(threshold-2)
+	previous := 0
+	for i := 0; i < threshold-2; i++ {
+		nextStart := int(float64(i+1)*every) + 1
+		nextEnd := int(float64(i+2)*every) + 1
+		if nextEnd > len(points) {
+			nextEnd = len(points)
+		}
+		var avgX, avgY float64
+		for _, p := range points[nextStart:nextEnd] {
+			avgX += float64(p.X)
+			avgY += p.Y
+		}
+		avgX /= float64(nextEnd - nextStart)
+		avgY /= float64(nextEnd - nextStart)
+
+		start := int(float64(i)*every) + 1
+		end := int(float64(i+1)*every) + 1
+		a := points[previous]
+		maxArea, selected := -1.0, start
+		for j := start; j < end; j++ {
+			area := math.Abs((float64(a.X)-avgX)*(points[j].Y-a.Y) - (float64(a.X)-float64(points[j].X))*(avgY-a.Y))
+			if area > maxArea {
+				maxArea, selected = area, j
+			}
+		}
+		sampled = append(sampled, points[selected])
+		previous = selected
+	}
+	return append(sampled, points[len(points)-1])
+}
+
+// number converts the numeric types found in metrics maps to a float
+func number(v interface{}) (float64, bool) {
+	var f float64
+	switch n := v.(type) {
+	case float64:
+		f = n
+	case float32:
+		f = float64(n)
+	case int:
+		f = float64(n)
+	case int64:
+		f = float64(n)
+	case json.Number:
+		parsed, err := n.Float64()
+		if err != nil {
+			return 0, false
+		}
+		f = parsed
+	default:
+		return 0, false
+	}
+	if math.IsNaN(f) || math.IsInf(f, 0) {
+		return 0, false
+	}
+	return f, true
+}
+
+func sortedNames(values map[string]float64) []string {
+	names := make([]string, 0, len(values))
+	for name := range values {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
@@ -0,0 +1,78 @@
+package series
+
+import (
+	"testing"
+	"time"
+)
+
+func TestDownsampleKeepsEndsAndPeaks(t *testing.T) {
+	points := make([]Point, 1000)
+	for i := range points {
+		points[i] = Point{X: int64(i), Y: 1}
+	}
+	points[500].Y = 10
+
+	sampled := Downsample(points, 20)
+	if len(sampled) != 20 {
+		t.Fatalf("got %d points, want 20", len(sampled))
+	}
+	if sampled[0].X != 0 || sampled[len(sampled)-1].X != 999 {
+		t.Fatalf("first and last points not kept: %v ... %v", sampled[0], sampled[len(sampled)-1])
+	}
+	peak := false
+	for i, p := range sampled {
+		if i > 0 && p.X <= sampled[i-1].X {
+			t.Fatalf("points out of order at %d: %v", i, sampled)
+		}
+		if p.X == 500 {
+			peak = true
+		}
+	}
+	if !peak {
+		t.Fatal("the peak at step 500 was dropped")
+	}
+
+	if got := Downsample(points[:10], 20); len(got) != 10 {
+		t.Fatalf("short series changed to %d points", len(got))
+	}
+	if got := Downsample(points, 0); len(got) != len(points) {
+		t.Fatalf("threshold 0 returned %d points", len(got))
+	}
+}
+
+func TestPoints(t *testing.T) {
+	epoch := 0.5
+	points, err := Points(7, []Entry{{Step: 10, Epoch: &epoch, Values: map[string]float64{"loss": 1.2, "learning_rate": 2e-4}}}, time.Now())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(points) != 2 || points[0].Name != "learning_rate" || points[1].Name != "loss" || points[1].Step != 10 || points[1].JobID != 7 {
+		t.Fatalf("unexpected points %+v", points)
+	}
+
+	for _, entry := range []Entry{
+		{Step: -1, Values: map[string]float64{"loss": 1}},
+		{Step: 1},
+		{Step: 1, Values: map[string]float64{"": 1}},
+	} {
+		if _, err := Points(7, []Entry{entry}, time.Now()); err == nil {
+			t.Errorf("accepted %+v", entry)
+		}
+	}
+}
+
+func TestFromSnapshot(t *testing.T) {
+	points := FromSnapshot(3, map[string]interface{}{
+		"epoch":        2,
+		"total_epochs": 5,
+		"loss":         0.4,
+		"stage":        "training",
+	}, time.Now())
+	if len(points) != 1 || points[0].Name != "loss" || points[0].Step != 2 || *points[0].Epoch != 2 {
+		t.Fatalf("unexpected points %+v", points)
+	}
+
+	if points := FromSnapshot(3, map[string]interface{}{"stage": "training", "kernel_status": "running"}, time.Now()); len(points) != 0 {
+		t.Fatalf("snapshot without a step produced %+v", points)
+	}
+}
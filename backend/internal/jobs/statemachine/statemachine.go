@@ -0,0 +1,151 @@
+package statemachine
+
+import (
+	"errors"
+	"fmt"
+	"time"
+
+	"finetune-studio/internal/database"
+	"finetune-studio/internal/events"
+	"finetune-studio/internal/models"
+	"finetune-studio/internal/outbox"
+
+	"gorm.io/gorm"
+)
+
+// State is a job status
+type State string
+
+const (
+	Pending    State = "pending"
+	Starting   State = "starting"
+	Running    State = "running"
+	Retrying   State = "retrying"
+	Cancelling State = "cancelling" // Cancel requested, waiting for the backend to stop the run
+	Completed  State = "completed"
+	Failed     State = "failed"
+	Cancelled  State = "cancelled"
+	TimedOut   State = "timed_out"
+)
+
+// Actors recorded on job events
+const (
+	ActorAPI       = "api"
+	ActorWorker    = "worker"
+	ActorScheduler = "scheduler"
+	ActorPipeline  = "pipeline"
+)
+
+// transitions lists the states reachable from each non-terminal state
+var transitions = map[State][]State{
+	Pending:    {Starting, Cancelled, Failed},
+	Starting:   {Pending, Running, Retrying, Failed, Cancelling, Cancelled, TimedOut}, // Back to pending when the backend has no capacity
+	Running:    {Completed, Retrying, Failed, Cancelling, Cancelled, TimedOut},
+	Retrying:   {Starting, Failed, Cancelling, Cancelled, TimedOut},
+	Cancelling: {Cancelled, Failed},
+}
+
+// ErrConcurrentUpdate is returned when the job status changed in the
+// database since the job was loaded
+var ErrConcurrentUpdate = errors.New("job status changed concurrently")
+
+// TransitionError reports a move the state machine does not allow
+type TransitionError struct {
+	From State
+	To   State
+}
+
+func (e *TransitionError) Error() string {
+	return fmt.Sprintf("invalid job transition %s → %s", e.From, e.To)
+}
+
+// CanTransition reports whether a job may move from one state to another
+func CanTransition(from, to State) bool {
+	for _, allowed := range transitions[from] {
+		if allowed == to {
+			return true
+		}
+	}
+	return false
+}
+
+// IsTerminal reports whether no transition leaves the state
+func IsTerminal(s State) bool {
+	return len(transitions[s]) == 0
+}
+
+// Transition moves the job to a new state and records the move in job_events
+// and as a job.<state> webhook event, then publishes it to stream clients.
+// The update only applies if the stored status still matches job.Status, so a
+// worker and an API call racing on the same job cannot both win. Moving a job
+// to the state it is already in is a no-op.
+func Transition(job *models.Job, to State, actor, reason string) error {
+	from := State(job.Status)
+	if from == to {
+		return nil
+	}
+	if !CanTransition(from, to) {
+		return &TransitionError{From: from, To: to}
+	}
+
+	now := time.Now()
+	err := database.DB.Transaction(func(tx *gorm.DB) error {
+		result := tx.Exec("UPDATE jobs SET status = ?, updated_at = ? WHERE id = ? AND status = ? AND deleted_at IS NULL",
+			string(to), now, job.ID, string(from))
+		if result.Error != nil {
+			return result.Error
+		}
+		if result.RowsAffected == 0 {
+			return ErrConcurrentUpdate
+		}
+
+		err := tx.Create(&models.JobEvent{
+			JobID:      job.ID,
+			FromStatus: string(from),
+			ToStatus:   string(to),
+			Actor:      actor,
+			Reason:     reason,
+			CreatedAt:  now,
+		}).Error
+		if err != nil {
+			return err
+		}
+		return outbox.Add(tx, "job."+string(to), EventPayload(job, from, to, actor, reason))
+	})
+	if err != nil {
+		return err
+	}
+
+	job.Status = string(to)
+	job.UpdatedAt = now
+	events.Default.Publish(events.Event{
+		Type:           events.TypeStatus,
+		JobID:          job.ID,
+		Status:         string(to),
+		PreviousStatus: string(from),
+		Reason:         reason,
+		Time:           now,
+	})
+	return nil
+}
+
+// EventPayload is the data of the job webhook events
+func EventPayload(job *models.Job, from, to State, actor, reason string) map[string]interface{} {
+	return map[string]interface{}{
+		"job_id":          job.ID,
+		"dataset_id":      job.DatasetID,
+		"backend":         job.Backend,
+		"status":          string(to),
+		"previous_status": string(from),
+		"actor":           actor,
+		"reason":          reason,
+		"attempts":        job.Attempts,
+	}
+}
+
+// Events returns the transition history of a job, oldest first
+func Events(jobID uint) ([]models.JobEvent, error) {
+	var events []models.JobEvent
+	err := database.DB.Where("job_id = ?", jobID).Order("created_at, id").Find(&events).Error
+	return events, err
+}
@@ -0,0 +1,107 @@
+package statemachine
+
+import (
+	"errors"
+	"testing"
+
+	"finetune-studio/internal/database"
+	"finetune-studio/internal/database/databasetest"
+	"finetune-studio/internal/models"
+)
+
+func TestTransitionRecordsEvents(t *testing.T) {
+	databasetest.Open(t)
+	job := models.Job{Status: string(Pending)}
+	database.DB.Create(&job)
+
+	for _, to := range []State{Starting, Running, Completed} {
+		if err := Transition(&job, to, ActorWorker, "step"); err != nil {
+			t.Fatalf("%s: %v", to, err)
+		}
+	}
+
+	var stored models.Job
+	database.DB.First(&stored, job.ID)
+	if stored.Status != string(Completed) {
+		t.Fatalf("stored status %s", stored.Status)
+	}
+	events, err := Events(job.ID)
+	if err != nil || len(events) != 3 || events[2].FromStatus != string(Running) || events[2].ToStatus != string(Completed) {
+		t.Fatalf("unexpected events %+v, %v", events, err)
+	}
+	var outbox int64
+	database.DB.Model(&models.OutboxEvent{}).Where("type = ?", "job.completed").Count(&outbox)
+	if outbox != 1 {
+		t.Fatalf("%d job.completed outbox events, want 1", outbox)
+	}
+}
+
+func TestTransitionRejectsIllegalMoves(t *testing.T) {
+	databasetest.Open(t)
+
+	illegal := []struct{ from, to State }{
+		{Pending, Running},
+		{Pending, Completed},
+		{Running, Pending},
+		{Cancelling, Running},
+		{Completed, Running},
+		{Failed, Retrying},
+		{Cancelled, Pending},
+		{TimedOut, Starting},
+	}
+	for _, move := range illegal {
+		job := models.Job{Status: string(move.from)}
+		database.DB.Create(&job)
+
+		err := Transition(&job, move.to, ActorAPI, "")
+		var transitionErr *TransitionError
+		if !errors.As(err, &transitionErr) || transitionErr.From != move.from || transitionErr.To != move.to {
+			t.Errorf("%s → %s: got %v, want a TransitionError", move.from, move.to, err)
+		}
+		if job.Status != string(move.from) {
+			t.Errorf("%s → %s: job moved to %s", move.from, move.to, job.Status)
+		}
+	}
+
+	var events int64
+	database.DB.Model(&models.JobEvent{}).Count(&events)
+	if events != 0 {
+		t.Fatalf("%d events recorded for rejected moves", events)
+	}
+}
+
+func TestTransitionDetectsConcurrentUpdates(t *testing.T) {
+	databasetest.Open(t)
+	job := models.Job{Status: string(Running)}
+	database.DB.Create(&job)
+
+	// An API call cancelled the job after the worker loaded it
+	stale := job
+	if err := Transition(&job, Cancelling, ActorAPI, "cancelled by user"); err != nil {
+		t.Fatal(err)
+	}
+	if err := Transition(&stale, Completed, ActorWorker, "run completed"); !errors.Is(err, ErrConcurrentUpdate) {
+		t.Fatalf("got %v, want ErrConcurrentUpdate", err)
+	}
+
+	// Moving to the current state is a no-op
+	if err := Transition(&job, Cancelling, ActorAPI, "again"); err != nil {
+		t.Fatal(err)
+	}
+	if events, _ := Events(job.ID); len(events) != 1 {
+		t.Fatalf("%d events, want 1", len(events))
+	}
+}
+
+func TestTerminalStates(t *testing.T) {
+	for _, s := range []State{Completed, Failed, Cancelled, TimedOut} {
+		if !IsTerminal(s) {
+			t.Errorf("%s is not terminal", s)
+		}
+	}
+	for _, s := range []State{Pending, Starting, Running, Retrying, Cancelling} {
+		if IsTerminal(s) {
+			t.Errorf("%s is terminal", s)
+		}
+	}
+}
@@ -0,0 +1,98 @@
+package trainingconfig
+
+// Schema returns the JSON Schema of the training fields of a job
+// configuration. Reserved keys are listed without constraints so the
+// document also validates configurations that use them.
+func Schema() map[string]interface{} {
+	defaults := Default()
+
+	models := make([]interface{}, 0, len(BaseModels))
+	for _, name := range BaseModelNames() {
+		model := BaseModels[name]
+		models = append(models, map[string]interface{}{
+			"const":          name,
+			"title":          model.Name,
+			"model_id":       model.ModelID,
+			"max_seq_length": model.MaxSeqLength,
+		})
+	}
+
+	properties := map[string]interface{}{
+		"base_model": map[string]interface{}{
+			"type":        "string",
+			"title":       "Base model",
+			"description": "Model to finetune",
+			"oneOf":       models,
+			"default":     defaults.BaseModel,
+		},
+		"lora_rank":     integer("LoRA rank", "Rank of the LoRA update matrices", "lora_rank", defaults.LoraRank),
+		"lora_alpha":    integer("LoRA alpha", "Scaling factor of the LoRA updates", "lora_alpha", defaults.LoraAlpha),
+		"lora_dropout":  number("LoRA dropout", "Dropout applied to the LoRA layers", "lora_dropout", defaults.LoraDropout),
+		"learning_rate": number("Learning rate", "Peak learning rate of the linear schedule", "learning_rate", defaults.LearningRate),
+		"target_modules": map[string]interface{}{
+			"type":        "array",
+			"title":       "Target modules",
+			"description": "Layers LoRA adapters are attached to",
+			"items":       map[string]interface{}{"type": "string", "enum": TargetModules},
+			"minItems":    1,
+			"uniqueItems": true,
+			"default":     defaults.TargetModules,
+		},
+		"batch_size":                  integer("Batch size", "Examples per device and step", "batch_size", defaults.BatchSize),
+		"gradient_accumulation_steps": integer("Gradient accumulation", "Steps accumulated before each optimizer update", "gradient_accumulation_steps", defaults.GradientAccumulationSteps),
+		"epochs":                      integer("Epochs", "Passes over the dataset", "epochs", defaults.Epochs),
+		"max_steps":                   integer("Max steps", "Stop after this many steps; 0 trains for the given epochs", "max_steps", defaults.MaxSteps),
+		"max_seq_length":              integer("Max sequence length", "Longer examples are truncated", "max_seq_length", defaults.MaxSeqLength),
+		"quantization": map[string]interface{}{
+			"type":        "string",
+			"title":       "Quantization",
+			"description": "Precision the base model is loaded in",
+			"enum":        Quantizations,
+			"default":     defaults.Quantization,
+		},
+		"seed": integer("Seed", "Random seed for reproducible runs", "seed", defaults.Seed),
+		"prompt_format": map[string]interface{}{
+			"type":        "string",
+			"title":       "Prompt format",
+			"description": "Layout of the dataset rows",
+			"enum":        PromptFormats,
+			"default":     defaults.PromptFormat,
+		},
+	}
+	for _, key := range ReservedKeys {
+		properties[key] = map[string]interface{}{}
+	}
+
+	return map[string]interface{}{
+		"$schema":              "https://json-schema.org/draft/2020-12/schema",
+		"$id":                  "/api/v1/jobs/config-schema",
+		"title":                "Training configuration",
+		"type":                 "object",
+		"properties":           properties,
+		"additionalProperties": false,
+	}
+}
+
+func integer(title, description, name string, value int) map[string]interface{} {
+	property := number(title, description, name, float64(value))
+	property["type"] = "integer"
+	property["default"] = value
+	return property
+}
+
+func number(title, description, name string, value float64) map[string]interface{} {
+	r := ranges[name]
+	property := map[string]interface{}{
+		"type":        "number",
+		"title":       title,
+		"description": description,
+		"maximum":     r.Max,
+		"default":     value,
+	}
+	if r.ExclusiveMin {
+		property["exclusiveMinimum"] = r.Min
+	} else {
+		property["minimum"] = r.Min
+	}
+	return property
+}
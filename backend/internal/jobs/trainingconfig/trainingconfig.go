@@ -0,0 +1,373 @@
+// Package trainingconfig defines the training hyperparameters a job accepts,
+// their defaults and allowed ranges, and the JSON Schema describing them.
+package trainingconfig
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// BaseModel is an entry of the base model allow-list
+type BaseModel struct {
+	Name         string `json:"name"`
+	ModelID      string `json:"model_id"` // Hugging Face repository loaded by the notebook
+	MaxSeqLength int    `json:"max_seq_length"`
+}
+
+// BaseModels is the allow-list of models a job may finetune, by the name
+// used in job configurations
+var BaseModels = map[string]BaseModel{
+	"llama-3.2-1b":    {Name: "Llama 3.2 1B", ModelID: "unsloth/Llama-3.2-1B-Instruct-bnb-4bit", MaxSeqLength: 8192},
+	"llama-3.2-3b":    {Name: "Llama 3.2 3B", ModelID: "unsloth/Llama-3.2-3B-Instruct-bnb-4bit", MaxSeqLength: 8192},
+	"llama-3-8b":      {Name: "Llama 3 8B", ModelID: "unsloth/llama-3-8b-bnb-4bit", MaxSeqLength: 8192},
+	"qwen-2.5-1.5b":   {Name: "Qwen 2.5 1.5B", ModelID: "unsloth/Qwen2.5-1.5B-Instruct-bnb-4bit", MaxSeqLength: 32768},
+	"phi-3-mini":      {Name: "Phi-3 Mini (3.8B)", ModelID: "unsloth/Phi-3-mini-4k-instruct-bnb-4bit", MaxSeqLength: 4096},
+	"mistral-7b-v0.3": {Name: "Mistral 7B v0.3", ModelID: "unsloth/mistral-7b-v0.3-bnb-4bit", MaxSeqLength: 32768},
+	"gpt2":            {Name: "GPT-2 (124M)", ModelID: "openai-community/gpt2", MaxSeqLength: 1024},
+}
+
+// Quantizations are the ways the base model can be loaded
+var Quantizations = []string{"4bit", "8bit", "none"}
+
+// PromptFormats are the dataset layouts the notebook knows how to turn into
+// training text
+var PromptFormats = []string{"alpaca", "chat", "sentiment", "text"}
+
+// TargetModules are the projection layers LoRA adapters can be attached to
+var TargetModules = []string{"q_proj", "k_proj", "v_proj", "o_proj", "gate_proj", "up_proj", "down_proj"}
+
+// ReservedKeys are configuration keys owned by other packages (backend
+// selection, retry policy, deadline) that live next to the training fields
+var ReservedKeys = []string{"backend", "retry", "timeout"}
+
+// TrainingConfig holds the hyperparameters of a finetuning run
+type TrainingConfig struct {
+	BaseModel                 string   `json:"base_model"`
+	LoraRank                  int      `json:"lora_rank"`
+	LoraAlpha                 int      `json:"lora_alpha"`
+	LoraDropout               float64  `json:"lora_dropout"`
+	TargetModules             []string `json:"target_modules"`
+	LearningRate              float64  `json:"learning_rate"`
+	BatchSize                 int      `json:"batch_size"`
+	GradientAccumulationSteps int      `json:"gradient_accumulation_steps"`
+	Epochs                    int      `json:"epochs"`
+	MaxSteps                  int      `json:"max_steps"` // Overrides epochs when > 0
+	MaxSeqLength              int      `json:"max_seq_length"`
+	Quantization              string   `json:"quantization"`
+	Seed                      int      `json:"seed"`
+	PromptFormat              string   `json:"prompt_format"`
+}
+
+// Default returns the configuration used for fields a job leaves out
+func Default() TrainingConfig {
+	return TrainingConfig{
+		BaseModel:                 "llama-3.2-3b",
+		LoraRank:                  16,
+		LoraAlpha:                 16,
+		LoraDropout:               0,
+		TargetModules:             append([]string(nil), TargetModules...),
+		LearningRate:              2e-4,
+		BatchSize:                 2,
+		GradientAccumulationSteps: 4,
+		Epochs:                    3,
+		MaxSteps:                  0,
+		MaxSeqLength:              2048,
+		Quantization:              "4bit",
+		Seed:                      3407,
+		PromptFormat:              "sentiment",
+	}
+}
+
+// numberRange bounds a numeric field
+type numberRange struct {
+	Min, Max     float64
+	ExclusiveMin bool
+}
+
+// ranges are shared by Validate and Schema so both always agree
+var ranges = map[string]numberRange{
+	"lora_rank":                   {Min: 1, Max: 256},
+	"lora_alpha":                  {Min: 1, Max: 512},
+	"lora_dropout":                {Min: 0, Max: 0.5},
+	"learning_rate":               {Min: 0, Max: 0.01, ExclusiveMin: true},
+	"batch_size":                  {Min: 1, Max: 128},
+	"gradient_accumulation_steps": {Min: 1, Max: 128},
+	"epochs":                      {Min: 1, Max: 50},
+	"max_steps":                   {Min: 0, Max: 100000},
+	"max_seq_length":              {Min: 128, Max: 32768},
+	"seed":                        {Min: 0, Max: 2147483647},
+}
+
+// ValidationError lists the invalid fields of a configuration with a message each
+type ValidationError struct {
+	Fields map[string]string `json:"fields"`
+}
+
+func (e *ValidationError) Error() string {
+	names := make([]string, 0, len(e.Fields))
+	for name := range e.Fields {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	parts := make([]string, len(names))
+	for i, name := range names {
+		parts[i] = fmt.Sprintf("%s: %s", name, e.Fields[name])
+	}
+	return "invalid training configuration: " + strings.Join(parts, "; ")
+}
+
+// Parse reads a job configuration on top of the defaults and validates it.
+// Invalid or unknown fields are reported as a *ValidationError.
+func Parse(configuration []byte) (TrainingConfig, error) {
+	cfg := Default()
+	if len(bytes.TrimSpace(configuration)) == 0 || string(bytes.TrimSpace(configuration)) == "null" {
+		return cfg, nil
+	}
+
+	var raw map[string]json.RawMessage
+	if err := json.Unmarshal(configuration, &raw); err != nil {
+		return Default(), &ValidationError{Fields: map[string]string{"configuration": "must be a JSON object"}}
+	}
+
+	fields := make(map[string]string)
+	for key, value := range raw {
+		if isReserved(key) {
+			continue
+		}
+		target := cfg.field(key)
+		if target == nil {
+			fields[key] = "unknown field"
+			continue
+		}
+		if err := json.Unmarshal(value, target); err != nil {
+			fields[key] = "must be " + typeName(target)
+		}
+	}
+
+	// The default sequence length is capped to what the chosen model supports
+	if model, ok := BaseModels[cfg.BaseModel]; ok {
+		if _, set := raw["max_seq_length"]; !set && cfg.MaxSeqLength > model.MaxSeqLength {
+			cfg.MaxSeqLength = model.MaxSeqLength
+		}
+	}
+
+	if err := cfg.Validate(); err != nil {
+		if validationErr, ok := err.(*ValidationError); ok {
+			for name, msg := range validationErr.Fields {
+				if _, exists := fields[name]; !exists {
+					fields[name] = msg
+				}
+			}
+		}
+	}
+
+	if len(fields) > 0 {
+		return Default(), &ValidationError{Fields: fields}
+	}
+	return cfg, nil
+}
+
+// Validate checks every field against its allowed values
+func (c TrainingConfig) Validate() error {
+	fields := make(map[string]string)
+
+	model, ok := BaseModels[c.BaseModel]
+	if !ok {
+		fields["base_model"] = fmt.Sprintf("must be one of %s", strings.Join(BaseModelNames(), ", "))
+	}
+
+	numbers := map[string]float64{
+		"lora_rank":                   float64(c.LoraRank),
+		"lora_alpha":                  float64(c.LoraAlpha),
+		"lora_dropout":                c.LoraDropout,
+		"learning_rate":               c.LearningRate,
+		"batch_size":                  float64(c.BatchSize),
+		"gradient_accumulation_steps": float64(c.GradientAccumulationSteps),
+		"epochs":                      float64(c.Epochs),
+		"max_steps":                   float64(c.MaxSteps),
+		"max_seq_length":              float64(c.MaxSeqLength),
+		"seed":                        float64(c.Seed),
+	}
+	for name, value := range numbers {
+		if msg := ranges[name].check(value); msg != "" {
+			fields[name] = msg
+		}
+	}
+	if ok && c.MaxSeqLength > model.MaxSeqLength {
+		fields["max_seq_length"] = fmt.Sprintf("must be at most %d for %s", model.MaxSeqLength, c.BaseModel)
+	}
+
+	if len(c.TargetModules) == 0 {
+		fields["target_modules"] = "must list at least one module"
+	}
+	for _, module := range c.TargetModules {
+		if !contains(TargetModules, module) {
+			fields["target_modules"] = fmt.Sprintf("unknown module %q, must be among %s", module, strings.Join(TargetModules, ", "))
+			break
+		}
+	}
+
+	if !contains(Quantizations, c.Quantization) {
+		fields["quantization"] = fmt.Sprintf("must be one of %s", strings.Join(Quantizations, ", "))
+	}
+	if !contains(PromptFormats, c.PromptFormat) {
+		fields["prompt_format"] = fmt.Sprintf("must be one of %s", strings.Join(PromptFormats, ", "))
+	}
+
+	if len(fields) > 0 {
+		return &ValidationError{Fields: fields}
+	}
+	return nil
+}
+
+// ModelID returns the Hugging Face repository of the base model
+func (c TrainingConfig) ModelID() string {
+	return BaseModels[c.BaseModel].ModelID
+}
+
+// Resolve validates a job configuration and returns it with every training
+// field filled in, keeping the reserved keys as they were sent
+func Resolve(configuration []byte) ([]byte, TrainingConfig, error) {
+	cfg, err := Parse(configuration)
+	if err != nil {
+		return nil, cfg, err
+	}
+
+	resolved := make(map[string]json.RawMessage)
+	json.Unmarshal(configuration, &resolved)
+	for key := range resolved {
+		if !isReserved(key) {
+			delete(resolved, key)
+		}
+	}
+
+	cfgJSON, _ := json.Marshal(cfg)
+	var training map[string]json.RawMessage
+	json.Unmarshal(cfgJSON, &training)
+	for key, value := range training {
+		resolved[key] = value
+	}
+
+	data, err := json.Marshal(resolved)
+	return data, cfg, err
+}
+
+// Merge overlays the top-level keys of overrides on base, e.g. the fields a
+// job sets on top of a preset. When overrides change the base model but not
+// the sequence length, a base sequence length the new model doesn't support
+// is dropped so the default for the model applies.
+func Merge(base, overrides []byte) ([]byte, error) {
+	merged := make(map[string]json.RawMessage)
+	var overridden map[string]json.RawMessage
+	for i, layer := range [][]byte{base, overrides} {
+		if len(bytes.TrimSpace(layer)) == 0 || string(bytes.TrimSpace(layer)) == "null" {
+			continue
+		}
+		var fields map[string]json.RawMessage
+		if err := json.Unmarshal(layer, &fields); err != nil {
+			return nil, &ValidationError{Fields: map[string]string{"configuration": "must be a JSON object"}}
+		}
+		for key, value := range fields {
+			merged[key] = value
+		}
+		if i == 1 {
+			overridden = fields
+		}
+	}
+
+	if _, set := overridden["max_seq_length"]; !set && overridden["base_model"] != nil {
+		var name string
+		var length int
+		json.Unmarshal(overridden["base_model"], &name)
+		json.Unmarshal(merged["max_seq_length"], &length)
+		if model, ok := BaseModels[name]; ok && length > model.MaxSeqLength {
+			delete(merged, "max_seq_length")
+		}
+	}
+	return json.Marshal(merged)
+}
+
+// BaseModelNames lists the allowed base models
+func BaseModelNames() []string {
+	names := make([]string, 0, len(BaseModels))
+	for name := range BaseModels {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// field returns a pointer to the struct field decoded from a JSON key
+func (c *TrainingConfig) field(key string) interface{} {
+	switch key {
+	case "base_model":
+		return &c.BaseModel
+	case "lora_rank":
+		return &c.LoraRank
+	case "lora_alpha":
+		return &c.LoraAlpha
+	case "lora_dropout":
+		return &c.LoraDropout
+	case "target_modules":
+		return &c.TargetModules
+	case "learning_rate":
+		return &c.LearningRate
+	case "batch_size":
+		return &c.BatchSize
+	case "gradient_accumulation_steps":
+		return &c.GradientAccumulationSteps
+	case "epochs":
+		return &c.Epochs
+	case "max_steps":
+		return &c.MaxSteps
+	case "max_seq_length":
+		return &c.MaxSeqLength
+	case "quantization":
+		return &c.Quantization
+	case "seed":
+		return &c.Seed
+	case "prompt_format":
+		return &c.PromptFormat
+	}
+	return nil
+}
+
+func (r numberRange) check(value float64) string {
+	if r.ExclusiveMin && value <= r.Min {
+		return fmt.Sprintf("must be greater than %g and at most %g", r.Min, r.Max)
+	}
+	if value < r.Min || value > r.Max {
+		return fmt.Sprintf("must be between %g and %g", r.Min, r.Max)
+	}
+	return ""
+}
+
+func typeName(target interface{}) string {
+	switch target.(type) {
+	case *int:
+		return "an integer"
+	case *float64:
+		return "a number"
+	case *[]string:
+		return "a list of strings"
+	default:
+		return "a string"
+	}
+}
+
+func isReserved(key string) bool {
+	return contains(ReservedKeys, key)
+}
+
+func contains(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,42 @@
+package trainingconfig
+
+import (
+	"testing"
+)
+
+func TestMergeRederivesSequenceLengthForNewBaseModel(t *testing.T) {
+	base, _, err := Resolve([]byte(`{"base_model": "llama-3.2-1b"}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		overrides string
+		want      int
+	}{
+		{`{"base_model": "gpt2"}`, 1024},                       // Default capped to the new model
+		{`{"base_model": "qwen-2.5-1.5b"}`, 2048},              // Still supported, kept
+		{`{"base_model": "gpt2", "max_seq_length": 512}`, 512}, // Set explicitly
+		{`{"learning_rate": 0.0001}`, 2048},                    // Same model
+	}
+	for _, tt := range tests {
+		merged, err := Merge(base, []byte(tt.overrides))
+		if err != nil {
+			t.Fatal(err)
+		}
+		_, cfg, err := Resolve(merged)
+		if err != nil {
+			t.Errorf("%s: %v", tt.overrides, err)
+			continue
+		}
+		if cfg.MaxSeqLength != tt.want {
+			t.Errorf("%s: max_seq_length %d, want %d", tt.overrides, cfg.MaxSeqLength, tt.want)
+		}
+	}
+
+	// An explicit length the new model can't take is still rejected
+	merged, _ := Merge([]byte(`{"base_model": "llama-3.2-1b", "max_seq_length": 4096}`), []byte(`{"base_model": "gpt2", "max_seq_length": 4096}`))
+	if _, _, err := Resolve(merged); err == nil {
+		t.Fatal("max_seq_length 4096 accepted for gpt2")
+	}
+}
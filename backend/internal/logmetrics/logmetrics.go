@@ -0,0 +1,267 @@
+// Package logmetrics turns training log lines into metric points and job
+// progress. Rules are configured per backend: "json" rules read JSON or
+// Python dict literals such as the {'loss': 1.2, 'epoch': 0.5} lines of the
+// Hugging Face trainers, "regex" rules read the named groups of a pattern.
+package logmetrics
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// Rule types
+const (
+	TypeJSON  = "json"
+	TypeRegex = "regex"
+)
+
+// AnyBackend keys the rules tried after those of the backend of a line
+const AnyBackend = "*"
+
+// Rule extracts metric values from matching log lines
+type Rule struct {
+	Type string `json:"type"`
+
+	// regex: pattern whose named groups are the values, "step" and "epoch"
+	// locating them. json: optional pattern the line must match.
+	Pattern string `json:"pattern,omitempty"`
+
+	// json: keys one of which the object must have, so unrelated dicts
+	// printed by the notebook are ignored
+	Require []string `json:"require,omitempty"`
+
+	// Only keep these metrics; empty keeps every numeric value
+	Metrics []string `json:"metrics,omitempty"`
+
+	re *regexp.Regexp
+}
+
+// Rules are the rules of each backend name, tried in order
+type Rules map[string][]Rule
+
+// trainerKeys are the values the trainers log at each logging step or
+// evaluation
+var trainerKeys = []string{"loss", "eval_loss", "train_loss"}
+
+// DefaultRules read the trainer output of the Kaggle and local backends and
+// the epoch lines of the simulation backend
+var DefaultRules = Rules{
+	"kaggle": {{Type: TypeJSON, Require: trainerKeys}},
+	"local":  {{Type: TypeJSON, Require: trainerKeys}},
+	"simulation": {{
+		Type:    TypeRegex,
+		Pattern: `Epoch (?P<epoch>\d+)/(?P<total_epochs>\d+) - loss: (?P<loss>[-+.\deE]+) - accuracy: (?P<accuracy>[-+.\deE]+)`,
+	}},
+}
+
+// counters locate a sample instead of being metrics. They are kept in the
+// job progress but not recorded as points.
+var counters = map[string]bool{
+	"step": true, "global_step": true, "total_steps": true,
+	"epoch": true, "total_epochs": true,
+}
+
+var (
+	mu    sync.RWMutex
+	rules = mustCompile(DefaultRules)
+)
+
+// Init loads the rules from a JSON file mapping backend names (or "*") to
+// lists of rules. An empty path keeps DefaultRules.
+func Init(path string) error {
+	if path == "" {
+		return nil
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return err
+	}
+	var loaded Rules
+	if err := json.Unmarshal(data, &loaded); err != nil {
+		return fmt.Errorf("invalid log metrics rules: %w", err)
+	}
+	compiled, err := compile(loaded)
+	if err != nil {
+		return err
+	}
+
+	mu.Lock()
+	rules = compiled
+	mu.Unlock()
+	return nil
+}
+
+// compile validates rules and compiles their patterns
+func compile(in Rules) (Rules, error) {
+	out := make(Rules, len(in))
+	for backend, list := range in {
+		for i, rule := range list {
+			switch rule.Type {
+			case TypeJSON:
+			case TypeRegex:
+				if rule.Pattern == "" {
+					return nil, fmt.Errorf("%s rule %d: regex rules need a pattern", backend, i)
+				}
+			default:
+				return nil, fmt.Errorf("%s rule %d: type must be %q or %q", backend, i, TypeJSON, TypeRegex)
+			}
+			if rule.Pattern != "" {
+				re, err := regexp.Compile(rule.Pattern)
+				if err != nil {
+					return nil, fmt.Errorf("%s rule %d: %w", backend, i, err)
+				}
+				rule.re = re
+			}
+			out[backend] = append(out[backend], rule)
+		}
+	}
+	return out, nil
+}
+
+func mustCompile(in Rules) Rules {
+	out, err := compile(in)
+	if err != nil {
+		panic(err)
+	}
+	return out
+}
+
+// Sample is the values read from one log line
+type Sample struct {
+	Step   *int64
+	Epoch  *float64
+	Values map[string]float64 // Includes the counters
+}
+
+// Extract applies the rules of a backend, then the "*" rules, to a log line.
+// The first matching rule wins.
+func Extract(backend, line string) (Sample, bool) {
+	mu.RLock()
+	candidates := append(append([]Rule{}, rules[backend]...), rules[AnyBackend]...)
+	mu.RUnlock()
+
+	for _, rule := range candidates {
+		var values map[string]float64
+		switch rule.Type {
+		case TypeJSON:
+			values = rule.extractJSON(line)
+		case TypeRegex:
+			values = rule.extractRegex(line)
+		}
+		if values = rule.filter(values); len(values) == 0 {
+			continue
+		}
+
+		sample := Sample{Values: values}
+		if epoch, ok := values["epoch"]; ok {
+			sample.Epoch = &epoch
+		}
+		for _, key := range []string{"step", "global_step"} {
+			if step, ok := values[key]; ok {
+				s := int64(step)
+				sample.Step = &s
+				break
+			}
+		}
+		return sample, true
+	}
+	return Sample{}, false
+}
+
+// HasRules reports whether any rule applies to a backend
+func HasRules(backend string) bool {
+	mu.RLock()
+	defer mu.RUnlock()
+	return len(rules[backend]) > 0 || len(rules[AnyBackend]) > 0
+}
+
+// pythonLiterals are the Python tokens without a JSON equivalent
+var pythonLiterals = regexp.MustCompile(`\b(nan|inf|True|False|None)\b`)
+
+func (r Rule) extractJSON(line string) map[string]float64 {
+	if r.re != nil && !r.re.MatchString(line) {
+		return nil
+	}
+	start, end := strings.IndexByte(line, '{'), strings.LastIndexByte(line, '}')
+	if start < 0 || end < start {
+		return nil
+	}
+	literal := line[start : end+1]
+
+	var object map[string]interface{}
+	if err := json.Unmarshal([]byte(literal), &object); err != nil {
+		// Python dict: single quotes and bare literals
+		literal = strings.ReplaceAll(literal, "'", `"`)
+		literal = pythonLiterals.ReplaceAllString(literal, "null")
+		if err := json.Unmarshal([]byte(literal), &object); err != nil {
+			return nil
+		}
+	}
+
+	if len(r.Require) > 0 {
+		found := false
+		for _, key := range r.Require {
+			if _, ok := object[key]; ok {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return nil
+		}
+	}
+
+	values := make(map[string]float64)
+	for key, raw := range object {
+		if value, ok := raw.(float64); ok {
+			values[key] = value
+		}
+	}
+	return values
+}
+
+func (r Rule) extractRegex(line string) map[string]float64 {
+	match := r.re.FindStringSubmatch(line)
+	if match == nil {
+		return nil
+	}
+	values := make(map[string]float64)
+	for i, name := range r.re.SubexpNames() {
+		if name == "" || match[i] == "" {
+			continue
+		}
+		if value, err := strconv.ParseFloat(match[i], 64); err == nil {
+			values[name] = value
+		}
+	}
+	return values
+}
+
+// filter keeps the listed metrics, and the counters, when a rule lists any
+func (r Rule) filter(values map[string]float64) map[string]float64 {
+	if len(r.Metrics) == 0 || len(values) == 0 {
+		return values
+	}
+	kept := make(map[string]float64)
+	for name, value := range values {
+		if counters[name] {
+			kept[name] = value
+		}
+	}
+	for _, name := range r.Metrics {
+		if value, ok := values[name]; ok {
+			kept[name] = value
+		}
+	}
+	for name := range kept {
+		if !counters[name] {
+			return kept
+		}
+	}
+	return nil
+}
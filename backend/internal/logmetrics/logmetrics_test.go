@@ -0,0 +1,76 @@
+package logmetrics
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestExtractTrainerDict(t *testing.T) {
+	sample, ok := Extract("kaggle", "{'loss': 1.2345, 'grad_norm': nan, 'learning_rate': 2e-05, 'epoch': 0.12}")
+	if !ok {
+		t.Fatal("trainer line not matched")
+	}
+	if sample.Values["loss"] != 1.2345 || sample.Values["learning_rate"] != 2e-05 {
+		t.Fatalf("unexpected values %v", sample.Values)
+	}
+	if _, ok := sample.Values["grad_norm"]; ok {
+		t.Fatal("nan kept as a value")
+	}
+	if sample.Epoch == nil || *sample.Epoch != 0.12 || sample.Step != nil {
+		t.Fatalf("unexpected location epoch=%v step=%v", sample.Epoch, sample.Step)
+	}
+
+	for _, line := range []string{
+		"{'model_name': 'llama', 'lora_r': 16}",
+		"Loading checkpoint shards: 100%",
+	} {
+		if _, ok := Extract("kaggle", line); ok {
+			t.Errorf("matched %q", line)
+		}
+	}
+}
+
+func TestExtractSimulationLine(t *testing.T) {
+	sample, ok := Extract("simulation", "Epoch 2/3 - loss: 0.4000 - accuracy: 0.6600 (simulated)")
+	if !ok {
+		t.Fatal("simulation line not matched")
+	}
+	if *sample.Epoch != 2 || sample.Values["total_epochs"] != 3 || sample.Values["loss"] != 0.4 || sample.Values["accuracy"] != 0.66 {
+		t.Fatalf("unexpected sample %+v", sample.Values)
+	}
+}
+
+func TestInit(t *testing.T) {
+	defer func() { rules = mustCompile(DefaultRules) }()
+
+	path := filepath.Join(t.TempDir(), "rules.json")
+	config := `{"*": [{"type": "regex", "pattern": "step (?P<step>\\d+) loss (?P<loss>[\\d.]+) lr (?P<lr>[\\d.e-]+)", "metrics": ["loss"]}]}`
+	if err := os.WriteFile(path, []byte(config), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	if err := Init(path); err != nil {
+		t.Fatal(err)
+	}
+
+	sample, ok := Extract("local", "step 40 loss 0.91 lr 1e-4")
+	if !ok || *sample.Step != 40 || sample.Values["loss"] != 0.91 {
+		t.Fatalf("unexpected sample %+v", sample)
+	}
+	if _, ok := sample.Values["lr"]; ok {
+		t.Fatal("metric outside the rule's list kept")
+	}
+
+	for _, invalid := range []string{
+		`{"kaggle": [{"type": "csv"}]}`,
+		`{"kaggle": [{"type": "regex"}]}`,
+		`{"kaggle": [{"type": "regex", "pattern": "("}]}`,
+	} {
+		if err := os.WriteFile(path, []byte(invalid), 0o600); err != nil {
+			t.Fatal(err)
+		}
+		if err := Init(path); err == nil {
+			t.Errorf("accepted %s", invalid)
+		}
+	}
+}
@@ -0,0 +1,137 @@
+package logmetrics
+
+import (
+	"encoding/json"
+	"log"
+
+	"finetune-studio/internal/database"
+	"finetune-studio/internal/events"
+	"finetune-studio/internal/jobs/series"
+	"finetune-studio/internal/models"
+
+	"gorm.io/datatypes"
+)
+
+// ProgressKey is the job metrics field holding the latest values read from
+// the logs. The worker keeps it when it replaces the metrics snapshot.
+const ProgressKey = "progress"
+
+// Process extracts the metrics of newly stored log entries of a job, records
+// them as metric points and merges the latest values into the job progress.
+// Entries are matched against the rules of their source, or of the job
+// backend when there are none for the source. Failures are logged; logs are
+// stored either way.
+func Process(jobID uint, entries []models.LogEntry) {
+	if len(entries) == 0 {
+		return
+	}
+
+	jobBackend := ""
+	progress := make(map[string]float64)
+	for _, entry := range entries {
+		backend := entry.Source
+		if !HasRules(backend) {
+			if jobBackend == "" {
+				database.DB.Model(&models.Job{}).Where("id = ?", jobID).Pluck("backend", &jobBackend)
+			}
+			backend = jobBackend
+		}
+
+		sample, ok := Extract(backend, entry.Message)
+		if !ok {
+			continue
+		}
+		for name, value := range sample.Values {
+			progress[name] = value
+		}
+
+		step, ok := stepOf(jobID, entry.Attempt, sample)
+		if !ok {
+			continue
+		}
+		var points []models.JobMetricPoint
+		for name, value := range sample.Values {
+			if counters[name] {
+				continue
+			}
+			points = append(points, models.JobMetricPoint{
+				JobID:     jobID,
+				Name:      name,
+				Step:      step,
+				Epoch:     sample.Epoch,
+				Attempt:   entry.Attempt,
+				Value:     value,
+				Timestamp: entry.Timestamp,
+			})
+		}
+		if _, err := series.Record(points); err != nil {
+			log.Printf("[Job %d] Failed to record metric points from logs: %v", jobID, err)
+		}
+	}
+
+	if len(progress) > 0 {
+		updateProgress(jobID, progress)
+	}
+}
+
+// stepOf places a sample of a run. Lines without a step, like the trainer's,
+// are numbered by epoch: the step is one more than the number of earlier
+// epochs of the run already recorded, so ingesting a line twice yields the
+// same step and evaluation lines share the step of the training line of their
+// epoch. The steps of a retry follow those of the earlier runs.
+func stepOf(jobID uint, attempt int, sample Sample) (int64, bool) {
+	if sample.Step == nil && sample.Epoch == nil {
+		return 0, false
+	}
+
+	var offset int64
+	if attempt > 1 {
+		err := database.DB.Model(&models.JobMetricPoint{}).
+			Where("job_id = ? AND attempt > 0 AND attempt < ?", jobID, attempt).
+			Select("COALESCE(MAX(step), 0)").
+			Scan(&offset).Error
+		if err != nil {
+			log.Printf("[Job %d] Failed to number metric points: %v", jobID, err)
+			return 0, false
+		}
+	}
+	if sample.Step != nil {
+		return offset + *sample.Step, true
+	}
+
+	var earlier int64
+	err := database.DB.Model(&models.JobMetricPoint{}).
+		Where("job_id = ? AND attempt = ? AND epoch < ?", jobID, attempt, *sample.Epoch).
+		Distinct("epoch").
+		Count(&earlier).Error
+	if err != nil {
+		log.Printf("[Job %d] Failed to number metric points: %v", jobID, err)
+		return 0, false
+	}
+	return offset + earlier + 1, true
+}
+
+// updateProgress merges values into the progress field of the job metrics
+// and publishes the new metrics to stream clients
+func updateProgress(jobID uint, values map[string]float64) {
+	progressJSON, _ := json.Marshal(values)
+
+	var updated struct {
+		Metrics datatypes.JSON
+	}
+	err := database.DB.Raw(`
+		UPDATE jobs SET metrics = jsonb_set(
+			CASE WHEN jsonb_typeof(metrics) = 'object' THEN metrics ELSE '{}'::jsonb END,
+			'{`+ProgressKey+`}',
+			CASE WHEN jsonb_typeof(metrics->'`+ProgressKey+`') = 'object' THEN metrics->'`+ProgressKey+`' ELSE '{}'::jsonb END || ?::jsonb
+		)
+		WHERE id = ? AND deleted_at IS NULL
+		RETURNING metrics`, string(progressJSON), jobID).Scan(&updated).Error
+	if err != nil {
+		log.Printf("[Job %d] Failed to update progress from logs: %v", jobID, err)
+		return
+	}
+	if len(updated.Metrics) > 0 {
+		events.Default.Publish(events.Event{Type: events.TypeMetrics, JobID: jobID, Metrics: json.RawMessage(updated.Metrics)})
+	}
+}
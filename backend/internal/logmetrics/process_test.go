@@ -0,0 +1,40 @@
+package logmetrics
+
+import (
+	"fmt"
+	"testing"
+	"time"
+
+	"finetune-studio/internal/database"
+	"finetune-studio/internal/database/databasetest"
+	"finetune-studio/internal/models"
+)
+
+func TestProcessNumbersRetriesAfterEarlierRuns(t *testing.T) {
+	databasetest.Open(t)
+
+	run := func(attempt int, epochs ...float64) []models.LogEntry {
+		var entries []models.LogEntry
+		for _, epoch := range epochs {
+			entries = append(entries, models.LogEntry{
+				JobID:     1,
+				Source:    "kaggle",
+				Attempt:   attempt,
+				Message:   fmt.Sprintf("{'loss': %g, 'epoch': %g}", 2-epoch/10, epoch),
+				Timestamp: time.Now(),
+			})
+		}
+		return entries
+	}
+
+	Process(1, run(1, 0.5, 1.0))
+	Process(1, run(2, 0.5, 1.0, 1.5))
+	// Ingested again, e.g. from the aggregated logs
+	Process(1, run(2, 1.5))
+
+	var steps []int64
+	database.DB.Model(&models.JobMetricPoint{}).Where("job_id = 1 AND name = 'loss'").Order("step").Pluck("step", &steps)
+	if fmt.Sprint(steps) != "[1 2 3 4 5]" {
+		t.Fatalf("loss recorded at steps %v, want [1 2 3 4 5]", steps)
+	}
+}
@@ -1,6 +1,8 @@
 package models
 
 import (
+	"time"
+
 	"gorm.io/datatypes"
 	"gorm.io/gorm"
 )
@@ -9,10 +11,26 @@ type Dataset struct {
 	gorm.Model
 	Name              string         `json:"name"`
 	Description       string         `json:"description"`
-	FilePath          string         `json:"file_path"` // Path in MinIO
-	Type              string         `json:"type"`      // csv, json
+	FilePath          string         `json:"file_path"`                 // Path in MinIO
+	ContentHash       string         `json:"content_hash" gorm:"index"` // SHA-256 of the file content
+	Type              string         `json:"type"`                      // csv, json
 	NumExamples       int            `json:"num_examples"`
 	AvgLength         float64        `json:"avg_length"`
 	ValidationStatus  string         `json:"validation_status"` // valid, warning, error
 	ValidationDetails datatypes.JSON `json:"validation_details"`
 }
+
+// KaggleDataset maps dataset content, or the LoRA adapters of a parent model,
+// to the Kaggle dataset version holding it, so jobs on the same content reuse
+// the upload. Uploads sharing a lineage (the dataset name, or the parent
+// model) are versions of the same Kaggle dataset.
+type KaggleDataset struct {
+	ID          uint      `json:"id" gorm:"primarykey"`
+	Account     string    `json:"account" gorm:"uniqueIndex:idx_kaggle_datasets_hash;index:idx_kaggle_datasets_lineage"`
+	ContentHash string    `json:"content_hash" gorm:"uniqueIndex:idx_kaggle_datasets_hash"`
+	Lineage     string    `json:"lineage" gorm:"index:idx_kaggle_datasets_lineage"`
+	Ref         string    `json:"ref"` // owner/slug
+	Version     int       `json:"version"`
+	DatasetID   uint      `json:"dataset_id"` // Dataset the version was uploaded for, 0 for adapters
+	CreatedAt   time.Time `json:"created_at"`
+}
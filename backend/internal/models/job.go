@@ -1,6 +1,8 @@
 package models
 
 import (
+	"time"
+
 	"gorm.io/datatypes"
 	"gorm.io/gorm"
 )
@@ -9,8 +11,83 @@ type Job struct {
 	gorm.Model
 	DatasetID      uint           `json:"dataset_id"`
 	Dataset        Dataset        `json:"dataset"`
-	Status         string         `json:"status"` // pending, starting, running, completed, failed, cancelled
+	Status         string         `json:"status" gorm:"<-:create;index"` // See jobs/statemachine; only changed through statemachine.Transition
 	Configuration  datatypes.JSON `json:"configuration"`
 	Metrics        datatypes.JSON `json:"metrics"`
+	Backend        string         `json:"backend"`     // kaggle, local, simulation
+	RunRef         string         `json:"run_ref"`     // Backend-specific run reference
+	RunAttempt     int            `json:"run_attempt"` // Attempt that submitted the run
+	StartedAt      *time.Time     `json:"started_at"`
+	DeadlineAt     *time.Time     `json:"deadline_at"`     // Job is timed out past this point
+	Attempts       int            `json:"attempts"`        // Number of times the job was started
+	NextAttemptAt  *time.Time     `json:"next_attempt_at"` // Earliest time a retrying job may be claimed
 	KaggleKernelID string         `json:"kaggle_kernel_id"`
+	KaggleAccount  string         `json:"kaggle_account,omitempty"` // Account the kernel runs on
+
+	// Scheduling: higher priorities are claimed first, then jobs of the
+	// project (or submitter, without a project) with the fewest active jobs
+	Priority  int    `json:"priority" gorm:"not null;default:0"`
+	Submitter string `json:"submitter" gorm:"not null;default:''"`
+	Project   string `json:"project" gorm:"not null;default:''"`
+
+	// Preset the configuration was built from, if any
+	PresetID      *uint `json:"preset_id,omitempty" gorm:"index"`
+	PresetVersion int   `json:"preset_version,omitempty"`
+
+	// Sweep the job is a trial of, if any
+	SweepID     *uint          `json:"sweep_id,omitempty" gorm:"index"`
+	SweepParams datatypes.JSON `json:"sweep_params,omitempty"` // Hyperparameters picked for this trial
+
+	// Model whose LoRA adapters training continues from, if any
+	ParentModelID *uint `json:"parent_model_id,omitempty" gorm:"index"`
+
+	// Schedule that created the job, if any
+	ScheduleID *uint `json:"schedule_id,omitempty" gorm:"index"`
+
+	// Pipeline the job is the training step of, if any
+	PipelineID *uint `json:"pipeline_id,omitempty" gorm:"index"`
+
+	// SHA-256 of the dataset content the job trains on. Backends refuse other
+	// content, so a clone trains on the same dataset version as its source.
+	DatasetHash string `json:"dataset_hash,omitempty"`
+
+	// Rendered notebook pushed to Kaggle, stored in the jobs bucket
+	NotebookPath    string `json:"notebook_path,omitempty"`
+	TemplateVersion string `json:"template_version,omitempty"`
+
+	// Job this one was cloned from, if any
+	SourceJobID *uint `json:"source_job_id,omitempty" gorm:"index"`
+	// Rendered notebook of the source job used as template instead of the
+	// current one, so a clone runs the same template version
+	TemplateNotebook string `json:"template_notebook,omitempty"`
+
+	// Queue lease, only written by the queue package so that saving a job
+	// never overwrites a concurrent heartbeat
+	LeaseOwner     string     `json:"lease_owner" gorm:"<-:false;index"`
+	LeaseExpiresAt *time.Time `json:"lease_expires_at" gorm:"<-:false;index"`
+	HeartbeatAt    *time.Time `json:"heartbeat_at" gorm:"<-:false"`
+}
+
+// JobEvent records one job status transition
+type JobEvent struct {
+	ID         uint      `json:"id" gorm:"primarykey"`
+	JobID      uint      `json:"job_id" gorm:"index"`
+	FromStatus string    `json:"from_status"`
+	ToStatus   string    `json:"to_status"`
+	Actor      string    `json:"actor"`
+	Reason     string    `json:"reason"`
+	CreatedAt  time.Time `json:"created_at"`
+}
+
+// JobMetricPoint is one value of a training metric series, such as the loss
+// logged at a training step
+type JobMetricPoint struct {
+	ID        uint      `json:"id" gorm:"primarykey"`
+	JobID     uint      `json:"job_id" gorm:"uniqueIndex:idx_job_metric_points_series,priority:1"`
+	Name      string    `json:"name" gorm:"uniqueIndex:idx_job_metric_points_series,priority:2"`
+	Step      int64     `json:"step" gorm:"uniqueIndex:idx_job_metric_points_series,priority:3"`
+	Epoch     *float64  `json:"epoch,omitempty"`
+	Attempt   int       `json:"attempt,omitempty"` // Run the point was read from, for points from the logs
+	Value     float64   `json:"value"`
+	Timestamp time.Time `json:"timestamp"`
 }
@@ -0,0 +1,31 @@
+package models
+
+import (
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// KaggleAccount is a Kaggle account jobs can run on. The API key is stored
+// encrypted with the secrets package and never serialized.
+type KaggleAccount struct {
+	gorm.Model
+	Username             string  `json:"username" gorm:"uniqueIndex:idx_kaggle_accounts_username,where:deleted_at IS NULL"`
+	EncryptedKey         string  `json:"-"`
+	Enabled              bool    `json:"enabled"`
+	WeeklyGPUHours       float64 `json:"weekly_gpu_hours"`
+	MaxConcurrentKernels int     `json:"max_concurrent_kernels"`
+}
+
+// KaggleSession is a kernel run counted against the GPU quota of a Kaggle
+// account. It is opened when the scheduler admits a job, before the kernel is
+// pushed, and closed when the kernel finishes.
+type KaggleSession struct {
+	ID         uint       `json:"id" gorm:"primarykey"`
+	Account    string     `json:"account" gorm:"index"`
+	JobID      uint       `json:"job_id" gorm:"index"`
+	KernelRef  string     `json:"kernel_ref"`
+	ReservedAt time.Time  `json:"reserved_at"`
+	StartedAt  *time.Time `json:"started_at"` // First poll that saw the kernel running
+	FinishedAt *time.Time `json:"finished_at" gorm:"index"`
+}
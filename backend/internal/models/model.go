@@ -15,6 +15,7 @@ type Model struct {
 	Type             string         `json:"type"`
 	JobID            *uint          `json:"job_id"`
 	Job              *Job           `json:"job,omitempty"`
+	ParentModelID    *uint          `json:"parent_model_id,omitempty" gorm:"index"` // Model whose adapters training continued from
 	StoragePath      string         `json:"storage_path"`
 	LoRAAdaptersPath string         `json:"lora_adapters_path"`
 	GGUFPath         string         `json:"gguf_path"`
@@ -22,6 +23,7 @@ type Model struct {
 	TrainingMetrics  datatypes.JSON `json:"training_metrics"`
 	EvalResults      datatypes.JSON `json:"eval_results"`
 	Status           string         `json:"status"`
+	Production       bool           `json:"production" gorm:"index"` // Serving model of its base model, set by pipeline promotion
 	TotalSize        int64          `json:"total_size"`
 }
 
@@ -46,5 +48,6 @@ type LogEntry struct {
 	Level     string    `json:"level"`
 	Message   string    `json:"message"`
 	Source    string    `json:"source"`
+	Attempt   int       `json:"attempt,omitempty"` // Attempt whose backend run printed the line
 	Timestamp time.Time `json:"timestamp"`
 }
@@ -0,0 +1,65 @@
+package models
+
+import (
+	"time"
+
+	"gorm.io/datatypes"
+	"gorm.io/gorm"
+)
+
+// Pipeline is one run of the training pipeline: validate the dataset, split
+// off a holdout set, train, check the GGUF export, evaluate against the
+// holdout set and promote the model if it beats the production model
+type Pipeline struct {
+	gorm.Model
+	Name          string         `json:"name"`
+	DatasetID     uint           `json:"dataset_id"`
+	PresetID      *uint          `json:"preset_id,omitempty"`
+	PresetVersion int            `json:"preset_version,omitempty"`
+	Configuration datatypes.JSON `json:"configuration"` // Resolved configuration of the training job
+
+	HoldoutFraction float64 `json:"holdout_fraction"` // Share of the examples kept for evaluation
+	Seed            int64   `json:"seed"`             // Shuffle seed of the split
+	Metric          string  `json:"metric"`           // Evaluation metric compared to the production model
+	Goal            string  `json:"goal"`             // minimize, maximize
+
+	Priority  int    `json:"priority"`
+	Submitter string `json:"submitter"`
+	Project   string `json:"project"`
+
+	Status string `json:"status" gorm:"index"` // pending, running, succeeded, failed, cancelled
+
+	// Filled in as the steps run
+	TrainDatasetID   *uint `json:"train_dataset_id,omitempty"`
+	HoldoutDatasetID *uint `json:"holdout_dataset_id,omitempty"`
+	JobID            *uint `json:"job_id,omitempty"`
+	ModelID          *uint `json:"model_id,omitempty"`
+	EvaluationID     *uint `json:"evaluation_id,omitempty"`
+	Promoted         bool  `json:"promoted"`
+
+	Steps []PipelineStep `json:"steps,omitempty"`
+}
+
+// PipelineStep is one task of a pipeline, run by whichever replica claims it
+// once the steps it depends on have succeeded
+type PipelineStep struct {
+	ID            uint           `json:"id" gorm:"primarykey"`
+	PipelineID    uint           `json:"pipeline_id" gorm:"index"`
+	Name          string         `json:"name"`
+	DependsOn     datatypes.JSON `json:"depends_on"` // Names of the steps that must succeed first
+	Status        string         `json:"status"`     // pending, running, retrying, succeeded, failed, skipped, cancelled
+	Attempts      int            `json:"attempts"`
+	MaxAttempts   int            `json:"max_attempts"`
+	NextAttemptAt *time.Time     `json:"next_attempt_at,omitempty" gorm:"index"` // Retry, or next check of a step waiting on a job
+	Output        datatypes.JSON `json:"output,omitempty"`
+	Error         string         `json:"error,omitempty"`
+	StartedAt     *time.Time     `json:"started_at,omitempty"`
+	FinishedAt    *time.Time     `json:"finished_at,omitempty"`
+	CreatedAt     time.Time      `json:"created_at"`
+	UpdatedAt     time.Time      `json:"updated_at"`
+
+	// Lease of the replica running the step, only written by the pipelines
+	// package
+	LeaseOwner     string     `json:"-" gorm:"<-:false"`
+	LeaseExpiresAt *time.Time `json:"-" gorm:"<-:false;index"`
+}
@@ -0,0 +1,28 @@
+package models
+
+import (
+	"time"
+
+	"gorm.io/datatypes"
+	"gorm.io/gorm"
+)
+
+// Preset is a named training configuration. Every update creates a new
+// PresetVersion so jobs keep pointing at the exact configuration they used.
+type Preset struct {
+	gorm.Model
+	Name          string         `json:"name" gorm:"uniqueIndex:idx_presets_name,where:deleted_at IS NULL"`
+	Description   string         `json:"description"`
+	Version       int            `json:"version"`       // Latest version
+	Configuration datatypes.JSON `json:"configuration"` // Configuration of the latest version
+}
+
+// PresetVersion is an immutable snapshot of a preset configuration
+type PresetVersion struct {
+	ID            uint           `json:"id" gorm:"primarykey"`
+	PresetID      uint           `json:"preset_id" gorm:"uniqueIndex:idx_preset_versions_version"`
+	Version       int            `json:"version" gorm:"uniqueIndex:idx_preset_versions_version"`
+	Description   string         `json:"description"`
+	Configuration datatypes.JSON `json:"configuration"`
+	CreatedAt     time.Time      `json:"created_at"`
+}
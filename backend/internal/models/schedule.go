@@ -0,0 +1,48 @@
+package models
+
+import (
+	"time"
+
+	"gorm.io/datatypes"
+	"gorm.io/gorm"
+)
+
+// Schedule creates jobs from a preset on a cron schedule, always against the
+// latest dataset uploaded under DatasetName
+type Schedule struct {
+	gorm.Model
+	Name          string         `json:"name" gorm:"uniqueIndex:idx_schedules_name,where:deleted_at IS NULL"`
+	Cron          string         `json:"cron"`     // Five-field cron expression, see schedules.ParseCron
+	Timezone      string         `json:"timezone"` // IANA name the cron expression is evaluated in
+	PresetID      uint           `json:"preset_id"`
+	PresetVersion int            `json:"preset_version"` // 0 follows the latest version
+	DatasetName   string         `json:"dataset_name"`
+	Configuration datatypes.JSON `json:"configuration"` // Overrides applied on top of the preset
+
+	Priority  int    `json:"priority"`
+	Submitter string `json:"submitter"`
+	Project   string `json:"project"`
+
+	// SkipUnchanged skips a run when the dataset content is the one the last
+	// successful run trained on
+	SkipUnchanged bool       `json:"skip_unchanged"`
+	Paused        bool       `json:"paused"`
+	NextRunAt     *time.Time `json:"next_run_at" gorm:"index"` // Nil while paused
+	LastRunAt     *time.Time `json:"last_run_at"`
+}
+
+// ScheduleRun is one firing of a schedule
+type ScheduleRun struct {
+	ID           uint      `json:"id" gorm:"primarykey"`
+	ScheduleID   uint      `json:"schedule_id" gorm:"index"`
+	ScheduledFor time.Time `json:"scheduled_for"`
+	Status       string    `json:"status"` // created, skipped, failed
+	Reason       string    `json:"reason,omitempty"`
+	JobID        *uint     `json:"job_id,omitempty"`
+	DatasetID    *uint     `json:"dataset_id,omitempty"`
+	ContentHash  string    `json:"content_hash,omitempty"` // Dataset content the job trains on
+	CreatedAt    time.Time `json:"created_at"`
+
+	// Status of the job, filled when listing runs
+	JobStatus string `json:"job_status,omitempty" gorm:"-"`
+}
@@ -0,0 +1,21 @@
+package models
+
+import (
+	"gorm.io/datatypes"
+	"gorm.io/gorm"
+)
+
+// Sweep is a hyperparameter search fanned out as one child job per trial
+type Sweep struct {
+	gorm.Model
+	Name              string         `json:"name"`
+	DatasetID         uint           `json:"dataset_id"`
+	Dataset           Dataset        `json:"dataset"`
+	Strategy          string         `json:"strategy"`           // grid, random
+	SearchSpace       datatypes.JSON `json:"search_space"`       // See sweeps.Space
+	BaseConfiguration datatypes.JSON `json:"base_configuration"` // Configuration shared by every trial
+	MaxConcurrency    int            `json:"max_concurrency"`    // Children running at the same time
+	Metric            string         `json:"metric"`             // Metric children are ranked by
+	Goal              string         `json:"goal"`               // minimize, maximize
+	Jobs              []Job          `json:"jobs,omitempty"`
+}
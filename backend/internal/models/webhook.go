@@ -0,0 +1,50 @@
+package models
+
+import (
+	"time"
+
+	"gorm.io/datatypes"
+	"gorm.io/gorm"
+)
+
+// Webhook is an endpoint events are delivered to. Payloads are signed with
+// the secret, stored encrypted with the secrets package and never serialized.
+type Webhook struct {
+	gorm.Model
+	URL             string         `json:"url"`
+	Description     string         `json:"description"`
+	EncryptedSecret string         `json:"-"`
+	Events          datatypes.JSON `json:"events"` // Event types or "job.*" style patterns; empty matches every event
+	Enabled         bool           `json:"enabled"`
+}
+
+// OutboxEvent is an event recorded in the transaction of the change it
+// describes, waiting to be fanned out to the matching webhooks
+type OutboxEvent struct {
+	ID           uint           `json:"id" gorm:"primarykey"`
+	Type         string         `json:"type" gorm:"index"`
+	Payload      datatypes.JSON `json:"payload"`
+	CreatedAt    time.Time      `json:"created_at"`
+	DispatchedAt *time.Time     `json:"dispatched_at,omitempty" gorm:"index"`
+}
+
+// WebhookDelivery is one event sent to one webhook, with its retries
+type WebhookDelivery struct {
+	ID             uint       `json:"id" gorm:"primarykey"`
+	WebhookID      uint       `json:"webhook_id" gorm:"uniqueIndex:idx_webhook_deliveries_event"`
+	EventID        uint       `json:"event_id" gorm:"uniqueIndex:idx_webhook_deliveries_event"`
+	EventType      string     `json:"event_type"`
+	Status         string     `json:"status" gorm:"index"` // pending, delivered, failed
+	Attempts       int        `json:"attempts"`
+	NextAttemptAt  *time.Time `json:"next_attempt_at,omitempty" gorm:"index"`
+	ResponseStatus int        `json:"response_status,omitempty"` // HTTP status of the last attempt
+	LastError      string     `json:"last_error,omitempty"`
+	DeliveredAt    *time.Time `json:"delivered_at,omitempty"`
+	CreatedAt      time.Time  `json:"created_at"`
+	UpdatedAt      time.Time  `json:"updated_at"`
+
+	// Lease of the replica sending the delivery, only written by the webhooks
+	// package
+	LeaseOwner     string     `json:"-" gorm:"<-:false"`
+	LeaseExpiresAt *time.Time `json:"-" gorm:"<-:false;index"`
+}
@@ -0,0 +1,185 @@
+// Package notebook renders the Kaggle finetune notebook for a job. The
+// template marks the cells to replace with papermill-style tags: the
+// "parameters" cell receives the job configuration and the "prompt_format"
+// cell the formatting function of the chosen prompt format.
+package notebook
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	"finetune-studio/internal/jobs/trainingconfig"
+	"finetune-studio/internal/storage"
+
+	"github.com/minio/minio-go/v7"
+)
+
+// Bucket holds the rendered notebook of each job under {jobID}/notebook.ipynb
+const Bucket = "jobs"
+
+// Template is a parsed notebook template
+type Template struct {
+	// Version is the template_version from the notebook metadata followed by
+	// a hash of the template content, so edits without a version bump show up
+	Version string
+
+	doc   map[string]json.RawMessage
+	cells []map[string]json.RawMessage
+}
+
+// Load reads and parses a notebook template
+func Load(path string) (*Template, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read notebook template: %v", err)
+	}
+	return Parse(data)
+}
+
+// LoadStored parses a notebook rendered for an earlier job as a template. The
+// tagged cells are kept when rendering, so they are replaced again.
+func LoadStored(ctx context.Context, objectName string) (*Template, error) {
+	obj, err := storage.Client.GetObject(ctx, Bucket, objectName, minio.GetObjectOptions{})
+	if err != nil {
+		return nil, fmt.Errorf("failed to read notebook %s: %w", objectName, err)
+	}
+	defer obj.Close()
+
+	data, err := io.ReadAll(obj)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read notebook %s: %w", objectName, err)
+	}
+	return Parse(data)
+}
+
+// Parse parses a notebook template
+func Parse(data []byte) (*Template, error) {
+	var doc map[string]json.RawMessage
+	if err := json.Unmarshal(data, &doc); err != nil {
+		return nil, fmt.Errorf("invalid notebook template: %v", err)
+	}
+
+	var cells []map[string]json.RawMessage
+	if err := json.Unmarshal(doc["cells"], &cells); err != nil {
+		return nil, fmt.Errorf("invalid notebook template cells: %v", err)
+	}
+
+	var metadata struct {
+		FinetuneStudio struct {
+			TemplateVersion string `json:"template_version"`
+		} `json:"finetune_studio"`
+	}
+	json.Unmarshal(doc["metadata"], &metadata)
+
+	sum := sha256.Sum256(data)
+	version := hex.EncodeToString(sum[:])[:12]
+	if v := metadata.FinetuneStudio.TemplateVersion; v != "" {
+		version = v + "@" + version
+	}
+
+	t := &Template{Version: version, doc: doc, cells: cells}
+	if t.findCell("parameters") < 0 {
+		return nil, fmt.Errorf("notebook template has no cell tagged \"parameters\"")
+	}
+	return t, nil
+}
+
+// Render returns the notebook with the training configuration, the dataset
+// location and the prompt format injected. adaptersPath is the directory of
+// the LoRA adapters training continues from, empty to start fresh adapters.
+func (t *Template) Render(cfg trainingconfig.TrainingConfig, datasetPath, adaptersPath string) ([]byte, error) {
+	prompt, ok := promptFormats[cfg.PromptFormat]
+	if !ok {
+		return nil, fmt.Errorf("unknown prompt_format %q", cfg.PromptFormat)
+	}
+
+	cells := make([]map[string]json.RawMessage, len(t.cells))
+	for i, cell := range t.cells {
+		copied := make(map[string]json.RawMessage, len(cell))
+		for k, v := range cell {
+			copied[k] = v
+		}
+		cells[i] = copied
+	}
+
+	if err := setSource(cells[t.findCell("parameters")], parametersSource(cfg, datasetPath, adaptersPath)); err != nil {
+		return nil, err
+	}
+	if i := t.findCell("prompt_format"); i >= 0 {
+		if err := setSource(cells[i], "# Prompt format: "+cfg.PromptFormat+"\n"+prompt); err != nil {
+			return nil, err
+		}
+	}
+
+	doc := make(map[string]json.RawMessage, len(t.doc))
+	for k, v := range t.doc {
+		doc[k] = v
+	}
+	cellsJSON, err := marshal(cells, "")
+	if err != nil {
+		return nil, err
+	}
+	doc["cells"] = cellsJSON
+
+	return marshal(doc, " ")
+}
+
+// marshal encodes v without escaping HTML characters, which would make the
+// Python source in the notebook hard to read
+func marshal(v interface{}, indent string) ([]byte, error) {
+	var buf bytes.Buffer
+	enc := json.NewEncoder(&buf)
+	enc.SetEscapeHTML(false)
+	if indent != "" {
+		enc.SetIndent("", indent)
+	}
+	if err := enc.Encode(v); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// findCell returns the index of the first cell carrying tag, or -1
+func (t *Template) findCell(tag string) int {
+	for i, cell := range t.cells {
+		var metadata struct {
+			Tags []string `json:"tags"`
+		}
+		json.Unmarshal(cell["metadata"], &metadata)
+		for _, cellTag := range metadata.Tags {
+			if cellTag == tag {
+				return i
+			}
+		}
+	}
+	return -1
+}
+
+// setSource replaces the source of a cell, split into lines as Jupyter stores it
+func setSource(cell map[string]json.RawMessage, source string) error {
+	lines := strings.SplitAfter(source, "\n")
+	data, err := marshal(lines, "")
+	if err != nil {
+		return err
+	}
+	cell["source"] = data
+	return nil
+}
+
+// Store uploads a rendered notebook next to the job and returns its object path
+func Store(ctx context.Context, jobID uint, notebook []byte) (string, error) {
+	objectName := fmt.Sprintf("%d/notebook.ipynb", jobID)
+	_, err := storage.Client.PutObject(ctx, Bucket, objectName, bytes.NewReader(notebook), int64(len(notebook)),
+		minio.PutObjectOptions{ContentType: "application/x-ipynb+json"})
+	if err != nil {
+		return "", fmt.Errorf("failed to store rendered notebook: %w", err)
+	}
+	return objectName, nil
+}
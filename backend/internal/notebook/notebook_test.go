@@ -0,0 +1,217 @@
+package notebook
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"finetune-studio/internal/jobs/trainingconfig"
+	"finetune-studio/internal/storage"
+
+	"github.com/minio/minio-go/v7"
+	"github.com/minio/minio-go/v7/pkg/credentials"
+)
+
+const template = `{
+ "metadata": {"finetune_studio": {"template_version": "3"}},
+ "nbformat": 4,
+ "cells": [
+  {"cell_type": "markdown", "metadata": {}, "source": ["# Finetune\n"]},
+  {"cell_type": "code", "metadata": {"tags": ["parameters"]}, "source": ["MODEL_NAME = \"placeholder\"\n"]},
+  {"cell_type": "code", "metadata": {"tags": ["prompt_format"]}, "source": ["def formatting_prompts_func(examples): pass\n"]},
+  {"cell_type": "code", "metadata": {}, "source": ["trainer.train()\n"]}
+ ]
+}`
+
+// sources returns the source of each cell of a notebook
+func sources(t *testing.T, notebook []byte) []string {
+	t.Helper()
+	var doc struct {
+		Cells []struct {
+			Source []string `json:"source"`
+		} `json:"cells"`
+	}
+	if err := json.Unmarshal(notebook, &doc); err != nil {
+		t.Fatalf("rendered notebook is not JSON: %v", err)
+	}
+	out := make([]string, len(doc.Cells))
+	for i, cell := range doc.Cells {
+		out[i] = strings.Join(cell.Source, "")
+	}
+	return out
+}
+
+func contains(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
+
+func TestRender(t *testing.T) {
+	tmpl, err := Parse([]byte(template))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	cfg := trainingconfig.Default()
+	cfg.LearningRate = 0.0002
+	cfg.Epochs = 3
+	cfg.PromptFormat = "alpaca"
+
+	tests := []struct {
+		name         string
+		adaptersPath string
+		want         []string
+	}{
+		{"fresh adapters", "", []string{
+			`MODEL_NAME = "` + cfg.ModelID() + `"`,
+			"LEARNING_RATE = 0.0002",
+			"EPOCHS = 3",
+			`DATASET_PATH = "/kaggle/input/job-1-dataset/data.json"`,
+			`PROMPT_FORMAT = "alpaca"`,
+			"PARENT_ADAPTERS_PATH = None",
+		}},
+		{"continued adapters", "/kaggle/input/model-4-adapters", []string{
+			`PARENT_ADAPTERS_PATH = "/kaggle/input/model-4-adapters"`,
+		}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rendered, err := tmpl.Render(cfg, "/kaggle/input/job-1-dataset/data.json", tt.adaptersPath)
+			if err != nil {
+				t.Fatal(err)
+			}
+			cells := sources(t, rendered)
+			if len(cells) != 4 || cells[0] != "# Finetune\n" || cells[3] != "trainer.train()\n" {
+				t.Fatalf("untagged cells changed: %q", cells)
+			}
+			lines := strings.Split(cells[1], "\n")
+			for _, line := range tt.want {
+				if !contains(lines, line) {
+					t.Errorf("parameters cell lacks %q:\n%s", line, cells[1])
+				}
+			}
+			if strings.Contains(cells[1], "placeholder") {
+				t.Error("template parameters kept")
+			}
+			if !strings.HasPrefix(cells[2], "# Prompt format: alpaca\n") || !strings.Contains(cells[2], "ALPACA_PROMPT") {
+				t.Errorf("prompt format cell not replaced:\n%s", cells[2])
+			}
+		})
+	}
+}
+
+func TestRenderErrors(t *testing.T) {
+	tests := []struct {
+		name         string
+		template     string
+		promptFormat string
+		invalidParse bool
+	}{
+		{"unknown prompt format", template, "limerick", false},
+		{"no parameters cell", `{"cells": [{"cell_type": "code", "metadata": {"tags": ["setup"]}, "source": []}]}`, "text", true},
+		{"not a notebook", `{"cells": 1}`, "text", true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tmpl, err := Parse([]byte(tt.template))
+			if tt.invalidParse {
+				if err == nil {
+					t.Fatal("parsed")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			cfg := trainingconfig.Default()
+			cfg.PromptFormat = tt.promptFormat
+			if _, err := tmpl.Render(cfg, "data.json", ""); err == nil {
+				t.Fatal("rendered")
+			}
+		})
+	}
+}
+
+func TestVersion(t *testing.T) {
+	unversioned := strings.Replace(template, `"finetune_studio": {"template_version": "3"}`, `"kernelspec": {}`, 1)
+	edited := strings.Replace(template, "trainer.train()", "trainer.train(resume_from_checkpoint = True)", 1)
+
+	tests := []struct {
+		name     string
+		template string
+		prefix   string
+	}{
+		{"template_version", template, "3@"},
+		{"no template_version", unversioned, ""},
+		{"edited without a bump", edited, "3@"},
+	}
+	versions := make(map[string]bool)
+	for _, tt := range tests {
+		tmpl, err := Parse([]byte(tt.template))
+		if err != nil {
+			t.Fatal(err)
+		}
+		hash := strings.TrimPrefix(tmpl.Version, tt.prefix)
+		if !strings.HasPrefix(tmpl.Version, tt.prefix) || len(hash) != 12 || strings.Contains(hash, "@") {
+			t.Errorf("%s: version %q", tt.name, tmpl.Version)
+		}
+		versions[tmpl.Version] = true
+	}
+	if len(versions) != len(tests) {
+		t.Fatalf("versions collide: %v", versions)
+	}
+}
+
+func TestLoadStoredRendersAgain(t *testing.T) {
+	tmpl, _ := Parse([]byte(template))
+	cfg := trainingconfig.Default()
+	cfg.PromptFormat = "text"
+	stored, err := tmpl.Render(cfg, "/kaggle/input/first/data.json", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/"+Bucket+"/1/notebook.ipynb" {
+			http.Error(w, "not found", http.StatusNotFound)
+			return
+		}
+		w.Header().Set("Content-Type", "application/x-ipynb+json")
+		w.Header().Set("ETag", `"d41d8cd98f00b204e9800998ecf8427e"`)
+		w.Header().Set("Last-Modified", time.Now().UTC().Format(http.TimeFormat))
+		w.Write(stored)
+	}))
+	defer server.Close()
+	client, err := minio.New(strings.TrimPrefix(server.URL, "http://"), &minio.Options{
+		Creds:  credentials.NewStaticV4("", "", ""),
+		Region: "us-east-1",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	previous := storage.Client
+	storage.Client = client
+	defer func() { storage.Client = previous }()
+
+	reloaded, err := LoadStored(context.Background(), "1/notebook.ipynb")
+	if err != nil {
+		t.Fatal(err)
+	}
+	cfg.PromptFormat = "chat"
+	rendered, err := reloaded.Render(cfg, "/kaggle/input/second/data.json", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	cells := sources(t, rendered)
+	if !strings.Contains(cells[1], `DATASET_PATH = "/kaggle/input/second/data.json"`) || !strings.HasPrefix(cells[2], "# Prompt format: chat\n") {
+		t.Fatalf("stored notebook not rendered again: %q", cells)
+	}
+}
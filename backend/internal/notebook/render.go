@@ -0,0 +1,108 @@
+package notebook
+
+import (
+	"strconv"
+	"strings"
+
+	"finetune-studio/internal/jobs/trainingconfig"
+)
+
+// parametersSource renders the training configuration as Python assignments
+func parametersSource(cfg trainingconfig.TrainingConfig, datasetPath, adaptersPath string) string {
+	parentAdapters := "None"
+	if adaptersPath != "" {
+		parentAdapters = pyString(adaptersPath)
+	}
+
+	lines := []string{
+		"# Parameters",
+		"# Rendered from the job configuration",
+		"MODEL_NAME = " + pyString(cfg.ModelID()),
+		"MAX_SEQ_LENGTH = " + strconv.Itoa(cfg.MaxSeqLength),
+		"LOAD_IN_4BIT = " + pyBool(cfg.Quantization == "4bit"),
+		"LOAD_IN_8BIT = " + pyBool(cfg.Quantization == "8bit"),
+		"LORA_R = " + strconv.Itoa(cfg.LoraRank),
+		"LORA_ALPHA = " + strconv.Itoa(cfg.LoraAlpha),
+		"LORA_DROPOUT = " + pyFloat(cfg.LoraDropout),
+		"TARGET_MODULES = " + pyStringList(cfg.TargetModules),
+		"LEARNING_RATE = " + pyFloat(cfg.LearningRate),
+		"BATCH_SIZE = " + strconv.Itoa(cfg.BatchSize),
+		"GRADIENT_ACCUMULATION_STEPS = " + strconv.Itoa(cfg.GradientAccumulationSteps),
+		"MAX_STEPS = " + strconv.Itoa(cfg.MaxSteps),
+		"EPOCHS = " + strconv.Itoa(cfg.Epochs),
+		"SEED = " + strconv.Itoa(cfg.Seed),
+		"DATASET_PATH = " + pyString(datasetPath),
+		"PROMPT_FORMAT = " + pyString(cfg.PromptFormat),
+		"PARENT_ADAPTERS_PATH = " + parentAdapters,
+	}
+	return strings.Join(lines, "\n")
+}
+
+// promptFormats maps each of trainingconfig.PromptFormats to the Python
+// function turning a batch of dataset rows into training text
+var promptFormats = map[string]string{
+	// {"text": ..., "label": ...} rows, the original sentiment dataset layout
+	"sentiment": `def formatting_prompts_func(examples):
+    outputs = []
+    for text, label in zip(examples["text"], examples["label"]):
+        outputs.append(f"Sentiment Analysis:\nInput: {text}\nOutput: {label}")
+    return { "text" : outputs, }`,
+
+	// {"instruction": ..., "input": ..., "output": ...} rows
+	"alpaca": `ALPACA_PROMPT = """Below is an instruction that describes a task, paired with an input that provides further context. Write a response that appropriately completes the request.
+
+### Instruction:
+{}
+
+### Input:
+{}
+
+### Response:
+{}"""
+
+def formatting_prompts_func(examples):
+    inputs = examples["input"] if "input" in examples else [""] * len(examples["instruction"])
+    outputs = []
+    for instruction, input, output in zip(examples["instruction"], inputs, examples["output"]):
+        outputs.append(ALPACA_PROMPT.format(instruction, input, output) + tokenizer.eos_token)
+    return { "text" : outputs, }`,
+
+	// {"messages": [{"role": ..., "content": ...}]} rows, rendered with the model chat template
+	"chat": `def formatting_prompts_func(examples):
+    outputs = []
+    for messages in examples["messages"]:
+        outputs.append(tokenizer.apply_chat_template(messages, tokenize = False, add_generation_prompt = False))
+    return { "text" : outputs, }`,
+
+	// {"text": ...} rows used as they are
+	"text": `def formatting_prompts_func(examples):
+    return { "text" : [text + tokenizer.eos_token for text in examples["text"]], }`,
+}
+
+func pyString(s string) string {
+	data, _ := marshal(s, "")
+	return strings.TrimSuffix(string(data), "\n")
+}
+
+func pyBool(b bool) string {
+	if b {
+		return "True"
+	}
+	return "False"
+}
+
+func pyFloat(f float64) string {
+	s := strconv.FormatFloat(f, 'g', -1, 64)
+	if !strings.ContainsAny(s, ".e") {
+		s += ".0"
+	}
+	return s
+}
+
+func pyStringList(values []string) string {
+	quoted := make([]string, len(values))
+	for i, v := range values {
+		quoted[i] = pyString(v)
+	}
+	return "[" + strings.Join(quoted, ", ") + "]"
+}
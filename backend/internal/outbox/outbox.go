@@ -0,0 +1,75 @@
+// Package outbox records domain events in the same transaction as the change
+// they describe. The webhooks dispatcher delivers them afterwards, so an event
+// is never lost when the process dies between the commit and the delivery.
+package outbox
+
+import (
+	"encoding/json"
+	"time"
+
+	"finetune-studio/internal/models"
+
+	"gorm.io/datatypes"
+	"gorm.io/gorm"
+)
+
+// Event types besides job.<status>
+const (
+	JobCreated          = "job.created"
+	EvaluationCreated   = "evaluation.created"
+	EvaluationCompleted = "evaluation.completed"
+	EvaluationFailed    = "evaluation.failed"
+	ModelReady          = "model.ready"
+	ModelFailed         = "model.failed"
+	ModelPromoted       = "model.promoted"
+)
+
+// Add records an event in tx. It is only visible to the dispatcher once tx
+// commits.
+func Add(tx *gorm.DB, eventType string, data interface{}) error {
+	payload, err := json.Marshal(data)
+	if err != nil {
+		return err
+	}
+	return tx.Create(&models.OutboxEvent{
+		Type:      eventType,
+		Payload:   datatypes.JSON(payload),
+		CreatedAt: time.Now(),
+	}).Error
+}
+
+// EvaluationStatus returns the event of an evaluation moving to status, or
+// "" when the status has no event
+func EvaluationStatus(status string) string {
+	switch status {
+	case "completed":
+		return EvaluationCompleted
+	case "failed":
+		return EvaluationFailed
+	}
+	return ""
+}
+
+// Evaluation is the payload of evaluation events
+func Evaluation(evaluation *models.Evaluation) map[string]interface{} {
+	return map[string]interface{}{
+		"evaluation_id": evaluation.ID,
+		"model_id":      evaluation.ModelID,
+		"job_id":        evaluation.JobID,
+		"status":        evaluation.Status,
+		"results":       evaluation.Results,
+		"error_message": evaluation.ErrorMessage,
+	}
+}
+
+// Model is the payload of model events
+func Model(model *models.Model) map[string]interface{} {
+	return map[string]interface{}{
+		"model_id":   model.ID,
+		"job_id":     model.JobID,
+		"name":       model.Name,
+		"base_model": model.BaseModel,
+		"status":     model.Status,
+		"production": model.Production,
+	}
+}
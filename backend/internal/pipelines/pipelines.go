@@ -0,0 +1,440 @@
+// Package pipelines runs multi-step training pipelines. A pipeline is a DAG
+// of steps stored in the database; every replica runs a Runner that leases
+// ready steps with SKIP LOCKED, so each step runs on one replica at a time
+// and is retried with backoff when it fails on something transient.
+package pipelines
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"sync"
+	"time"
+
+	"finetune-studio/internal/database"
+	"finetune-studio/internal/jobs/retry"
+	"finetune-studio/internal/models"
+	"finetune-studio/internal/queue"
+
+	"gorm.io/datatypes"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// Pipeline statuses
+const (
+	StatusPending   = "pending"
+	StatusRunning   = "running"
+	StatusSucceeded = "succeeded"
+	StatusFailed    = "failed"
+	StatusCancelled = "cancelled"
+)
+
+// Step statuses
+const (
+	StepPending   = "pending"
+	StepRunning   = "running" // Also while waiting on a training job or an evaluation
+	StepRetrying  = "retrying"
+	StepSucceeded = "succeeded"
+	StepFailed    = "failed"
+	StepSkipped   = "skipped" // A step it depends on failed
+	StepCancelled = "cancelled"
+)
+
+// Step names
+const (
+	StepValidate    = "validate"
+	StepSplit       = "split"
+	StepTrain       = "train"
+	StepCheckExport = "check_export"
+	StepEvaluate    = "evaluate"
+	StepPromote     = "promote"
+
+	// Name of the export check in pipelines created before it was renamed
+	legacyStepExport = "export"
+)
+
+// Steps is the DAG every pipeline runs, each step with the steps it depends
+// on. The GGUF export check and the evaluation both follow training. The
+// export itself is done by the training notebook; the pipeline only checks
+// the model came with one.
+var Steps = []struct {
+	Name      string
+	DependsOn []string
+}{
+	{StepValidate, nil},
+	{StepSplit, []string{StepValidate}},
+	{StepTrain, []string{StepSplit}},
+	{StepCheckExport, []string{StepTrain}},
+	{StepEvaluate, []string{StepTrain}},
+	{StepPromote, []string{StepCheckExport, StepEvaluate}},
+}
+
+const (
+	// DefaultInterval is how often the runner looks for ready steps, and how
+	// often a step waiting on a job or an evaluation checks it again
+	DefaultInterval = 15 * time.Second
+
+	// DefaultEvaluationTimeout is how long the evaluate step waits for the
+	// holdout evaluation to be reported
+	DefaultEvaluationTimeout = 24 * time.Hour
+
+	// stepLease bounds a single execution of a step; a replica that dies
+	// mid-step loses the step to another one after it
+	stepLease = 10 * time.Minute
+)
+
+// ErrNotRetryable is returned by Retry for a pipeline that has not failed
+var ErrNotRetryable = errors.New("only failed pipelines can be retried")
+
+// Create inserts a pipeline and its steps
+func Create(tx *gorm.DB, pipeline *models.Pipeline) error {
+	pipeline.Status = StatusPending
+	if err := tx.Omit("Steps").Create(pipeline).Error; err != nil {
+		return err
+	}
+
+	maxAttempts := retry.DefaultPolicy().MaxAttempts
+	pipeline.Steps = make([]models.PipelineStep, len(Steps))
+	for i, def := range Steps {
+		dependsOn, _ := json.Marshal(append([]string{}, def.DependsOn...))
+		pipeline.Steps[i] = models.PipelineStep{
+			PipelineID:  pipeline.ID,
+			Name:        def.Name,
+			DependsOn:   datatypes.JSON(dependsOn),
+			Status:      StepPending,
+			MaxAttempts: maxAttempts,
+		}
+	}
+	return tx.Create(&pipeline.Steps).Error
+}
+
+// Retry puts the failed steps of a pipeline, and the steps skipped behind
+// them, back in the queue with fresh attempts
+func Retry(pipelineID uint) error {
+	return database.DB.Transaction(func(tx *gorm.DB) error {
+		var pipeline models.Pipeline
+		if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).First(&pipeline, pipelineID).Error; err != nil {
+			return err
+		}
+		if pipeline.Status != StatusFailed {
+			return ErrNotRetryable
+		}
+
+		err := tx.Model(&models.PipelineStep{}).
+			Where("pipeline_id = ? AND status IN ?", pipeline.ID, []string{StepFailed, StepSkipped}).
+			Updates(map[string]interface{}{
+				"status":          StepPending,
+				"attempts":        0,
+				"error":           "",
+				"next_attempt_at": nil,
+				"finished_at":     nil,
+			}).Error
+		if err != nil {
+			return err
+		}
+		return tx.Model(&pipeline).Update("status", StatusRunning).Error
+	})
+}
+
+// Cancel stops scheduling the steps of a pipeline. A step being run finishes
+// its current execution but its outcome is discarded. The training job, if
+// any, is left to the caller.
+func Cancel(pipelineID uint) error {
+	return database.DB.Transaction(func(tx *gorm.DB) error {
+		err := tx.Model(&models.PipelineStep{}).
+			Where("pipeline_id = ? AND status IN ?", pipelineID, []string{StepPending, StepRunning, StepRetrying}).
+			Updates(map[string]interface{}{"status": StepCancelled, "next_attempt_at": nil, "finished_at": time.Now()}).Error
+		if err != nil {
+			return err
+		}
+		return tx.Model(&models.Pipeline{}).Where("id = ?", pipelineID).Update("status", StatusCancelled).Error
+	})
+}
+
+// IsFinished reports whether a pipeline status is final
+func IsFinished(status string) bool {
+	return status == StatusSucceeded || status == StatusFailed || status == StatusCancelled
+}
+
+// Runner executes ready pipeline steps
+type Runner struct {
+	Owner             string
+	Interval          time.Duration
+	JobTimeout        time.Duration // Default deadline of the training jobs created
+	EvaluationTimeout time.Duration
+
+	// OnJobCreated is called after a training job was created, to wake a worker
+	OnJobCreated func()
+
+	ctx    context.Context
+	cancel context.CancelFunc
+	wg     sync.WaitGroup
+}
+
+func NewRunner(interval, jobTimeout time.Duration, onJobCreated func()) *Runner {
+	ctx, cancel := context.WithCancel(context.Background())
+	return &Runner{
+		Owner:             queue.DefaultOwner(),
+		Interval:          interval,
+		JobTimeout:        jobTimeout,
+		EvaluationTimeout: DefaultEvaluationTimeout,
+		OnJobCreated:      onJobCreated,
+		ctx:               ctx,
+		cancel:            cancel,
+	}
+}
+
+func (r *Runner) Start() {
+	r.wg.Add(1)
+	go func() {
+		defer r.wg.Done()
+		ticker := time.NewTicker(r.Interval)
+		defer ticker.Stop()
+		for {
+			if _, err := r.RunReady(); err != nil {
+				log.Printf("[Pipelines] Failed to run ready steps: %v", err)
+			}
+			select {
+			case <-r.ctx.Done():
+				return
+			case <-ticker.C:
+			}
+		}
+	}()
+	log.Printf("🔗 Pipeline runner started, checking every %s", r.Interval)
+}
+
+func (r *Runner) Stop() {
+	r.cancel()
+	r.wg.Wait()
+}
+
+// RunReady runs every step that is ready now and returns how many ran
+func (r *Runner) RunReady() (int, error) {
+	ran := 0
+	for r.ctx.Err() == nil {
+		step, err := r.claim(time.Now())
+		if err != nil {
+			return ran, err
+		}
+		if step == nil {
+			return ran, nil
+		}
+		r.execute(step)
+		ran++
+	}
+	return ran, nil
+}
+
+// claim leases the next step whose dependencies have all succeeded and that
+// is due: new, due for a retry, or due to check its job or evaluation again
+func (r *Runner) claim(now time.Time) (*models.PipelineStep, error) {
+	var step models.PipelineStep
+	err := database.DB.Transaction(func(tx *gorm.DB) error {
+		result := tx.Clauses(clause.Locking{Strength: "UPDATE", Options: "SKIP LOCKED"}).
+			Where("status IN ?", []string{StepPending, StepRunning, StepRetrying}).
+			Where("lease_expires_at IS NULL OR lease_expires_at < ?", now).
+			Where("next_attempt_at IS NULL OR next_attempt_at <= ?", now).
+			Where(`NOT EXISTS (SELECT 1 FROM pipeline_steps AS dep WHERE dep.pipeline_id = pipeline_steps.pipeline_id
+				AND dep.status <> ? AND dep.name IN (SELECT jsonb_array_elements_text(pipeline_steps.depends_on)))`, StepSucceeded).
+			Order("id").
+			Limit(1).
+			Find(&step)
+		if result.Error != nil || result.RowsAffected == 0 {
+			return result.Error
+		}
+		return tx.Exec("UPDATE pipeline_steps SET lease_owner = ?, lease_expires_at = ? WHERE id = ?",
+			r.Owner, now.Add(stepLease), step.ID).Error
+	})
+	if err != nil || step.ID == 0 {
+		return nil, err
+	}
+	return &step, nil
+}
+
+// execute runs a leased step once and records the outcome
+func (r *Runner) execute(step *models.PipelineStep) {
+	var pipeline models.Pipeline
+	if err := database.DB.First(&pipeline, step.PipelineID).Error; err != nil {
+		log.Printf("[Pipeline %d] Failed to load pipeline for step %s: %v", step.PipelineID, step.Name, err)
+		r.release(step)
+		return
+	}
+
+	// Checks of a waiting step are not new attempts
+	if step.Status != StepRunning {
+		now := time.Now()
+		step.Attempts++
+		step.Status = StepRunning
+		step.StartedAt = &now
+		database.DB.Model(step).Select("attempts", "status", "started_at").Updates(step)
+		if pipeline.Status == StatusPending {
+			database.DB.Model(&pipeline).Where("status = ?", StatusPending).Update("status", StatusRunning)
+		}
+		log.Printf("[Pipeline %d] Step %s started (attempt %d/%d)", pipeline.ID, step.Name, step.Attempts, step.MaxAttempts)
+	}
+
+	ctx, cancel := context.WithTimeout(r.ctx, stepLease)
+	defer cancel()
+
+	output, wait, err := r.run(ctx, &pipeline, step)
+	if err := r.finish(&pipeline, step, output, wait, err); err != nil {
+		log.Printf("[Pipeline %d] Failed to record step %s: %v", pipeline.ID, step.Name, err)
+		r.release(step)
+	}
+}
+
+func (r *Runner) run(ctx context.Context, pipeline *models.Pipeline, step *models.PipelineStep) (map[string]interface{}, bool, error) {
+	switch step.Name {
+	case StepValidate:
+		return r.validate(ctx, pipeline)
+	case StepSplit:
+		return r.split(ctx, pipeline)
+	case StepTrain:
+		return r.train(pipeline)
+	case StepCheckExport, legacyStepExport:
+		return r.checkExport(pipeline)
+	case StepEvaluate:
+		return r.evaluate(pipeline)
+	case StepPromote:
+		return r.promote(pipeline)
+	}
+	return nil, false, retry.Wrap(retry.ClassPermanent, fmt.Errorf("unknown step %q", step.Name))
+}
+
+// finish records the outcome of an execution: waiting steps are checked
+// again after the interval, transient failures are retried with the default
+// backoff, and any other failure skips the steps that depend on this one
+func (r *Runner) finish(pipeline *models.Pipeline, step *models.PipelineStep, output map[string]interface{}, wait bool, runErr error) error {
+	now := time.Now()
+	updates := map[string]interface{}{"error": ""}
+	if output != nil {
+		outputJSON, _ := json.Marshal(output)
+		updates["output"] = datatypes.JSON(outputJSON)
+	}
+
+	switch {
+	case runErr == nil && wait:
+		updates["status"] = StepRunning
+		updates["next_attempt_at"] = now.Add(r.Interval)
+	case runErr == nil:
+		updates["status"] = StepSucceeded
+		updates["next_attempt_at"] = nil
+		updates["finished_at"] = now
+		log.Printf("[Pipeline %d] Step %s succeeded", pipeline.ID, step.Name)
+	default:
+		policy := retry.DefaultPolicy()
+		class := retry.Classify(runErr)
+		updates["error"] = runErr.Error()
+		if policy.Retryable(class) && step.Attempts < step.MaxAttempts {
+			delay := policy.Backoff(step.Attempts)
+			updates["status"] = StepRetrying
+			updates["next_attempt_at"] = now.Add(delay)
+			log.Printf("[Pipeline %d] Step %s RETRYING in %s after transient %s error: %v", pipeline.ID, step.Name, delay, class, runErr)
+		} else {
+			updates["status"] = StepFailed
+			updates["next_attempt_at"] = nil
+			updates["finished_at"] = now
+			log.Printf("[Pipeline %d] Step %s FAILED: %v", pipeline.ID, step.Name, runErr)
+		}
+	}
+
+	return database.DB.Transaction(func(tx *gorm.DB) error {
+		// Serialises the status updates of the steps of one pipeline
+		if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).Select("id").First(&models.Pipeline{}, pipeline.ID).Error; err != nil {
+			return err
+		}
+
+		result := tx.Model(&models.PipelineStep{}).
+			Where("id = ? AND lease_owner = ? AND status <> ?", step.ID, r.Owner, StepCancelled).
+			Updates(updates)
+		if result.Error != nil {
+			return result.Error
+		}
+		if err := tx.Exec("UPDATE pipeline_steps SET lease_owner = NULL, lease_expires_at = NULL WHERE id = ? AND lease_owner = ?",
+			step.ID, r.Owner).Error; err != nil {
+			return err
+		}
+		// Cancelled, or the lease expired and another replica took over
+		if result.RowsAffected == 0 {
+			return nil
+		}
+
+		if updates["status"] == StepFailed {
+			if err := skipDependents(tx, pipeline.ID, step.Name); err != nil {
+				return err
+			}
+		}
+		return refreshStatus(tx, pipeline.ID)
+	})
+}
+
+// release gives up the lease on a step without recording anything
+func (r *Runner) release(step *models.PipelineStep) {
+	database.DB.Exec("UPDATE pipeline_steps SET lease_owner = NULL, lease_expires_at = NULL WHERE id = ? AND lease_owner = ?",
+		step.ID, r.Owner)
+}
+
+// skipDependents marks every step downstream of a failed step as skipped.
+// Steps on other branches keep running.
+func skipDependents(tx *gorm.DB, pipelineID uint, failed string) error {
+	var steps []models.PipelineStep
+	if err := tx.Select("id", "name", "depends_on", "status").Where("pipeline_id = ?", pipelineID).Find(&steps).Error; err != nil {
+		return err
+	}
+
+	blocked := map[string]bool{failed: true}
+	var skipped []uint
+	for changed := true; changed; {
+		changed = false
+		for _, step := range steps {
+			if blocked[step.Name] {
+				continue
+			}
+			var dependsOn []string
+			json.Unmarshal(step.DependsOn, &dependsOn)
+			for _, dep := range dependsOn {
+				if blocked[dep] {
+					blocked[step.Name] = true
+					changed = true
+					if step.Status == StepPending {
+						skipped = append(skipped, step.ID)
+					}
+					break
+				}
+			}
+		}
+	}
+	if len(skipped) == 0 {
+		return nil
+	}
+	return tx.Model(&models.PipelineStep{}).Where("id IN ?", skipped).Update("status", StepSkipped).Error
+}
+
+// refreshStatus derives the status of a pipeline from its steps: failed as
+// soon as a step failed, succeeded once every step has. Cancelled pipelines
+// keep their status.
+func refreshStatus(tx *gorm.DB, pipelineID uint) error {
+	var statuses []string
+	if err := tx.Model(&models.PipelineStep{}).Where("pipeline_id = ?", pipelineID).Pluck("status", &statuses).Error; err != nil {
+		return err
+	}
+
+	status := StatusSucceeded
+	for _, s := range statuses {
+		if s == StepFailed {
+			status = StatusFailed
+			break
+		}
+		if s != StepSucceeded {
+			status = StatusRunning
+		}
+	}
+
+	return tx.Model(&models.Pipeline{}).
+		Where("id = ? AND status <> ?", pipelineID, StatusCancelled).
+		Update("status", status).Error
+}
@@ -0,0 +1,227 @@
+package pipelines
+
+import (
+	"encoding/json"
+	"errors"
+	"testing"
+	"time"
+
+	"finetune-studio/internal/database"
+	"finetune-studio/internal/database/databasetest"
+	"finetune-studio/internal/jobs/retry"
+	"finetune-studio/internal/models"
+
+	"gorm.io/gorm"
+)
+
+func TestStepsFormADAG(t *testing.T) {
+	// Every step depends only on steps listed before it, so the DAG has no
+	// cycle and a step's dependencies always exist
+	seen := make(map[string]bool)
+	for _, step := range Steps {
+		if seen[step.Name] {
+			t.Fatalf("step %s listed twice", step.Name)
+		}
+		for _, dep := range step.DependsOn {
+			if !seen[dep] {
+				t.Errorf("step %s depends on %s, which does not come before it", step.Name, dep)
+			}
+		}
+		seen[step.Name] = true
+	}
+}
+
+// newPipeline creates a pipeline and returns its steps by name
+func newPipeline(t *testing.T) (*models.Pipeline, map[string]models.PipelineStep) {
+	t.Helper()
+	pipeline := &models.Pipeline{Name: "weekly"}
+	if err := Create(database.DB, pipeline); err != nil {
+		t.Fatal(err)
+	}
+	return pipeline, stepsOf(t, pipeline.ID)
+}
+
+func stepsOf(t *testing.T, pipelineID uint) map[string]models.PipelineStep {
+	t.Helper()
+	var steps []models.PipelineStep
+	if err := database.DB.Where("pipeline_id = ?", pipelineID).Find(&steps).Error; err != nil {
+		t.Fatal(err)
+	}
+	byName := make(map[string]models.PipelineStep, len(steps))
+	for _, step := range steps {
+		byName[step.Name] = step
+	}
+	return byName
+}
+
+// finishStep records the outcome of one execution of a step as the runner
+// holding its lease
+func finishStep(t *testing.T, r *Runner, pipeline *models.Pipeline, step models.PipelineStep, runErr error) {
+	t.Helper()
+	database.DB.Exec("UPDATE pipeline_steps SET lease_owner = ?, attempts = attempts + 1 WHERE id = ?", r.Owner, step.ID)
+	step.Attempts++
+	if err := r.finish(pipeline, &step, nil, false, runErr); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func pipelineStatus(t *testing.T, pipelineID uint) string {
+	t.Helper()
+	var pipeline models.Pipeline
+	if err := database.DB.First(&pipeline, pipelineID).Error; err != nil {
+		t.Fatal(err)
+	}
+	return pipeline.Status
+}
+
+func TestCreateStoresTheDAG(t *testing.T) {
+	databasetest.Open(t)
+	pipeline, steps := newPipeline(t)
+
+	if pipeline.Status != StatusPending || len(steps) != len(Steps) {
+		t.Fatalf("pipeline %s with %d steps", pipeline.Status, len(steps))
+	}
+	for _, def := range Steps {
+		step := steps[def.Name]
+		var dependsOn []string
+		if err := json.Unmarshal(step.DependsOn, &dependsOn); err != nil {
+			t.Fatalf("step %s depends on %s: %v", def.Name, step.DependsOn, err)
+		}
+		if step.Status != StepPending || len(dependsOn) != len(def.DependsOn) || step.MaxAttempts != retry.DefaultPolicy().MaxAttempts {
+			t.Errorf("unexpected step %+v", step)
+		}
+	}
+}
+
+func TestFailedStepSkipsItsBranch(t *testing.T) {
+	databasetest.Open(t)
+	r := NewRunner(time.Minute, time.Hour, nil)
+	pipeline, steps := newPipeline(t)
+
+	for _, name := range []string{StepValidate, StepSplit, StepTrain} {
+		finishStep(t, r, pipeline, steps[name], nil)
+	}
+	if status := pipelineStatus(t, pipeline.ID); status != StatusRunning {
+		t.Fatalf("pipeline %s after training", status)
+	}
+
+	finishStep(t, r, pipeline, steps[StepEvaluate], retry.Wrap(retry.ClassPermanent, errors.New("holdout set is empty")))
+
+	steps = stepsOf(t, pipeline.ID)
+	want := map[string]string{
+		StepTrain:       StepSucceeded,
+		StepEvaluate:    StepFailed,
+		StepCheckExport: StepPending, // Another branch
+		StepPromote:     StepSkipped,
+	}
+	for name, status := range want {
+		if steps[name].Status != status {
+			t.Errorf("step %s is %s, want %s", name, steps[name].Status, status)
+		}
+	}
+	if steps[StepEvaluate].Error != "holdout set is empty" {
+		t.Errorf("step error %q", steps[StepEvaluate].Error)
+	}
+	if status := pipelineStatus(t, pipeline.ID); status != StatusFailed {
+		t.Fatalf("pipeline %s, want failed", status)
+	}
+
+	// Retry queues the failed step and what it blocked again
+	if err := Retry(pipeline.ID); err != nil {
+		t.Fatal(err)
+	}
+	steps = stepsOf(t, pipeline.ID)
+	if steps[StepEvaluate].Status != StepPending || steps[StepEvaluate].Attempts != 0 || steps[StepPromote].Status != StepPending || steps[StepTrain].Status != StepSucceeded {
+		t.Fatalf("steps after retry: evaluate %s (%d attempts), promote %s, train %s",
+			steps[StepEvaluate].Status, steps[StepEvaluate].Attempts, steps[StepPromote].Status, steps[StepTrain].Status)
+	}
+	if status := pipelineStatus(t, pipeline.ID); status != StatusRunning {
+		t.Fatalf("pipeline %s after retry", status)
+	}
+	if err := Retry(pipeline.ID); !errors.Is(err, ErrNotRetryable) {
+		t.Fatalf("retrying a running pipeline returned %v", err)
+	}
+}
+
+func TestTransientStepFailureIsRetried(t *testing.T) {
+	databasetest.Open(t)
+	r := NewRunner(time.Minute, time.Hour, nil)
+	pipeline, steps := newPipeline(t)
+
+	finishStep(t, r, pipeline, steps[StepValidate], retry.Wrap(retry.ClassNetwork, errors.New("connection reset")))
+
+	step := stepsOf(t, pipeline.ID)[StepValidate]
+	if step.Status != StepRetrying || step.NextAttemptAt == nil || !step.NextAttemptAt.After(time.Now()) {
+		t.Fatalf("transient failure not retried: %+v", step)
+	}
+	if stepsOf(t, pipeline.ID)[StepSplit].Status != StepPending {
+		t.Fatal("dependent of a retrying step skipped")
+	}
+
+	// Out of attempts
+	database.DB.Model(&models.PipelineStep{}).Where("id = ?", step.ID).Update("attempts", step.MaxAttempts-1)
+	step.Attempts = step.MaxAttempts - 1
+	finishStep(t, r, pipeline, step, retry.Wrap(retry.ClassNetwork, errors.New("connection reset")))
+	steps = stepsOf(t, pipeline.ID)
+	if steps[StepValidate].Status != StepFailed || steps[StepSplit].Status != StepSkipped || steps[StepPromote].Status != StepSkipped {
+		t.Fatalf("validate %s, split %s, promote %s", steps[StepValidate].Status, steps[StepSplit].Status, steps[StepPromote].Status)
+	}
+}
+
+func TestCancelledStepKeepsItsStatus(t *testing.T) {
+	databasetest.Open(t)
+	r := NewRunner(time.Minute, time.Hour, nil)
+	pipeline, steps := newPipeline(t)
+
+	if err := Cancel(pipeline.ID); err != nil {
+		t.Fatal(err)
+	}
+	// An execution that was already under way finishes after the cancel
+	finishStep(t, r, pipeline, steps[StepValidate], nil)
+
+	if step := stepsOf(t, pipeline.ID)[StepValidate]; step.Status != StepCancelled {
+		t.Fatalf("cancelled step is %s", step.Status)
+	}
+	if status := pipelineStatus(t, pipeline.ID); status != StatusCancelled || !IsFinished(status) {
+		t.Fatalf("cancelled pipeline is %s", status)
+	}
+}
+
+func TestTrainForgetsFailedJobBeforeFailing(t *testing.T) {
+	db := databasetest.Open(t)
+	r := NewRunner(time.Minute, time.Hour, nil)
+
+	job := models.Job{Status: "failed"}
+	database.DB.Create(&job)
+	pipeline := &models.Pipeline{Name: "weekly", JobID: &job.ID}
+	if err := Create(database.DB, pipeline); err != nil {
+		t.Fatal(err)
+	}
+
+	// The database refuses to forget the job
+	lost := errors.New("connection lost")
+	failing := true
+	db.Callback().Update().Before("gorm:update").Register("test:fail_pipelines", func(tx *gorm.DB) {
+		if failing && tx.Statement.Table == "pipelines" {
+			tx.AddError(lost)
+		}
+	})
+
+	if _, _, err := r.train(pipeline); !errors.Is(err, lost) {
+		t.Fatalf("train returned %v, want the failed update", err)
+	}
+	var stored models.Pipeline
+	database.DB.First(&stored, pipeline.ID)
+	if stored.JobID == nil || *stored.JobID != job.ID {
+		t.Fatalf("pipeline job is %v", stored.JobID)
+	}
+
+	failing = false
+	if _, _, err := r.train(pipeline); retry.Classify(err) != retry.ClassRunFailed {
+		t.Fatalf("train returned %v, want the job failure", err)
+	}
+	database.DB.First(&stored, pipeline.ID)
+	if stored.JobID != nil {
+		t.Fatalf("failed job %d still recorded", *stored.JobID)
+	}
+}
@@ -0,0 +1,102 @@
+package pipelines
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"math/rand"
+)
+
+// split shuffles the examples of a JSON dataset with seed and returns the
+// training and holdout parts in the layout of the dataset: a JSON array, a
+// CUAD document split by title, or JSON Lines. Each part keeps the original
+// order of its examples.
+func split(content []byte, fraction float64, seed int64) (train, holdout []byte, err error) {
+	trimmed := bytes.TrimSpace(content)
+
+	switch {
+	case bytes.HasPrefix(trimmed, []byte("[")):
+		var examples []json.RawMessage
+		if err := json.Unmarshal(trimmed, &examples); err != nil {
+			return nil, nil, fmt.Errorf("invalid JSON array: %v", err)
+		}
+		trainExamples, holdoutExamples, err := splitExamples(examples, fraction, seed)
+		if err != nil {
+			return nil, nil, err
+		}
+		train, _ = json.Marshal(trainExamples)
+		holdout, _ = json.Marshal(holdoutExamples)
+		return train, holdout, nil
+
+	case bytes.HasPrefix(trimmed, []byte("{")) && json.Valid(trimmed):
+		// Whole documents go to one side so their questions don't leak
+		var document map[string]json.RawMessage
+		var entries []json.RawMessage
+		if err := json.Unmarshal(trimmed, &document); err != nil || json.Unmarshal(document["data"], &entries) != nil || len(entries) == 0 {
+			return nil, nil, errors.New("JSON object datasets must be CUAD documents with a data list")
+		}
+		trainEntries, holdoutEntries, err := splitExamples(entries, fraction, seed)
+		if err != nil {
+			return nil, nil, err
+		}
+		document["data"], _ = json.Marshal(trainEntries)
+		train, _ = json.Marshal(document)
+		document["data"], _ = json.Marshal(holdoutEntries)
+		holdout, _ = json.Marshal(document)
+		return train, holdout, nil
+
+	default:
+		var lines []json.RawMessage
+		for i, line := range bytes.Split(trimmed, []byte("\n")) {
+			line = bytes.TrimSpace(line)
+			if len(line) == 0 {
+				continue
+			}
+			if !json.Valid(line) {
+				return nil, nil, fmt.Errorf("line %d is not valid JSON", i+1)
+			}
+			lines = append(lines, line)
+		}
+		trainLines, holdoutLines, err := splitExamples(lines, fraction, seed)
+		if err != nil {
+			return nil, nil, err
+		}
+		return joinLines(trainLines), joinLines(holdoutLines), nil
+	}
+}
+
+// splitExamples puts round(fraction * n) examples, at least one, in the
+// holdout part and keeps at least one for training
+func splitExamples(examples []json.RawMessage, fraction float64, seed int64) (train, holdout []json.RawMessage, err error) {
+	n := len(examples)
+	if n < 2 {
+		return nil, nil, fmt.Errorf("splitting needs at least 2 examples, the dataset has %d", n)
+	}
+
+	size := int(math.Round(float64(n) * fraction))
+	size = max(1, min(size, n-1))
+
+	inHoldout := make(map[int]bool, size)
+	for _, i := range rand.New(rand.NewSource(seed)).Perm(n)[:size] {
+		inHoldout[i] = true
+	}
+	for i, example := range examples {
+		if inHoldout[i] {
+			holdout = append(holdout, example)
+		} else {
+			train = append(train, example)
+		}
+	}
+	return train, holdout, nil
+}
+
+func joinLines(lines []json.RawMessage) []byte {
+	var buf bytes.Buffer
+	for _, line := range lines {
+		buf.Write(line)
+		buf.WriteByte('\n')
+	}
+	return buf.Bytes()
+}
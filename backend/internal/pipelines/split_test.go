@@ -0,0 +1,96 @@
+package pipelines
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"testing"
+)
+
+func TestSplitJSONArray(t *testing.T) {
+	var examples []string
+	for i := 0; i < 20; i++ {
+		examples = append(examples, fmt.Sprintf(`{"text":"example %d","label":"positive"}`, i))
+	}
+	content := []byte("[" + strings.Join(examples, ",") + "]")
+
+	train, holdout, err := split(content, 0.25, 42)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var trainExamples, holdoutExamples []map[string]string
+	if err := json.Unmarshal(train, &trainExamples); err != nil {
+		t.Fatalf("train part is not a JSON array: %v", err)
+	}
+	if err := json.Unmarshal(holdout, &holdoutExamples); err != nil {
+		t.Fatalf("holdout part is not a JSON array: %v", err)
+	}
+	if len(trainExamples) != 15 || len(holdoutExamples) != 5 {
+		t.Fatalf("got %d train and %d holdout examples, want 15 and 5", len(trainExamples), len(holdoutExamples))
+	}
+
+	seen := make(map[string]bool)
+	for _, example := range append(trainExamples, holdoutExamples...) {
+		if seen[example["text"]] {
+			t.Fatalf("%q is in both parts", example["text"])
+		}
+		seen[example["text"]] = true
+	}
+
+	// The same seed gives the same split
+	train2, holdout2, _ := split(content, 0.25, 42)
+	if !bytes.Equal(train, train2) || !bytes.Equal(holdout, holdout2) {
+		t.Fatal("split is not deterministic for a given seed")
+	}
+}
+
+func TestSplitJSONLines(t *testing.T) {
+	content := []byte("{\"text\":\"a\"}\n{\"text\":\"b\"}\n\n{\"text\":\"c\"}\n{\"text\":\"d\"}\n")
+
+	train, holdout, err := split(content, 0.1, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := bytes.Count(train, []byte("\n")); got != 3 {
+		t.Errorf("train part has %d lines, want 3", got)
+	}
+	// At least one example is held out
+	if got := bytes.Count(holdout, []byte("\n")); got != 1 {
+		t.Errorf("holdout part has %d lines, want 1", got)
+	}
+}
+
+func TestSplitCUADKeepsDocumentsWhole(t *testing.T) {
+	content := []byte(`{"version":"v1","data":[
+		{"title":"a","paragraphs":[]},
+		{"title":"b","paragraphs":[]},
+		{"title":"c","paragraphs":[]}]}`)
+
+	train, holdout, err := split(content, 0.5, 7)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var trainDoc, holdoutDoc struct {
+		Version string            `json:"version"`
+		Data    []json.RawMessage `json:"data"`
+	}
+	json.Unmarshal(train, &trainDoc)
+	json.Unmarshal(holdout, &holdoutDoc)
+	if trainDoc.Version != "v1" || holdoutDoc.Version != "v1" {
+		t.Error("document fields are not kept in both parts")
+	}
+	if len(trainDoc.Data)+len(holdoutDoc.Data) != 3 || len(holdoutDoc.Data) != 2 {
+		t.Fatalf("got %d train and %d holdout documents, want 1 and 2", len(trainDoc.Data), len(holdoutDoc.Data))
+	}
+}
+
+func TestSplitErrors(t *testing.T) {
+	for _, content := range []string{`[{"text":"only one"}]`, `{"text":"a"}`, "{\"text\":\"a\"}\nnot json\n", `[1, 2`} {
+		if _, _, err := split([]byte(content), 0.2, 1); err == nil {
+			t.Errorf("split(%q) succeeded", content)
+		}
+	}
+}
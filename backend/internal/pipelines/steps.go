@@ -0,0 +1,415 @@
+package pipelines
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"path"
+	"strings"
+	"time"
+
+	"finetune-studio/internal/backends"
+	"finetune-studio/internal/database"
+	"finetune-studio/internal/jobs"
+	"finetune-studio/internal/jobs/retry"
+	"finetune-studio/internal/jobs/statemachine"
+	"finetune-studio/internal/models"
+	"finetune-studio/internal/outbox"
+	"finetune-studio/internal/storage"
+	"finetune-studio/internal/sweeps"
+	"finetune-studio/internal/validator"
+
+	"github.com/minio/minio-go/v7"
+	"gorm.io/datatypes"
+	"gorm.io/gorm"
+)
+
+// Each step returns its output, whether it is waiting on something to finish
+// and should be checked again, and an error. Steps are safe to run again
+// after a crash: whatever they create is recorded on the pipeline in the same
+// transaction and reused by the next execution.
+
+// permanent marks a failure retrying the step will not fix
+func permanent(format string, args ...interface{}) error {
+	return retry.Wrap(retry.ClassPermanent, fmt.Errorf(format, args...))
+}
+
+// validate checks the pipeline dataset with the same rules as uploads
+func (r *Runner) validate(ctx context.Context, pipeline *models.Pipeline) (map[string]interface{}, bool, error) {
+	dataset, content, err := loadDataset(ctx, pipeline.DatasetID)
+	if err != nil {
+		return nil, false, err
+	}
+
+	result := validateContent(content, dataset.Type)
+	if !result.Valid {
+		return nil, false, permanent("dataset %d is invalid: %s", dataset.ID, strings.Join(result.Errors, "; "))
+	}
+	return map[string]interface{}{
+		"dataset_id":   dataset.ID,
+		"num_examples": result.Stats.NumExamples,
+		"warnings":     result.Warnings,
+	}, false, nil
+}
+
+// split stores the training and holdout parts of the dataset as new datasets
+func (r *Runner) split(ctx context.Context, pipeline *models.Pipeline) (map[string]interface{}, bool, error) {
+	if pipeline.TrainDatasetID != nil && pipeline.HoldoutDatasetID != nil {
+		return map[string]interface{}{"train_dataset_id": *pipeline.TrainDatasetID, "holdout_dataset_id": *pipeline.HoldoutDatasetID}, false, nil
+	}
+
+	dataset, content, err := loadDataset(ctx, pipeline.DatasetID)
+	if err != nil {
+		return nil, false, err
+	}
+	if dataset.Type != "json" {
+		return nil, false, permanent("only JSON datasets can be split, dataset %d is %s", dataset.ID, dataset.Type)
+	}
+
+	trainContent, holdoutContent, err := split(content, pipeline.HoldoutFraction, pipeline.Seed)
+	if err != nil {
+		return nil, false, permanent("dataset %d: %v", dataset.ID, err)
+	}
+	train, err := storePart(ctx, pipeline, dataset, "train", trainContent)
+	if err != nil {
+		return nil, false, err
+	}
+	holdout, err := storePart(ctx, pipeline, dataset, "holdout", holdoutContent)
+	if err != nil {
+		return nil, false, err
+	}
+
+	err = database.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Create(train).Error; err != nil {
+			return err
+		}
+		if err := tx.Create(holdout).Error; err != nil {
+			return err
+		}
+		return tx.Model(pipeline).Updates(map[string]interface{}{"train_dataset_id": train.ID, "holdout_dataset_id": holdout.ID}).Error
+	})
+	if err != nil {
+		return nil, false, err
+	}
+
+	return map[string]interface{}{
+		"train_dataset_id":   train.ID,
+		"train_examples":     train.NumExamples,
+		"holdout_dataset_id": holdout.ID,
+		"holdout_examples":   holdout.NumExamples,
+	}, false, nil
+}
+
+// train creates the training job on the first execution and waits for it.
+// A job that ends without completing fails the step; retrying the step
+// trains again with a new job.
+func (r *Runner) train(pipeline *models.Pipeline) (map[string]interface{}, bool, error) {
+	if pipeline.JobID == nil {
+		job, err := jobs.New(*pipeline.TrainDatasetID, pipeline.Configuration, r.JobTimeout)
+		if err != nil {
+			return nil, false, retry.Wrap(retry.ClassPermanent, err)
+		}
+		job.PresetID = pipeline.PresetID
+		job.PresetVersion = pipeline.PresetVersion
+		job.PipelineID = &pipeline.ID
+		scheduling := jobs.Scheduling{Priority: pipeline.Priority, Submitter: pipeline.Submitter, Project: pipeline.Project}
+		if err := scheduling.Apply(job); err != nil {
+			return nil, false, retry.Wrap(retry.ClassPermanent, err)
+		}
+
+		err = database.DB.Transaction(func(tx *gorm.DB) error {
+			if err := jobs.Create(tx, job, statemachine.ActorPipeline, fmt.Sprintf("step %s of pipeline %d", StepTrain, pipeline.ID)); err != nil {
+				return err
+			}
+			return tx.Model(pipeline).Update("job_id", job.ID).Error
+		})
+		if err != nil {
+			return nil, false, err
+		}
+		if r.OnJobCreated != nil {
+			r.OnJobCreated()
+		}
+		return map[string]interface{}{"job_id": job.ID, "job_status": job.Status}, true, nil
+	}
+
+	var job models.Job
+	if err := database.DB.Unscoped().Select("id", "status").First(&job, *pipeline.JobID).Error; err != nil {
+		return nil, false, err
+	}
+	output := map[string]interface{}{"job_id": job.ID, "job_status": job.Status}
+
+	switch {
+	case job.Status == string(statemachine.Completed):
+		// The model becomes ready once its files are registered
+		var model models.Model
+		if err := database.DB.Where("job_id = ?", job.ID).First(&model).Error; err != nil {
+			if errors.Is(err, gorm.ErrRecordNotFound) {
+				return output, true, nil
+			}
+			return nil, false, err
+		}
+		switch model.Status {
+		case "ready":
+		case "failed":
+			if err := database.DB.Model(pipeline).Update("job_id", nil).Error; err != nil {
+				return nil, false, err
+			}
+			return output, false, permanent("model %d of job %d failed to import", model.ID, job.ID)
+		default:
+			return output, true, nil
+		}
+		if err := database.DB.Model(pipeline).Update("model_id", model.ID).Error; err != nil {
+			return nil, false, err
+		}
+		output["model_id"] = model.ID
+		return output, false, nil
+
+	case statemachine.IsTerminal(statemachine.State(job.Status)):
+		// Forgetting the job lets the retry train again. Until that is
+		// recorded, every execution finds the job and tries once more.
+		if err := database.DB.Model(pipeline).Update("job_id", nil).Error; err != nil {
+			return nil, false, err
+		}
+		return output, false, retry.Wrap(retry.ClassRunFailed, fmt.Errorf("training job %d ended %s", job.ID, job.Status))
+	}
+	return output, true, nil
+}
+
+// checkExport checks training produced a GGUF export of the model. It doesn't
+// export anything: the training notebook writes the GGUF files next to the
+// adapters, and a model without them fails the step.
+func (r *Runner) checkExport(pipeline *models.Pipeline) (map[string]interface{}, bool, error) {
+	var model models.Model
+	if err := database.DB.First(&model, *pipeline.ModelID).Error; err != nil {
+		return nil, false, err
+	}
+
+	var manifest backends.Manifest
+	json.Unmarshal(model.Files, &manifest)
+	if len(manifest.GGUF) == 0 {
+		return nil, false, permanent("model %d has no GGUF export", model.ID)
+	}
+
+	files := make([]string, len(manifest.GGUF))
+	for i, artifact := range manifest.GGUF {
+		files[i] = artifact.Path
+	}
+	return map[string]interface{}{"model_id": model.ID, "gguf": files}, false, nil
+}
+
+// evaluate requests an evaluation of the model on the holdout dataset and
+// waits for its results, reported through PUT /api/v1/evaluations/:id like
+// any other evaluation. The results become the model's eval results.
+func (r *Runner) evaluate(pipeline *models.Pipeline) (map[string]interface{}, bool, error) {
+	if pipeline.EvaluationID == nil {
+		var model models.Model
+		if err := database.DB.First(&model, *pipeline.ModelID).Error; err != nil {
+			return nil, false, err
+		}
+		var holdout models.Dataset
+		if err := database.DB.First(&holdout, *pipeline.HoldoutDatasetID).Error; err != nil {
+			return nil, false, err
+		}
+
+		now := time.Now()
+		evaluation := models.Evaluation{
+			ModelID:       model.ID,
+			JobID:         model.JobID,
+			Status:        "pending",
+			TestSetPath:   holdout.FilePath,
+			BaseModelName: model.BaseModel,
+			FineTunedName: model.Name,
+			StartedAt:     &now,
+			Results:       datatypes.JSON([]byte("{}")),
+			Examples:      datatypes.JSON([]byte("[]")),
+		}
+		err := database.DB.Transaction(func(tx *gorm.DB) error {
+			if err := tx.Create(&evaluation).Error; err != nil {
+				return err
+			}
+			if err := outbox.Add(tx, outbox.EvaluationCreated, outbox.Evaluation(&evaluation)); err != nil {
+				return err
+			}
+			return tx.Model(pipeline).Update("evaluation_id", evaluation.ID).Error
+		})
+		if err != nil {
+			return nil, false, err
+		}
+		return map[string]interface{}{"evaluation_id": evaluation.ID, "evaluation_status": evaluation.Status}, true, nil
+	}
+
+	var evaluation models.Evaluation
+	if err := database.DB.First(&evaluation, *pipeline.EvaluationID).Error; err != nil {
+		return nil, false, err
+	}
+	output := map[string]interface{}{"evaluation_id": evaluation.ID, "evaluation_status": evaluation.Status}
+
+	switch evaluation.Status {
+	case "completed":
+		value, ok := sweeps.MetricValue(pipeline.Metric, evaluation.Results, nil)
+		if !ok {
+			return output, false, permanent("evaluation %d did not report %s", evaluation.ID, pipeline.Metric)
+		}
+		if err := database.DB.Model(&models.Model{}).Where("id = ?", evaluation.ModelID).Update("eval_results", evaluation.Results).Error; err != nil {
+			return nil, false, err
+		}
+		output["metric"] = pipeline.Metric
+		output["value"] = value
+		return output, false, nil
+
+	case "failed":
+		if err := database.DB.Model(pipeline).Update("evaluation_id", nil).Error; err != nil {
+			return nil, false, err
+		}
+		return output, false, permanent("evaluation %d failed: %s", evaluation.ID, evaluation.ErrorMessage)
+	}
+
+	if evaluation.StartedAt != nil && time.Since(*evaluation.StartedAt) > r.EvaluationTimeout {
+		message := fmt.Sprintf("no results reported within %s", r.EvaluationTimeout)
+		now := time.Now()
+		err := database.DB.Transaction(func(tx *gorm.DB) error {
+			evaluation.Status = "failed"
+			evaluation.ErrorMessage = message
+			evaluation.CompletedAt = &now
+			if err := tx.Model(&evaluation).Select("status", "error_message", "completed_at").Updates(&evaluation).Error; err != nil {
+				return err
+			}
+			if err := outbox.Add(tx, outbox.EvaluationFailed, outbox.Evaluation(&evaluation)); err != nil {
+				return err
+			}
+			return tx.Model(pipeline).Update("evaluation_id", nil).Error
+		})
+		if err != nil {
+			return nil, false, err
+		}
+		return output, false, permanent("evaluation %d: %s", evaluation.ID, message)
+	}
+	return output, true, nil
+}
+
+// promote makes the model the production model of its base model when its
+// holdout metric beats the current one, or when there is none yet
+func (r *Runner) promote(pipeline *models.Pipeline) (map[string]interface{}, bool, error) {
+	var model models.Model
+	if err := database.DB.First(&model, *pipeline.ModelID).Error; err != nil {
+		return nil, false, err
+	}
+	value, ok := sweeps.MetricValue(pipeline.Metric, model.EvalResults, nil)
+	if !ok {
+		return nil, false, permanent("model %d has no %s in its eval results", model.ID, pipeline.Metric)
+	}
+	output := map[string]interface{}{"model_id": model.ID, "metric": pipeline.Metric, "value": value, "promoted": false}
+
+	err := database.DB.Transaction(func(tx *gorm.DB) error {
+		// One promotion per base model at a time
+		if err := tx.Exec("SELECT pg_advisory_xact_lock(hashtext(?))", "production:"+model.BaseModel).Error; err != nil {
+			return err
+		}
+
+		var current models.Model
+		result := tx.Where("production = ? AND base_model = ? AND id <> ?", true, model.BaseModel, model.ID).Limit(1).Find(&current)
+		if result.Error != nil {
+			return result.Error
+		}
+		if result.RowsAffected > 0 {
+			output["production_model_id"] = current.ID
+			if currentValue, ok := sweeps.MetricValue(pipeline.Metric, current.EvalResults, nil); ok {
+				output["production_value"] = currentValue
+				if !beats(value, currentValue, pipeline.Goal) {
+					return nil
+				}
+			}
+			if err := tx.Model(&current).Update("production", false).Error; err != nil {
+				return err
+			}
+		}
+
+		if err := tx.Model(&model).Update("production", true).Error; err != nil {
+			return err
+		}
+		if err := outbox.Add(tx, outbox.ModelPromoted, outbox.Model(&model)); err != nil {
+			return err
+		}
+		output["promoted"] = true
+		return tx.Model(pipeline).Update("promoted", true).Error
+	})
+	if err != nil {
+		return nil, false, err
+	}
+	return output, false, nil
+}
+
+// beats reports whether value is strictly better than current under goal
+func beats(value, current float64, goal string) bool {
+	if goal == sweeps.GoalMaximize {
+		return value > current
+	}
+	return value < current
+}
+
+func loadDataset(ctx context.Context, datasetID uint) (*models.Dataset, []byte, error) {
+	var dataset models.Dataset
+	if err := database.DB.First(&dataset, datasetID).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, nil, permanent("dataset %d not found", datasetID)
+		}
+		return nil, nil, err
+	}
+
+	obj, err := storage.Client.GetObject(ctx, "datasets", dataset.FilePath, minio.GetObjectOptions{})
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to open dataset %d: %w", dataset.ID, err)
+	}
+	defer obj.Close()
+	content, err := io.ReadAll(obj)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to read dataset %d: %w", dataset.ID, err)
+	}
+	return &dataset, content, nil
+}
+
+// validateContent applies the upload validation for the dataset type
+func validateContent(content []byte, datasetType string) validator.ValidationResult {
+	if datasetType == "json" {
+		return validator.ValidateDataset(content, "json")
+	}
+	return validator.ValidateTextDataset(content, datasetType)
+}
+
+// storePart uploads one part of a split dataset and returns its unsaved
+// record. Object names are fixed per pipeline so a retried split overwrites
+// its own uploads.
+func storePart(ctx context.Context, pipeline *models.Pipeline, source *models.Dataset, part string, content []byte) (*models.Dataset, error) {
+	objectName := fmt.Sprintf("pipeline_%d_%s%s", pipeline.ID, part, path.Ext(source.FilePath))
+	_, err := storage.Client.PutObject(ctx, "datasets", objectName, bytes.NewReader(content), int64(len(content)), minio.PutObjectOptions{
+		ContentType: "application/json",
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to upload %s part: %w", part, err)
+	}
+
+	result := validateContent(content, source.Type)
+	validationJSON, _ := json.Marshal(result)
+	dataset := &models.Dataset{
+		Name:              fmt.Sprintf("%s-%s", source.Name, part),
+		Description:       fmt.Sprintf("The %s part of dataset %d, split by pipeline %d", part, source.ID, pipeline.ID),
+		FilePath:          objectName,
+		ContentHash:       fmt.Sprintf("%x", sha256.Sum256(content)),
+		Type:              source.Type,
+		NumExamples:       result.Stats.NumExamples,
+		AvgLength:         result.Stats.AvgLength,
+		ValidationStatus:  "valid",
+		ValidationDetails: datatypes.JSON(validationJSON),
+	}
+	switch {
+	case !result.Valid:
+		dataset.ValidationStatus = "error"
+	case len(result.Warnings) > 0:
+		dataset.ValidationStatus = "warning"
+	}
+	return dataset, nil
+}
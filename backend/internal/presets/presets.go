@@ -0,0 +1,127 @@
+// Package presets stores named, versioned training configurations and
+// builds job configurations from them.
+package presets
+
+import (
+	"errors"
+
+	"finetune-studio/internal/database"
+	"finetune-studio/internal/jobs/trainingconfig"
+	"finetune-studio/internal/models"
+
+	"gorm.io/datatypes"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+var (
+	ErrNotFound        = errors.New("preset not found")
+	ErrVersionNotFound = errors.New("preset version not found")
+)
+
+// Create validates a configuration and stores it as version 1 of a new preset
+func Create(name, description string, configuration []byte) (*models.Preset, error) {
+	resolved, _, err := trainingconfig.Resolve(configuration)
+	if err != nil {
+		return nil, err
+	}
+
+	preset := &models.Preset{
+		Name:          name,
+		Description:   description,
+		Version:       1,
+		Configuration: datatypes.JSON(resolved),
+	}
+
+	err = database.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Create(preset).Error; err != nil {
+			return err
+		}
+		return tx.Create(&models.PresetVersion{
+			PresetID:      preset.ID,
+			Version:       preset.Version,
+			Description:   preset.Description,
+			Configuration: preset.Configuration,
+		}).Error
+	})
+	if err != nil {
+		return nil, err
+	}
+	return preset, nil
+}
+
+// Update stores a new version of a preset. The configuration replaces the
+// previous one; fields left out fall back to the defaults.
+func Update(preset *models.Preset, description string, configuration []byte) error {
+	resolved, _, err := trainingconfig.Resolve(configuration)
+	if err != nil {
+		return err
+	}
+
+	return database.DB.Transaction(func(tx *gorm.DB) error {
+		// Lock the preset so concurrent updates get distinct versions
+		var current models.Preset
+		if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).First(&current, preset.ID).Error; err != nil {
+			return err
+		}
+
+		current.Description = description
+		current.Version++
+		current.Configuration = datatypes.JSON(resolved)
+		if err := tx.Save(&current).Error; err != nil {
+			return err
+		}
+		*preset = current
+
+		return tx.Create(&models.PresetVersion{
+			PresetID:      current.ID,
+			Version:       current.Version,
+			Description:   current.Description,
+			Configuration: current.Configuration,
+		}).Error
+	})
+}
+
+// Version returns one version of a live preset; version 0 selects the latest
+func Version(db *gorm.DB, presetID uint, version int) (*models.PresetVersion, error) {
+	var preset models.Preset
+	if err := db.First(&preset, presetID).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, ErrNotFound
+		}
+		return nil, err
+	}
+	if version == 0 {
+		version = preset.Version
+	}
+
+	var snapshot models.PresetVersion
+	err := db.Where("preset_id = ? AND version = ?", presetID, version).First(&snapshot).Error
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, ErrVersionNotFound
+		}
+		return nil, err
+	}
+	return &snapshot, nil
+}
+
+// JobConfig merges job overrides on top of a preset version and returns the
+// resolved configuration together with the version used
+func JobConfig(db *gorm.DB, presetID uint, version int, overrides []byte) ([]byte, int, error) {
+	snapshot, err := Version(db, presetID, version)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	merged, err := trainingconfig.Merge(snapshot.Configuration, overrides)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	resolved, _, err := trainingconfig.Resolve(merged)
+	if err != nil {
+		return nil, 0, err
+	}
+	return resolved, snapshot.Version, nil
+}
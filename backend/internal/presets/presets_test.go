@@ -0,0 +1,77 @@
+package presets
+
+import (
+	"encoding/json"
+	"errors"
+	"testing"
+
+	"finetune-studio/internal/database/databasetest"
+	"finetune-studio/internal/jobs/trainingconfig"
+)
+
+func TestPresetVersions(t *testing.T) {
+	db := databasetest.Open(t)
+
+	preset, err := Create("small", "first", []byte(`{"base_model": "llama-3.2-1b", "epochs": 2}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := Update(preset, "second", []byte(`{"base_model": "llama-3.2-1b", "epochs": 4}`)); err != nil {
+		t.Fatal(err)
+	}
+	if preset.Version != 2 || preset.Description != "second" {
+		t.Fatalf("updated preset is %+v", preset)
+	}
+
+	// Jobs built from an older version keep its values
+	config, version, err := JobConfig(db, preset.ID, 1, nil)
+	if err != nil || version != 1 {
+		t.Fatalf("version 1: %v, %v", version, err)
+	}
+	if cfg, _ := trainingconfig.Parse(config); cfg.Epochs != 2 {
+		t.Fatalf("version 1 trains %d epochs", cfg.Epochs)
+	}
+
+	config, version, err = JobConfig(db, preset.ID, 0, []byte(`{"learning_rate": 0.0001}`))
+	if err != nil || version != 2 {
+		t.Fatalf("latest: %v, %v", version, err)
+	}
+	cfg, _ := trainingconfig.Parse(config)
+	if cfg.Epochs != 4 || cfg.LearningRate != 0.0001 {
+		t.Fatalf("latest with overrides: %+v", cfg)
+	}
+
+	if _, _, err := JobConfig(db, preset.ID, 3, nil); !errors.Is(err, ErrVersionNotFound) {
+		t.Fatalf("missing version: %v", err)
+	}
+	if _, _, err := JobConfig(db, preset.ID+1, 0, nil); !errors.Is(err, ErrNotFound) {
+		t.Fatalf("missing preset: %v", err)
+	}
+}
+
+func TestPresetsStoreValidConfigurations(t *testing.T) {
+	db := databasetest.Open(t)
+
+	if _, err := Create("bad", "", []byte(`{"epochs": "many"}`)); err == nil {
+		t.Fatal("invalid configuration stored")
+	}
+
+	preset, err := Create("resolved", "", []byte(`{"base_model": "llama-3.2-1b"}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var stored map[string]interface{}
+	json.Unmarshal(preset.Configuration, &stored)
+	if stored["max_seq_length"] == nil || stored["learning_rate"] == nil {
+		t.Fatalf("stored configuration is not resolved: %s", preset.Configuration)
+	}
+
+	// Switching the base model re-derives the sequence length cap
+	config, _, err := JobConfig(db, preset.ID, 0, []byte(`{"base_model": "gpt2"}`))
+	if err != nil {
+		t.Fatalf("gpt2 override rejected: %v", err)
+	}
+	if cfg, _ := trainingconfig.Parse(config); cfg.MaxSeqLength != 1024 {
+		t.Fatalf("max_seq_length %d for gpt2", cfg.MaxSeqLength)
+	}
+}
@@ -0,0 +1,181 @@
+package queue
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"time"
+
+	"finetune-studio/internal/database"
+	"finetune-studio/internal/models"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// ErrLeaseLost is returned by Heartbeat when another worker took the job over
+var ErrLeaseLost = errors.New("job lease lost")
+
+// ClaimableStatuses are the job statuses a worker may pick up. Jobs already
+// starting, running or cancelling are claimable again once their lease has
+// expired, which is how work owned by a crashed replica gets resumed.
+var ClaimableStatuses = []string{"pending", "retrying", "starting", "running", "cancelling"}
+
+// Queue is a durable job queue backed by the jobs table. Workers lease rows
+// with SELECT ... FOR UPDATE SKIP LOCKED and keep the lease alive with
+// heartbeats, so each job is processed by exactly one worker across all API
+// replicas and survives restarts.
+type Queue struct {
+	Owner         string
+	LeaseDuration time.Duration
+}
+
+func New(owner string, leaseDuration time.Duration) *Queue {
+	return &Queue{
+		Owner:         owner,
+		LeaseDuration: leaseDuration,
+	}
+}
+
+// DefaultOwner identifies this process as lease owner
+func DefaultOwner() string {
+	hostname, err := os.Hostname()
+	if err != nil {
+		hostname = "unknown"
+	}
+	return fmt.Sprintf("%s-%d", hostname, os.Getpid())
+}
+
+// startStatuses are the claimable statuses of jobs that have not started yet
+var startStatuses = []string{"pending", "retrying"}
+
+// activeTrials counts the trials of a sweep that hold a worker or a run. The
+// sweep is given as a format argument, the current time as a bind parameter.
+const activeTrials = `SELECT COUNT(*) FROM jobs AS trials WHERE trials.sweep_id = %s AND trials.deleted_at IS NULL
+	AND (trials.status IN ('starting', 'running', 'cancelling') OR trials.lease_expires_at > ?)`
+
+// shareGroup is the fair-share group of a job: its project, or its submitter
+// when it has none. The table alias is given as a format argument.
+const shareGroup = `COALESCE(NULLIF(%[1]s.project, ''), %[1]s.submitter, '')`
+
+// activeInGroup counts the jobs of the claimed job's share group that hold a
+// worker or a run. The current time is a bind parameter.
+var activeInGroup = `(SELECT COUNT(*) FROM jobs AS active WHERE active.deleted_at IS NULL
+	AND (active.status IN ('starting', 'running', 'cancelling') OR active.lease_expires_at > ?)
+	AND ` + fmt.Sprintf(shareGroup, "active") + ` = ` + fmt.Sprintf(shareGroup, "jobs") + `)`
+
+// Claim leases the next claimable job. It returns nil when there is nothing to do.
+//
+// Jobs that already started are always resumed first. Jobs waiting to start
+// are taken by priority, then from the share group with the fewest active
+// jobs so that one large batch doesn't starve everyone else, then oldest
+// first. Sweep trials only start while their sweep is below its
+// concurrency cap.
+func (q *Queue) Claim() (*models.Job, error) {
+	var jobID uint
+
+	err := database.DB.Transaction(func(tx *gorm.DB) error {
+		now := time.Now()
+
+		// Sweeps found at their cap by the recheck below; their other trials
+		// can't start either
+		var fullSweeps []uint
+		for {
+			query := tx.Clauses(clause.Locking{Strength: "UPDATE", Options: "SKIP LOCKED"}).
+				Select("id", "status", "sweep_id").
+				Where("status IN ?", ClaimableStatuses).
+				Where("lease_expires_at IS NULL OR lease_expires_at < ?", now).
+				Where("next_attempt_at IS NULL OR next_attempt_at <= ?", now).
+				Where("sweep_id IS NULL OR status NOT IN ? OR ("+fmt.Sprintf(activeTrials, "jobs.sweep_id")+
+					") < (SELECT max_concurrency FROM sweeps WHERE sweeps.id = jobs.sweep_id)", startStatuses, now)
+			if len(fullSweeps) > 0 {
+				query = query.Where("sweep_id IS NULL OR status NOT IN ? OR sweep_id NOT IN ?", startStatuses, fullSweeps)
+			}
+
+			var job models.Job
+			result := query.
+				Order(clause.OrderBy{Expression: clause.Expr{
+					SQL:                "CASE WHEN status IN ('pending', 'retrying') THEN 1 ELSE 0 END, priority DESC, " + activeInGroup + ", created_at, id",
+					Vars:               []interface{}{now},
+					WithoutParentheses: true,
+				}}).
+				Limit(1).
+				Find(&job)
+			if result.Error != nil {
+				return result.Error
+			}
+			if result.RowsAffected == 0 {
+				return nil
+			}
+
+			// Two replicas may pick trials of the same sweep at once; locking the
+			// sweep row serialises them so the cap holds
+			if job.SweepID != nil && isStartStatus(job.Status) {
+				var sweep models.Sweep
+				if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).Select("id", "max_concurrency").First(&sweep, *job.SweepID).Error; err != nil {
+					return err
+				}
+				var active int64
+				if err := tx.Raw(fmt.Sprintf(activeTrials, "?"), sweep.ID, now).Scan(&active).Error; err != nil {
+					return err
+				}
+				if active >= int64(sweep.MaxConcurrency) {
+					fullSweeps = append(fullSweeps, sweep.ID)
+					continue
+				}
+			}
+
+			jobID = job.ID
+			return tx.Exec("UPDATE jobs SET lease_owner = ?, lease_expires_at = ?, heartbeat_at = ? WHERE id = ?",
+				q.Owner, now.Add(q.LeaseDuration), now, job.ID).Error
+		}
+	})
+	if err != nil || jobID == 0 {
+		return nil, err
+	}
+
+	var job models.Job
+	if err := database.DB.Preload("Dataset").First(&job, jobID).Error; err != nil {
+		return nil, err
+	}
+	return &job, nil
+}
+
+func isStartStatus(status string) bool {
+	for _, s := range startStatuses {
+		if s == status {
+			return true
+		}
+	}
+	return false
+}
+
+// Heartbeat extends the lease on a job held by this queue owner
+func (q *Queue) Heartbeat(jobID uint) error {
+	now := time.Now()
+	result := database.DB.Exec("UPDATE jobs SET lease_expires_at = ?, heartbeat_at = ? WHERE id = ? AND lease_owner = ?",
+		now.Add(q.LeaseDuration), now, jobID, q.Owner)
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return ErrLeaseLost
+	}
+	return nil
+}
+
+// Release gives up the lease so the job can be claimed again right away
+func (q *Queue) Release(jobID uint) error {
+	return database.DB.Exec("UPDATE jobs SET lease_owner = NULL, lease_expires_at = NULL WHERE id = ? AND lease_owner = ?",
+		jobID, q.Owner).Error
+}
+
+// Pending counts the jobs waiting for a worker
+func Pending() (int64, error) {
+	var count int64
+	err := database.DB.Model(&models.Job{}).
+		Where("status = ?", "pending").
+		Where("lease_expires_at IS NULL OR lease_expires_at < ?", time.Now()).
+		Count(&count).Error
+	return count, err
+}
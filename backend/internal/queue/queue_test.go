@@ -0,0 +1,212 @@
+package queue
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+	"time"
+
+	"finetune-studio/internal/database"
+	"finetune-studio/internal/database/databasetest"
+	"finetune-studio/internal/models"
+)
+
+func createJob(t *testing.T, job models.Job) *models.Job {
+	t.Helper()
+	if err := database.DB.Create(&job).Error; err != nil {
+		t.Fatal(err)
+	}
+	return &job
+}
+
+func leaseOf(t *testing.T, jobID uint) (string, *time.Time) {
+	t.Helper()
+	var job models.Job
+	if err := database.DB.First(&job, jobID).Error; err != nil {
+		t.Fatal(err)
+	}
+	return job.LeaseOwner, job.LeaseExpiresAt
+}
+
+func TestClaimLeasesEachJobOnce(t *testing.T) {
+	databasetest.Open(t)
+	first := New("replica-1", time.Minute)
+	second := New("replica-2", time.Minute)
+	job := createJob(t, models.Job{Status: "pending"})
+
+	claimed, err := first.Claim()
+	if err != nil || claimed == nil || claimed.ID != job.ID {
+		t.Fatalf("first claim got %v, %v", claimed, err)
+	}
+	owner, expires := leaseOf(t, job.ID)
+	if owner != "replica-1" || expires == nil || time.Until(*expires) < 50*time.Second {
+		t.Fatalf("lease held by %q until %v", owner, expires)
+	}
+
+	if claimed, err := second.Claim(); err != nil || claimed != nil {
+		t.Fatalf("leased job claimed again: %v, %v", claimed, err)
+	}
+
+	// Released jobs can be claimed right away
+	if err := first.Release(job.ID); err != nil {
+		t.Fatal(err)
+	}
+	if claimed, err := second.Claim(); err != nil || claimed == nil || claimed.ID != job.ID {
+		t.Fatalf("released job not claimed: %v, %v", claimed, err)
+	}
+}
+
+func TestExpiredLeaseIsTakenOver(t *testing.T) {
+	databasetest.Open(t)
+	crashed := New("crashed", time.Minute)
+	survivor := New("survivor", time.Minute)
+	job := createJob(t, models.Job{Status: "running"})
+
+	if claimed, _ := crashed.Claim(); claimed == nil {
+		t.Fatal("running job without a lease not claimed")
+	}
+	if err := crashed.Heartbeat(job.ID); err != nil {
+		t.Fatalf("heartbeat of the lease owner failed: %v", err)
+	}
+
+	// No heartbeat since the lease ran out
+	database.DB.Exec("UPDATE jobs SET lease_expires_at = ? WHERE id = ?", time.Now().Add(-time.Second), job.ID)
+
+	claimed, err := survivor.Claim()
+	if err != nil || claimed == nil || claimed.ID != job.ID {
+		t.Fatalf("expired lease not taken over: %v, %v", claimed, err)
+	}
+	if owner, _ := leaseOf(t, job.ID); owner != "survivor" {
+		t.Fatalf("lease held by %q", owner)
+	}
+	if err := crashed.Heartbeat(job.ID); !errors.Is(err, ErrLeaseLost) {
+		t.Fatalf("heartbeat of the previous owner returned %v, want ErrLeaseLost", err)
+	}
+	// Releasing a lease held by someone else does nothing
+	crashed.Release(job.ID)
+	if owner, _ := leaseOf(t, job.ID); owner != "survivor" {
+		t.Fatalf("lease released by a former owner, now held by %q", owner)
+	}
+}
+
+func TestClaimSkipsJobsNotDue(t *testing.T) {
+	databasetest.Open(t)
+	q := New("replica", time.Minute)
+	later := time.Now().Add(time.Hour)
+	createJob(t, models.Job{Status: "retrying", NextAttemptAt: &later})
+	createJob(t, models.Job{Status: "completed"})
+	createJob(t, models.Job{Status: "failed"})
+
+	if claimed, err := q.Claim(); err != nil || claimed != nil {
+		t.Fatalf("claimed %v, %v; want nothing", claimed, err)
+	}
+	if pending, err := Pending(); err != nil || pending != 0 {
+		t.Fatalf("Pending() = %d, %v", pending, err)
+	}
+}
+
+// claimOrder claims every claimable job and returns their ids in order
+func claimOrder(t *testing.T, q *Queue) []uint {
+	t.Helper()
+	var order []uint
+	for {
+		job, err := q.Claim()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if job == nil {
+			return order
+		}
+		order = append(order, job.ID)
+	}
+}
+
+func TestClaimOrdersByPriorityThenShareGroup(t *testing.T) {
+	databasetest.Open(t)
+	q := New("replica", time.Minute)
+	// alice already has a run going
+	createJob(t, models.Job{Status: "running", Submitter: "alice"})
+	if claimed, _ := New("other", time.Minute).Claim(); claimed == nil {
+		t.Fatal("running job not claimed")
+	}
+
+	batch1 := createJob(t, models.Job{Status: "pending", Submitter: "alice"})
+	batch2 := createJob(t, models.Job{Status: "pending", Submitter: "alice"})
+	single := createJob(t, models.Job{Status: "pending", Submitter: "bob"})
+	urgent := createJob(t, models.Job{Status: "pending", Submitter: "alice", Priority: 10})
+	resumed := createJob(t, models.Job{Status: "running", Submitter: "carol"})
+
+	want := []uint{resumed.ID, urgent.ID, single.ID, batch1.ID, batch2.ID}
+	if got := claimOrder(t, q); !reflect.DeepEqual(got, want) {
+		t.Fatalf("claimed %v, want %v", got, want)
+	}
+}
+
+func TestClaimGroupsByProjectBeforeSubmitter(t *testing.T) {
+	databasetest.Open(t)
+	q := New("replica", time.Minute)
+	createJob(t, models.Job{Status: "running", Submitter: "alice", Project: "search"})
+	if claimed, _ := New("other", time.Minute).Claim(); claimed == nil {
+		t.Fatal("running job not claimed")
+	}
+
+	sameProject := createJob(t, models.Job{Status: "pending", Submitter: "bob", Project: "search"})
+	sameSubmitter := createJob(t, models.Job{Status: "pending", Submitter: "alice", Project: "ranking"})
+
+	want := []uint{sameSubmitter.ID, sameProject.ID}
+	if got := claimOrder(t, q); !reflect.DeepEqual(got, want) {
+		t.Fatalf("claimed %v, want %v", got, want)
+	}
+}
+
+func TestClaimHoldsSweepAtItsCap(t *testing.T) {
+	databasetest.Open(t)
+	q := New("replica", time.Minute)
+	sweep := models.Sweep{MaxConcurrency: 2}
+	if err := database.DB.Create(&sweep).Error; err != nil {
+		t.Fatal(err)
+	}
+	var trials []*models.Job
+	for i := 0; i < 3; i++ {
+		trials = append(trials, createJob(t, models.Job{Status: "pending", SweepID: &sweep.ID}))
+	}
+	other := createJob(t, models.Job{Status: "pending"})
+
+	want := []uint{trials[0].ID, trials[1].ID, other.ID}
+	if got := claimOrder(t, q); !reflect.DeepEqual(got, want) {
+		t.Fatalf("claimed %v, want %v with the third trial held", got, want)
+	}
+
+	// A finished trial frees a place
+	database.DB.Exec("UPDATE jobs SET status = 'completed', lease_owner = NULL, lease_expires_at = NULL WHERE id = ?", trials[0].ID)
+	if got := claimOrder(t, q); !reflect.DeepEqual(got, []uint{trials[2].ID}) {
+		t.Fatalf("claimed %v after a trial finished, want %v", got, []uint{trials[2].ID})
+	}
+}
+
+func TestClaimsBefore(t *testing.T) {
+	now := time.Now()
+	job := func(id uint, priority int, submitter string, created time.Time) *models.Job {
+		j := &models.Job{Priority: priority, Submitter: submitter}
+		j.ID = id
+		j.CreatedAt = created
+		return j
+	}
+	active := map[string]int{"alice": 2}
+
+	tests := []struct {
+		a, b *models.Job
+		want bool
+	}{
+		{job(2, 1, "alice", now), job(1, 0, "bob", now.Add(-time.Hour)), true},
+		{job(2, 0, "bob", now), job(1, 0, "alice", now.Add(-time.Hour)), true},
+		{job(2, 0, "bob", now.Add(-time.Hour)), job(1, 0, "carol", now), true},
+		{job(1, 0, "bob", now), job(2, 0, "carol", now), true},
+		{job(2, 0, "bob", now), job(1, 0, "carol", now), false},
+	}
+	for i, tt := range tests {
+		if got := claimsBefore(tt.a, tt.b, active); got != tt.want {
+			t.Errorf("case %d: claimsBefore = %v, want %v", i, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,226 @@
+package queue
+
+import (
+	"fmt"
+	"sort"
+	"time"
+
+	"finetune-studio/internal/database"
+	"finetune-studio/internal/models"
+)
+
+// defaultRunDuration is the run time assumed for a backend without
+// completed jobs
+const defaultRunDuration = 30 * time.Minute
+
+// Entry is a job waiting to start, with its projected place in the queue
+type Entry struct {
+	Position         int        `json:"position"` // 1 is the next job a worker claims
+	JobID            uint       `json:"job_id"`
+	Status           string     `json:"status"`
+	Backend          string     `json:"backend"`
+	Priority         int        `json:"priority"`
+	Submitter        string     `json:"submitter"`
+	Project          string     `json:"project"`
+	SweepID          *uint      `json:"sweep_id,omitempty"`
+	CreatedAt        time.Time  `json:"created_at"`
+	NextAttemptAt    *time.Time `json:"next_attempt_at,omitempty"`
+	EstimatedStartAt time.Time  `json:"estimated_start_at"`
+}
+
+// Snapshot is the state of the queue at one point in time
+type Snapshot struct {
+	Slots   int     `json:"slots"`   // Jobs that can run at once
+	Running int     `json:"running"` // Jobs holding a worker or a run
+	Waiting []Entry `json:"waiting"`
+}
+
+// slot is a worker that frees up at a point in time
+type slot struct {
+	freeAt   time.Time
+	occupied bool
+	group    string // Share group of the job occupying it
+}
+
+// Waiting projects the order in which the jobs that have not started yet will
+// be claimed, and when each starts given the number of jobs that can run at
+// once. It replays the Claim ordering as workers free up: run times are the
+// average of recently completed jobs of the same backend. Sweep caps and
+// backend quotas are only accounted for through next_attempt_at, so start
+// times are estimates.
+func Waiting(slots int) (*Snapshot, error) {
+	now := time.Now()
+
+	var active []models.Job
+	err := database.DB.Select("id", "backend", "submitter", "project", "started_at").
+		Where("status IN ? OR (status IN ? AND lease_expires_at > ?)", []string{"starting", "running", "cancelling"}, startStatuses, now).
+		Find(&active).Error
+	if err != nil {
+		return nil, err
+	}
+
+	var waiting []models.Job
+	err = database.DB.Select("id", "status", "backend", "priority", "submitter", "project", "sweep_id", "created_at", "next_attempt_at").
+		Where("status IN ?", startStatuses).
+		Where("lease_expires_at IS NULL OR lease_expires_at < ?", now).
+		Order("created_at, id").
+		Find(&waiting).Error
+	if err != nil {
+		return nil, err
+	}
+
+	durations, err := runDurations(now)
+	if err != nil {
+		return nil, err
+	}
+	duration := func(backend string) time.Duration {
+		if d, ok := durations[backend]; ok {
+			return d
+		}
+		return defaultRunDuration
+	}
+
+	if slots < len(active) {
+		slots = len(active)
+	}
+	if slots < 1 {
+		slots = 1
+	}
+
+	// Slots free up when the running jobs are expected to finish
+	activeInGroup := make(map[string]int)
+	free := make([]slot, 0, slots)
+	for _, job := range active {
+		group := jobShareGroup(&job)
+		activeInGroup[group]++
+		freeAt := now.Add(duration(job.Backend))
+		if job.StartedAt != nil {
+			freeAt = job.StartedAt.Add(duration(job.Backend))
+		}
+		if freeAt.Before(now) {
+			freeAt = now
+		}
+		free = append(free, slot{freeAt: freeAt, occupied: true, group: group})
+	}
+	for len(free) < slots {
+		free = append(free, slot{freeAt: now})
+	}
+
+	snapshot := &Snapshot{Slots: slots, Running: len(active), Waiting: make([]Entry, 0, len(waiting))}
+	remaining := waiting
+	for len(remaining) > 0 {
+		sort.SliceStable(free, func(i, j int) bool { return free[i].freeAt.Before(free[j].freeAt) })
+		next := free[0]
+		if next.occupied {
+			activeInGroup[next.group]--
+		}
+
+		// Held jobs can't be claimed before next_attempt_at
+		at := next.freeAt
+		if !anyClaimable(remaining, at) {
+			at = earliestAttempt(remaining)
+		}
+
+		best := -1
+		for i := range remaining {
+			if !claimableAt(&remaining[i], at) {
+				continue
+			}
+			if best < 0 || claimsBefore(&remaining[i], &remaining[best], activeInGroup) {
+				best = i
+			}
+		}
+
+		job := remaining[best]
+		remaining = append(remaining[:best], remaining[best+1:]...)
+
+		group := jobShareGroup(&job)
+		activeInGroup[group]++
+		free[0] = slot{freeAt: at.Add(duration(job.Backend)), occupied: true, group: group}
+
+		snapshot.Waiting = append(snapshot.Waiting, Entry{
+			Position:         len(snapshot.Waiting) + 1,
+			JobID:            job.ID,
+			Status:           job.Status,
+			Backend:          job.Backend,
+			Priority:         job.Priority,
+			Submitter:        job.Submitter,
+			Project:          job.Project,
+			SweepID:          job.SweepID,
+			CreatedAt:        job.CreatedAt,
+			NextAttemptAt:    job.NextAttemptAt,
+			EstimatedStartAt: at,
+		})
+	}
+	return snapshot, nil
+}
+
+// claimsBefore reports whether Claim takes a before b, given the active jobs
+// of each share group
+func claimsBefore(a, b *models.Job, activeInGroup map[string]int) bool {
+	if a.Priority != b.Priority {
+		return a.Priority > b.Priority
+	}
+	if activeA, activeB := activeInGroup[jobShareGroup(a)], activeInGroup[jobShareGroup(b)]; activeA != activeB {
+		return activeA < activeB
+	}
+	if !a.CreatedAt.Equal(b.CreatedAt) {
+		return a.CreatedAt.Before(b.CreatedAt)
+	}
+	return a.ID < b.ID
+}
+
+func claimableAt(job *models.Job, at time.Time) bool {
+	return job.NextAttemptAt == nil || !job.NextAttemptAt.After(at)
+}
+
+func anyClaimable(jobs []models.Job, at time.Time) bool {
+	for i := range jobs {
+		if claimableAt(&jobs[i], at) {
+			return true
+		}
+	}
+	return false
+}
+
+func earliestAttempt(jobs []models.Job) time.Time {
+	var earliest time.Time
+	for _, job := range jobs {
+		if job.NextAttemptAt != nil && (earliest.IsZero() || job.NextAttemptAt.Before(earliest)) {
+			earliest = *job.NextAttemptAt
+		}
+	}
+	return earliest
+}
+
+// jobShareGroup mirrors the shareGroup SQL expression
+func jobShareGroup(job *models.Job) string {
+	if job.Project != "" {
+		return job.Project
+	}
+	return job.Submitter
+}
+
+// runDurations averages the run time of the jobs completed in the last 30
+// days, per backend
+func runDurations(now time.Time) (map[string]time.Duration, error) {
+	var rows []struct {
+		Backend string
+		Seconds float64
+	}
+	err := database.DB.Raw(`SELECT jobs.backend, AVG(EXTRACT(EPOCH FROM job_events.created_at - jobs.started_at)) AS seconds
+		FROM jobs JOIN job_events ON job_events.job_id = jobs.id AND job_events.to_status = 'completed'
+		WHERE jobs.started_at IS NOT NULL AND job_events.created_at > ?
+		GROUP BY jobs.backend`, now.AddDate(0, 0, -30)).Scan(&rows).Error
+	if err != nil {
+		return nil, fmt.Errorf("failed to average run durations: %w", err)
+	}
+
+	durations := make(map[string]time.Duration, len(rows))
+	for _, row := range rows {
+		if row.Seconds > 0 {
+			durations[row.Backend] = time.Duration(row.Seconds * float64(time.Second))
+		}
+	}
+	return durations, nil
+}
@@ -0,0 +1,72 @@
+package schedules
+
+import (
+	"testing"
+	"time"
+
+	"finetune-studio/internal/models"
+)
+
+func TestCronNext(t *testing.T) {
+	base := time.Date(2026, time.October, 17, 10, 30, 0, 0, time.UTC) // A Saturday
+
+	tests := []struct {
+		expr string
+		want time.Time
+	}{
+		{"*/15 * * * *", time.Date(2026, time.October, 17, 10, 45, 0, 0, time.UTC)},
+		{"0 3 * * *", time.Date(2026, time.October, 18, 3, 0, 0, 0, time.UTC)},
+		{"0 2 * * mon", time.Date(2026, time.October, 19, 2, 0, 0, 0, time.UTC)},
+		{"30 10 * * 6", time.Date(2026, time.October, 24, 10, 30, 0, 0, time.UTC)},
+		{"0 0 1 * *", time.Date(2026, time.November, 1, 0, 0, 0, 0, time.UTC)},
+		{"0 9-17/4 * * *", time.Date(2026, time.October, 17, 13, 0, 0, 0, time.UTC)},
+		{"0 0 * * 7", time.Date(2026, time.October, 18, 0, 0, 0, 0, time.UTC)},
+		{"@weekly", time.Date(2026, time.October, 18, 0, 0, 0, 0, time.UTC)},
+		{"0 0 29 feb *", time.Date(2028, time.February, 29, 0, 0, 0, 0, time.UTC)},
+		// Day of month or day of week when both are restricted
+		{"0 0 20 * fri", time.Date(2026, time.October, 20, 0, 0, 0, 0, time.UTC)},
+	}
+	for _, tt := range tests {
+		cron, err := ParseCron(tt.expr)
+		if err != nil {
+			t.Fatalf("ParseCron(%q): %v", tt.expr, err)
+		}
+		if got := cron.Next(base); !got.Equal(tt.want) {
+			t.Errorf("%q: next after %s = %s, want %s", tt.expr, base, got, tt.want)
+		}
+	}
+}
+
+func TestCronNextNeverFires(t *testing.T) {
+	cron, err := ParseCron("0 0 30 2 *")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if next := cron.Next(time.Now()); !next.IsZero() {
+		t.Fatalf("30 February fired at %s", next)
+	}
+}
+
+func TestParseCronErrors(t *testing.T) {
+	for _, expr := range []string{"", "* * * *", "60 * * * *", "* 24 * * *", "* * 0 * *", "*/0 * * * *", "5-1 * * * *", "* * * foo *"} {
+		if _, err := ParseCron(expr); err == nil {
+			t.Errorf("ParseCron(%q) succeeded", expr)
+		}
+	}
+}
+
+func TestNextRunUsesTimezone(t *testing.T) {
+	if _, err := time.LoadLocation("Europe/Madrid"); err != nil {
+		t.Skip("timezone data unavailable")
+	}
+
+	// 07:00 in Madrid is 05:00 UTC in summer time
+	schedule := &models.Schedule{Cron: "0 7 * * *", Timezone: "Europe/Madrid"}
+	next, err := NextRun(schedule, time.Date(2026, time.June, 1, 0, 0, 0, 0, time.UTC))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := time.Date(2026, time.June, 1, 5, 0, 0, 0, time.UTC); !next.Equal(want) {
+		t.Fatalf("next run %s, want %s", next, want)
+	}
+}
@@ -0,0 +1,266 @@
+// Package schedules creates training jobs from presets on cron schedules.
+// Every replica runs a Runner; due schedules are claimed with SKIP LOCKED so
+// each firing creates at most one job.
+package schedules
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"strings"
+	"sync"
+	"time"
+	_ "time/tzdata" // Timezones resolve in images without zoneinfo
+
+	"finetune-studio/internal/database"
+	"finetune-studio/internal/jobs"
+	"finetune-studio/internal/jobs/statemachine"
+	"finetune-studio/internal/models"
+	"finetune-studio/internal/presets"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// Run statuses
+const (
+	RunCreated = "created"
+	RunSkipped = "skipped"
+	RunFailed  = "failed"
+)
+
+// DefaultInterval is how often the runner looks for due schedules
+const DefaultInterval = 30 * time.Second
+
+// Prepare validates a schedule and computes its next run after now. Paused
+// schedules have no next run.
+func Prepare(schedule *models.Schedule, now time.Time) error {
+	schedule.Name = strings.TrimSpace(schedule.Name)
+	schedule.DatasetName = strings.TrimSpace(schedule.DatasetName)
+	if schedule.Name == "" {
+		return errors.New("name is required")
+	}
+	if schedule.DatasetName == "" {
+		return errors.New("dataset_name is required")
+	}
+	if schedule.Timezone == "" {
+		schedule.Timezone = "UTC"
+	}
+
+	scheduling := jobs.Scheduling{Priority: schedule.Priority, Submitter: schedule.Submitter, Project: schedule.Project}
+	if err := scheduling.Apply(&models.Job{}); err != nil {
+		return err
+	}
+	if _, _, err := presets.JobConfig(database.DB, schedule.PresetID, schedule.PresetVersion, schedule.Configuration); err != nil {
+		return err
+	}
+
+	schedule.NextRunAt = nil
+	if schedule.Paused {
+		return nil
+	}
+	next, err := NextRun(schedule, now)
+	if err != nil {
+		return err
+	}
+	schedule.NextRunAt = &next
+	return nil
+}
+
+// NextRun returns the first firing of a schedule after the given time
+func NextRun(schedule *models.Schedule, after time.Time) (time.Time, error) {
+	cron, err := ParseCron(schedule.Cron)
+	if err != nil {
+		return time.Time{}, err
+	}
+	location, err := time.LoadLocation(schedule.Timezone)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("invalid timezone %q", schedule.Timezone)
+	}
+	next := cron.Next(after.In(location))
+	if next.IsZero() {
+		return time.Time{}, fmt.Errorf("cron expression %q never fires", schedule.Cron)
+	}
+	return next.UTC(), nil
+}
+
+// Runner fires due schedules
+type Runner struct {
+	Interval   time.Duration
+	JobTimeout time.Duration // Default deadline of the jobs created
+
+	// OnJobCreated is called after a firing created a job, to wake a worker
+	OnJobCreated func()
+
+	ctx    context.Context
+	cancel context.CancelFunc
+	wg     sync.WaitGroup
+}
+
+func NewRunner(interval, jobTimeout time.Duration, onJobCreated func()) *Runner {
+	ctx, cancel := context.WithCancel(context.Background())
+	return &Runner{
+		Interval:     interval,
+		JobTimeout:   jobTimeout,
+		OnJobCreated: onJobCreated,
+		ctx:          ctx,
+		cancel:       cancel,
+	}
+}
+
+func (r *Runner) Start() {
+	r.wg.Add(1)
+	go func() {
+		defer r.wg.Done()
+		ticker := time.NewTicker(r.Interval)
+		defer ticker.Stop()
+		for {
+			if _, err := r.RunDue(time.Now()); err != nil {
+				log.Printf("[Scheduler] Failed to run due schedules: %v", err)
+			}
+			select {
+			case <-r.ctx.Done():
+				return
+			case <-ticker.C:
+			}
+		}
+	}()
+	log.Printf("⏰ Scheduler started, checking every %s", r.Interval)
+}
+
+func (r *Runner) Stop() {
+	r.cancel()
+	r.wg.Wait()
+}
+
+// RunDue fires every schedule due at now and returns the number of firings.
+// A schedule that missed several firings while no replica was up fires once.
+func (r *Runner) RunDue(now time.Time) (int, error) {
+	fired := 0
+	for {
+		run, err := r.fireNext(now)
+		if err != nil {
+			return fired, err
+		}
+		if run == nil {
+			return fired, nil
+		}
+		fired++
+		if run.JobID != nil && r.OnJobCreated != nil {
+			r.OnJobCreated()
+		}
+	}
+}
+
+// fireNext claims one due schedule, records its run and moves it to its next
+// firing in a single transaction
+func (r *Runner) fireNext(now time.Time) (*models.ScheduleRun, error) {
+	var run *models.ScheduleRun
+	err := database.DB.Transaction(func(tx *gorm.DB) error {
+		var schedule models.Schedule
+		result := tx.Clauses(clause.Locking{Strength: "UPDATE", Options: "SKIP LOCKED"}).
+			Where("paused = ? AND next_run_at <= ?", false, now).
+			Order("next_run_at, id").
+			Limit(1).
+			Find(&schedule)
+		if result.Error != nil || result.RowsAffected == 0 {
+			return result.Error
+		}
+
+		run = r.fire(tx, &schedule, *schedule.NextRunAt)
+		if err := tx.Create(run).Error; err != nil {
+			return err
+		}
+		log.Printf("[Scheduler] Schedule %d (%s): run %s %s", schedule.ID, schedule.Name, run.Status, run.Reason)
+
+		schedule.LastRunAt = &now
+		next, err := NextRun(&schedule, now)
+		if err != nil {
+			// Stored schedules were validated; stop firing rather than loop
+			log.Printf("[Scheduler] Pausing schedule %d: %v", schedule.ID, err)
+			schedule.Paused = true
+			schedule.NextRunAt = nil
+		} else {
+			schedule.NextRunAt = &next
+		}
+		return tx.Save(&schedule).Error
+	})
+	return run, err
+}
+
+// fire creates the job of one firing, or explains why it was skipped or failed
+func (r *Runner) fire(tx *gorm.DB, schedule *models.Schedule, scheduledFor time.Time) *models.ScheduleRun {
+	run := &models.ScheduleRun{ScheduleID: schedule.ID, ScheduledFor: scheduledFor}
+
+	var dataset models.Dataset
+	if err := tx.Where("name = ?", schedule.DatasetName).Order("created_at DESC, id DESC").First(&dataset).Error; err != nil {
+		run.Status = RunFailed
+		run.Reason = fmt.Sprintf("no dataset named %q", schedule.DatasetName)
+		return run
+	}
+	run.DatasetID = &dataset.ID
+	run.ContentHash = dataset.ContentHash
+
+	// Runs don't pile up behind a slow one
+	var previous models.ScheduleRun
+	if tx.Where("schedule_id = ? AND job_id IS NOT NULL", schedule.ID).Order("id DESC").First(&previous).Error == nil {
+		var job models.Job
+		if tx.Select("id", "status").First(&job, *previous.JobID).Error == nil && !statemachine.IsTerminal(statemachine.State(job.Status)) {
+			run.Status = RunSkipped
+			run.Reason = fmt.Sprintf("job %d of the previous run is still %s", job.ID, job.Status)
+			return run
+		}
+	}
+
+	if schedule.SkipUnchanged && dataset.ContentHash != "" {
+		var last models.ScheduleRun
+		err := tx.Select("schedule_runs.*").
+			Joins("JOIN jobs ON jobs.id = schedule_runs.job_id").
+			Where("schedule_runs.schedule_id = ? AND jobs.status = ?", schedule.ID, string(statemachine.Completed)).
+			Order("schedule_runs.id DESC").
+			First(&last).Error
+		if err == nil && last.ContentHash == dataset.ContentHash {
+			run.Status = RunSkipped
+			run.Reason = fmt.Sprintf("dataset %q is unchanged since job %d", dataset.Name, *last.JobID)
+			return run
+		}
+	}
+
+	job, err := r.newJob(tx, schedule, &dataset)
+	if err == nil {
+		// A savepoint keeps the transaction usable to record the failure
+		err = tx.Transaction(func(tx *gorm.DB) error {
+			return jobs.Create(tx, job, statemachine.ActorScheduler, fmt.Sprintf("schedule %d (%s)", schedule.ID, schedule.Name))
+		})
+	}
+	if err != nil {
+		run.Status = RunFailed
+		run.Reason = err.Error()
+		return run
+	}
+	run.Status = RunCreated
+	run.JobID = &job.ID
+	return run
+}
+
+func (r *Runner) newJob(tx *gorm.DB, schedule *models.Schedule, dataset *models.Dataset) (*models.Job, error) {
+	configJSON, presetVersion, err := presets.JobConfig(tx, schedule.PresetID, schedule.PresetVersion, schedule.Configuration)
+	if err != nil {
+		return nil, err
+	}
+	job, err := jobs.New(dataset.ID, configJSON, r.JobTimeout)
+	if err != nil {
+		return nil, err
+	}
+
+	presetID := schedule.PresetID
+	job.PresetID = &presetID
+	job.PresetVersion = presetVersion
+	job.ScheduleID = &schedule.ID
+	scheduling := jobs.Scheduling{Priority: schedule.Priority, Submitter: schedule.Submitter, Project: schedule.Project}
+	if err := scheduling.Apply(job); err != nil {
+		return nil, err
+	}
+	return job, nil
+}
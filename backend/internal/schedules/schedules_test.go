@@ -0,0 +1,174 @@
+package schedules
+
+import (
+	"testing"
+	"time"
+
+	"finetune-studio/internal/backends"
+	"finetune-studio/internal/database"
+	"finetune-studio/internal/database/databasetest"
+	"finetune-studio/internal/models"
+	"finetune-studio/internal/presets"
+)
+
+// newSchedule stores a daily schedule due at now
+func newSchedule(t *testing.T, now time.Time, skipUnchanged bool) *models.Schedule {
+	t.Helper()
+	backends.Register(backends.NewSimulationBackend())
+	preset, err := presets.Create("weekly", "", []byte(`{"base_model": "llama-3.2-1b", "backend": "simulation"}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	schedule := &models.Schedule{Name: "contracts", Cron: "0 3 * * *", PresetID: preset.ID, DatasetName: "cuad", SkipUnchanged: skipUnchanged}
+	if err := Prepare(schedule, now.Add(-24*time.Hour)); err != nil {
+		t.Fatal(err)
+	}
+	if err := database.DB.Create(schedule).Error; err != nil {
+		t.Fatal(err)
+	}
+	return schedule
+}
+
+func newDataset(t *testing.T, hash string) *models.Dataset {
+	t.Helper()
+	dataset := &models.Dataset{Name: "cuad", FilePath: "cuad.json", ContentHash: hash}
+	if err := database.DB.Create(dataset).Error; err != nil {
+		t.Fatal(err)
+	}
+	return dataset
+}
+
+// fire runs the schedule at its next firing and returns the run recorded
+func fire(t *testing.T, r *Runner, schedule *models.Schedule) models.ScheduleRun {
+	t.Helper()
+	if err := database.DB.First(schedule, schedule.ID).Error; err != nil {
+		t.Fatal(err)
+	}
+	if fired, err := r.RunDue(*schedule.NextRunAt); err != nil || fired != 1 {
+		t.Fatalf("fired %d schedules: %v", fired, err)
+	}
+	var run models.ScheduleRun
+	database.DB.Where("schedule_id = ?", schedule.ID).Order("id DESC").First(&run)
+	return run
+}
+
+func TestRunDueCreatesJobOnLatestDataset(t *testing.T) {
+	databasetest.Open(t)
+	now := time.Date(2026, time.October, 17, 3, 0, 0, 0, time.UTC)
+	schedule := newSchedule(t, now, false)
+	newDataset(t, "aaa")
+	latest := newDataset(t, "bbb")
+
+	created := 0
+	r := NewRunner(time.Minute, time.Hour, func() { created++ })
+	run := fire(t, r, schedule)
+	if run.Status != RunCreated || run.JobID == nil || *run.DatasetID != latest.ID || run.ContentHash != "bbb" {
+		t.Fatalf("unexpected run %+v", run)
+	}
+	if created != 1 {
+		t.Fatalf("OnJobCreated called %d times", created)
+	}
+
+	var job models.Job
+	database.DB.First(&job, *run.JobID)
+	if job.DatasetID != latest.ID || job.ScheduleID == nil || *job.ScheduleID != schedule.ID || job.Status != "pending" {
+		t.Fatalf("unexpected job %+v", job)
+	}
+
+	// The schedule moved on to its next firing
+	database.DB.First(schedule, schedule.ID)
+	if want := now.Add(24 * time.Hour); !schedule.NextRunAt.Equal(want) {
+		t.Fatalf("next run at %v, want %v", schedule.NextRunAt, want)
+	}
+	if fired, _ := r.RunDue(now.Add(time.Hour)); fired != 0 {
+		t.Fatalf("fired %d schedules before the next run", fired)
+	}
+}
+
+func TestRunDueSkipsWhilePreviousJobIsActive(t *testing.T) {
+	databasetest.Open(t)
+	now := time.Date(2026, time.October, 17, 3, 0, 0, 0, time.UTC)
+	schedule := newSchedule(t, now, false)
+	newDataset(t, "aaa")
+
+	r := NewRunner(time.Minute, time.Hour, nil)
+	first := fire(t, r, schedule)
+	if run := fire(t, r, schedule); run.Status != RunSkipped || run.JobID != nil {
+		t.Fatalf("run created while job %d is pending: %+v", *first.JobID, run)
+	}
+
+	database.DB.Exec("UPDATE jobs SET status = 'failed' WHERE id = ?", *first.JobID)
+	if run := fire(t, r, schedule); run.Status != RunCreated {
+		t.Fatalf("run after the previous job failed: %+v", run)
+	}
+}
+
+func TestRunDueSkipsUnchangedDataset(t *testing.T) {
+	databasetest.Open(t)
+	now := time.Date(2026, time.October, 17, 3, 0, 0, 0, time.UTC)
+	schedule := newSchedule(t, now, true)
+	newDataset(t, "aaa")
+
+	r := NewRunner(time.Minute, time.Hour, nil)
+	first := fire(t, r, schedule)
+	database.DB.Exec("UPDATE jobs SET status = 'completed' WHERE id = ?", *first.JobID)
+
+	if run := fire(t, r, schedule); run.Status != RunSkipped {
+		t.Fatalf("run on the dataset the last job trained on: %+v", run)
+	}
+
+	newDataset(t, "bbb")
+	if run := fire(t, r, schedule); run.Status != RunCreated || run.ContentHash != "bbb" {
+		t.Fatalf("run on a new dataset version: %+v", run)
+	}
+}
+
+func TestRunDueRecordsMissingDataset(t *testing.T) {
+	databasetest.Open(t)
+	now := time.Date(2026, time.October, 17, 3, 0, 0, 0, time.UTC)
+	schedule := newSchedule(t, now, false)
+
+	run := fire(t, NewRunner(time.Minute, time.Hour, nil), schedule)
+	if run.Status != RunFailed || run.JobID != nil {
+		t.Fatalf("unexpected run %+v", run)
+	}
+	// A failed run doesn't stop the schedule
+	database.DB.First(schedule, schedule.ID)
+	if schedule.Paused || schedule.NextRunAt == nil {
+		t.Fatalf("schedule stopped: %+v", schedule)
+	}
+}
+
+func TestPrepare(t *testing.T) {
+	databasetest.Open(t)
+	preset, err := presets.Create("weekly", "", []byte(`{"base_model": "llama-3.2-1b"}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	now := time.Date(2026, time.October, 17, 10, 30, 0, 0, time.UTC)
+
+	schedule := models.Schedule{Name: " contracts ", Cron: "0 3 * * *", Timezone: "Europe/Paris", PresetID: preset.ID, DatasetName: "cuad"}
+	if err := Prepare(&schedule, now); err != nil {
+		t.Fatal(err)
+	}
+	if want := time.Date(2026, time.October, 18, 1, 0, 0, 0, time.UTC); schedule.Name != "contracts" || !schedule.NextRunAt.Equal(want) {
+		t.Fatalf("prepared %q for %v, want %v", schedule.Name, schedule.NextRunAt, want)
+	}
+
+	schedule.Paused = true
+	if err := Prepare(&schedule, now); err != nil || schedule.NextRunAt != nil {
+		t.Fatalf("paused schedule runs at %v (%v)", schedule.NextRunAt, err)
+	}
+
+	for _, invalid := range []models.Schedule{
+		{Cron: "0 3 * * *", PresetID: preset.ID, DatasetName: "cuad"},
+		{Name: "x", Cron: "0 3 * * *", PresetID: preset.ID},
+		{Name: "x", Cron: "0 25 * * *", PresetID: preset.ID, DatasetName: "cuad"},
+		{Name: "x", Cron: "0 3 * * *", Timezone: "Mars/Olympus", PresetID: preset.ID, DatasetName: "cuad"},
+		{Name: "x", Cron: "0 3 * * *", PresetID: preset.ID + 1, DatasetName: "cuad"},
+	} {
+		if err := Prepare(&invalid, now); err == nil {
+			t.Errorf("prepared %+v", invalid)
+		}
+	}
+}
@@ -0,0 +1,93 @@
+// Package secrets encrypts credentials stored in the database with AES-256-GCM.
+package secrets
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// ErrNoKey is returned when SECRETS_ENCRYPTION_KEY is not configured
+var ErrNoKey = errors.New("SECRETS_ENCRYPTION_KEY is not configured")
+
+// prefix versions the ciphertext format so the key can be rotated later
+const prefix = "v1:"
+
+var aead cipher.AEAD
+
+// Init sets the encryption key: 32 bytes, hex or base64 encoded. An empty key
+// leaves encryption disabled.
+func Init(key string) error {
+	aead = nil
+	if key == "" {
+		return nil
+	}
+
+	raw, err := decodeKey(key)
+	if err != nil {
+		return err
+	}
+	block, err := aes.NewCipher(raw)
+	if err != nil {
+		return err
+	}
+	gcm, err := cipher.NewGCM(block)
+	if err != nil {
+		return err
+	}
+	aead = gcm
+	return nil
+}
+
+func decodeKey(key string) ([]byte, error) {
+	if raw, err := hex.DecodeString(key); err == nil && len(raw) == 32 {
+		return raw, nil
+	}
+	if raw, err := base64.StdEncoding.DecodeString(key); err == nil && len(raw) == 32 {
+		return raw, nil
+	}
+	return nil, fmt.Errorf("SECRETS_ENCRYPTION_KEY must be 32 bytes, hex or base64 encoded (generate one with: openssl rand -hex 32)")
+}
+
+// Enabled reports whether a key is configured
+func Enabled() bool {
+	return aead != nil
+}
+
+// Encrypt seals plaintext with a random nonce
+func Encrypt(plaintext string) (string, error) {
+	if aead == nil {
+		return "", ErrNoKey
+	}
+	nonce := make([]byte, aead.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return "", err
+	}
+	sealed := aead.Seal(nonce, nonce, []byte(plaintext), nil)
+	return prefix + base64.StdEncoding.EncodeToString(sealed), nil
+}
+
+// Decrypt opens a value produced by Encrypt
+func Decrypt(ciphertext string) (string, error) {
+	if aead == nil {
+		return "", ErrNoKey
+	}
+	if !strings.HasPrefix(ciphertext, prefix) {
+		return "", errors.New("unknown secret format")
+	}
+	sealed, err := base64.StdEncoding.DecodeString(strings.TrimPrefix(ciphertext, prefix))
+	if err != nil || len(sealed) < aead.NonceSize() {
+		return "", errors.New("malformed secret")
+	}
+	nonce, data := sealed[:aead.NonceSize()], sealed[aead.NonceSize():]
+	plaintext, err := aead.Open(nil, nonce, data, nil)
+	if err != nil {
+		return "", errors.New("secret cannot be decrypted with the configured key")
+	}
+	return string(plaintext), nil
+}
@@ -1,23 +1,36 @@
 package kaggle
 
 import (
+	"bytes"
+	"context"
 	"encoding/base64"
+	"encoding/json"
 	"fmt"
 	"io"
 	"net/http"
+	"regexp"
+	"strings"
 	"time"
+
+	"finetune-studio/internal/jobs/retry"
 )
 
-const BaseURL = "https://www.kaggle.com/api/v1"
+// DefaultBaseURL is the public Kaggle API
+const DefaultBaseURL = "https://www.kaggle.com/api/v1"
 
 type Client struct {
+	BaseURL  string // Overridable so tests can target a fake server
 	Username string
 	Key      string
 	HTTP     *http.Client
 }
 
-func NewClient(username, key string) *Client {
+func NewClient(baseURL, username, key string) *Client {
+	if baseURL == "" {
+		baseURL = DefaultBaseURL
+	}
 	return &Client{
+		BaseURL:  strings.TrimRight(baseURL, "/"),
 		Username: username,
 		Key:      key,
 		HTTP: &http.Client{
@@ -26,8 +39,39 @@ func NewClient(username, key string) *Client {
 	}
 }
 
-func (c *Client) doRequest(method, endpoint string, body io.Reader, contentType string) ([]byte, error) {
-	req, err := http.NewRequest(method, BaseURL+endpoint, body)
+// APIError is a non-2xx answer from the Kaggle API, or a push Kaggle
+// answered with an error message
+type APIError struct {
+	StatusCode int
+	Status     string
+	Body       string
+}
+
+func (e *APIError) Error() string {
+	return fmt.Sprintf("kaggle api error: %s - %s", e.Status, e.Body)
+}
+
+// quotaMessage matches the messages Kaggle refuses a run with when the
+// account is out of accelerator time
+var quotaMessage = regexp.MustCompile(`(?i)\b(gpu|tpu|accelerator|weekly)\s+quota\b|\bquota\s+(of\s+[\d.]+\s+hours\s+)?(reached|exceeded|exhausted)\b`)
+
+// QuotaExceeded reports whether Kaggle refused the request because the
+// account has no GPU quota left
+func (e *APIError) QuotaExceeded() bool {
+	switch e.StatusCode {
+	case http.StatusOK, http.StatusForbidden, http.StatusTooManyRequests:
+		return quotaMessage.MatchString(e.Body)
+	}
+	return false
+}
+
+// class tells the retry logic which answers are worth another attempt
+func (e *APIError) class() retry.ErrorClass {
+	return retry.ClassifyStatus(e.StatusCode)
+}
+
+func (c *Client) doRequest(ctx context.Context, method, endpoint string, body io.Reader, contentType string) ([]byte, error) {
+	req, err := http.NewRequestWithContext(ctx, method, c.BaseURL+endpoint, body)
 	if err != nil {
 		return nil, err
 	}
@@ -35,7 +79,7 @@ func (c *Client) doRequest(method, endpoint string, body io.Reader, contentType
 	// Basic Auth
 	auth := base64.StdEncoding.EncodeToString([]byte(c.Username + ":" + c.Key))
 	req.Header.Add("Authorization", "Basic "+auth)
-	
+
 	if contentType != "" {
 		req.Header.Add("Content-Type", contentType)
 	}
@@ -52,8 +96,86 @@ func (c *Client) doRequest(method, endpoint string, body io.Reader, contentType
 	}
 
 	if resp.StatusCode >= 400 {
-		return nil, fmt.Errorf("kaggle api error: %s - %s", resp.Status, string(respBody))
+		apiErr := &APIError{StatusCode: resp.StatusCode, Status: resp.Status, Body: string(respBody)}
+		return nil, retry.Wrap(apiErr.class(), apiErr)
 	}
 
 	return respBody, nil
 }
+
+// doJSON sends in as a JSON body (when not nil) and decodes the answer into out
+func (c *Client) doJSON(ctx context.Context, method, endpoint string, in, out interface{}) error {
+	var body io.Reader
+	contentType := ""
+	if in != nil {
+		data, err := json.Marshal(in)
+		if err != nil {
+			return err
+		}
+		body = bytes.NewReader(data)
+		contentType = "application/json"
+	}
+
+	respBody, err := c.doRequest(ctx, method, endpoint, body, contentType)
+	if err != nil {
+		return err
+	}
+	if out == nil {
+		return nil
+	}
+	if err := json.Unmarshal(respBody, out); err != nil {
+		return fmt.Errorf("invalid kaggle api response for %s: %v", endpoint, err)
+	}
+	return nil
+}
+
+// upload PUTs content to a pre-signed upload URL returned by the API. These
+// URLs carry their own credentials, so no Authorization header is sent.
+func (c *Client) upload(ctx context.Context, url string, content io.Reader, size int64) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPut, url, content)
+	if err != nil {
+		return err
+	}
+	req.ContentLength = size
+
+	// Uploads may take longer than regular API calls
+	uploader := *c.HTTP
+	uploader.Timeout = 0
+	resp, err := uploader.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode >= 400 {
+		respBody, _ := io.ReadAll(resp.Body)
+		apiErr := &APIError{StatusCode: resp.StatusCode, Status: resp.Status, Body: string(respBody)}
+		return retry.Wrap(apiErr.class(), apiErr)
+	}
+	return nil
+}
+
+// download opens a pre-signed output URL. The size is -1 when the server
+// doesn't announce it.
+func (c *Client) download(ctx context.Context, url string) (io.ReadCloser, int64, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	// Outputs can be several GB, only the context bounds the transfer
+	downloader := *c.HTTP
+	downloader.Timeout = 0
+	resp, err := downloader.Do(req)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	if resp.StatusCode >= 400 {
+		respBody, _ := io.ReadAll(resp.Body)
+		resp.Body.Close()
+		apiErr := &APIError{StatusCode: resp.StatusCode, Status: resp.Status, Body: string(respBody)}
+		return nil, 0, retry.Wrap(apiErr.class(), apiErr)
+	}
+	return resp.Body, resp.ContentLength, nil
+}
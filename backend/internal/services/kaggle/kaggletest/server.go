@@ -0,0 +1,471 @@
+// Package kaggletest provides an in-process fake of the Kaggle API for tests.
+// It implements the endpoints used by kaggle.Service and runs every pushed
+// kernel through a scriptable lifecycle.
+package kaggletest
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// QuotaMessage is the push error returned while the GPU quota is exhausted
+const QuotaMessage = "Maximum weekly GPU quota of 30 hours reached"
+
+// LogLine is one entry of a kernel log
+type LogLine struct {
+	StreamName string  `json:"stream_name"`
+	Time       float64 `json:"time"`
+	Data       string  `json:"data"`
+}
+
+// Script drives the kernels pushed while it is set. Each status poll moves
+// the kernel one step through Statuses; the last status then sticks.
+type Script struct {
+	Statuses       []string
+	FailureMessage string            // Reported with the "error" status
+	Outputs        map[string][]byte // Files written to /kaggle/working
+	Log            []LogLine
+}
+
+// DefaultScript completes after one queued and one running poll and leaves
+// the outputs of the finetune notebook
+func DefaultScript() Script {
+	return Script{
+		Statuses: []string{"queued", "running", "complete"},
+		Outputs: map[string][]byte{
+			"lora_adapters/adapter_config.json":       []byte(`{"r": 16, "lora_alpha": 16}`),
+			"lora_adapters/adapter_model.safetensors": []byte("fake adapter weights"),
+			"gguf/unsloth.Q4_K_M.gguf":                []byte("fake gguf"),
+			"metrics.json":                            []byte(`{"loss": 0.42, "train_runtime": 120.5}`),
+		},
+		Log: []LogLine{
+			{StreamName: "stdout", Time: 1.5, Data: "Loading model\n"},
+			{StreamName: "stdout", Time: 60, Data: "{'loss': 0.42, 'epoch': 1.0}\n"},
+		},
+	}
+}
+
+// Dataset is a dataset uploaded to the fake
+type Dataset struct {
+	Ref      string
+	Versions [][]byte // Content of the uploaded file, one entry per version
+	Polls    int      // Status calls answered so far
+}
+
+// Kernel is a kernel pushed to the fake
+type Kernel struct {
+	Ref         string
+	Notebook    string
+	DataSources []string
+	Pushes      int
+	Polls       int
+	Cancelled   bool
+
+	script Script
+	step   int
+}
+
+// Status is the status the kernel currently reports
+func (k *Kernel) Status() string {
+	if k.Cancelled {
+		return "cancelAcknowledged"
+	}
+	if len(k.script.Statuses) == 0 {
+		return "complete"
+	}
+	return k.script.Statuses[k.step]
+}
+
+// Server is a fake Kaggle API listening on a local port
+type Server struct {
+	*httptest.Server
+
+	// DatasetPendingPolls is how many status calls report a new dataset as
+	// pending before it becomes ready
+	DatasetPendingPolls int
+
+	mu          sync.Mutex
+	script      Script
+	datasets    map[string]*Dataset
+	kernels     map[string]*Kernel
+	uploads     map[string][]byte
+	quotaPushes int
+	failures    map[string][]int
+	nextToken   int
+}
+
+// NewServer starts a fake using DefaultScript. Close it when done.
+func NewServer() *Server {
+	s := &Server{
+		script:   DefaultScript(),
+		datasets: make(map[string]*Dataset),
+		kernels:  make(map[string]*Kernel),
+		uploads:  make(map[string][]byte),
+		failures: make(map[string][]int),
+	}
+	s.Server = httptest.NewServer(http.HandlerFunc(s.serve))
+	return s
+}
+
+// APIURL is the base URL to give kaggle.NewClient
+func (s *Server) APIURL() string {
+	return s.URL + "/api/v1"
+}
+
+// SetScript changes the lifecycle of kernels pushed from now on
+func (s *Server) SetScript(script Script) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.script = script
+}
+
+// QuotaExceeded makes the next n kernel pushes fail with QuotaMessage
+func (s *Server) QuotaExceeded(n int) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.quotaPushes = n
+}
+
+// FailNext answers the next calls whose path starts with prefix (relative
+// to the API root, e.g. "/kernels/status") with the given HTTP statuses
+func (s *Server) FailNext(prefix string, statuses ...int) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.failures[prefix] = append(s.failures[prefix], statuses...)
+}
+
+// Dataset returns a copy of an uploaded dataset
+func (s *Server) Dataset(ref string) (Dataset, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	d, ok := s.datasets[ref]
+	if !ok {
+		return Dataset{}, false
+	}
+	return *d, true
+}
+
+// Kernel returns a copy of a pushed kernel
+func (s *Server) Kernel(ref string) (Kernel, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	k, ok := s.kernels[ref]
+	if !ok {
+		return Kernel{}, false
+	}
+	return *k, true
+}
+
+// Kernels lists the refs of the pushed kernels
+func (s *Server) Kernels() []string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	refs := make([]string, 0, len(s.kernels))
+	for ref := range s.kernels {
+		refs = append(refs, ref)
+	}
+	sort.Strings(refs)
+	return refs
+}
+
+func (s *Server) serve(w http.ResponseWriter, r *http.Request) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	switch {
+	case r.Method == http.MethodPut && strings.HasPrefix(r.URL.Path, "/upload/"):
+		s.receiveUpload(w, r)
+		return
+	case r.Method == http.MethodGet && strings.HasPrefix(r.URL.Path, "/outputs/"):
+		s.serveOutput(w, r)
+		return
+	}
+
+	endpoint := strings.TrimPrefix(r.URL.Path, "/api/v1")
+	if status, ok := s.injectedFailure(endpoint); ok {
+		http.Error(w, http.StatusText(status), status)
+		return
+	}
+
+	switch {
+	case r.Method == http.MethodPost && strings.HasPrefix(endpoint, "/datasets/upload/file/"):
+		s.startUpload(w, r)
+	case r.Method == http.MethodPost && endpoint == "/datasets/create/new":
+		s.createDataset(w, r)
+	case r.Method == http.MethodPost && strings.HasPrefix(endpoint, "/datasets/create/version/"):
+		s.createDatasetVersion(w, r, strings.TrimPrefix(endpoint, "/datasets/create/version/"))
+	case r.Method == http.MethodGet && strings.HasPrefix(endpoint, "/datasets/status/"):
+		s.datasetStatus(w, strings.TrimPrefix(endpoint, "/datasets/status/"))
+	case r.Method == http.MethodPost && endpoint == "/kernels/push":
+		s.pushKernel(w, r)
+	case r.Method == http.MethodGet && endpoint == "/kernels/status":
+		s.kernelStatus(w, r)
+	case r.Method == http.MethodGet && endpoint == "/kernels/output":
+		s.kernelOutput(w, r)
+	case r.Method == http.MethodPost && endpoint == "/kernels/cancel":
+		s.cancelKernel(w, r)
+	default:
+		http.Error(w, "not found", http.StatusNotFound)
+	}
+}
+
+func (s *Server) injectedFailure(endpoint string) (int, bool) {
+	for prefix, statuses := range s.failures {
+		if len(statuses) > 0 && strings.HasPrefix(endpoint, prefix) {
+			s.failures[prefix] = statuses[1:]
+			return statuses[0], true
+		}
+	}
+	return 0, false
+}
+
+func (s *Server) startUpload(w http.ResponseWriter, r *http.Request) {
+	if err := r.ParseForm(); err != nil || r.PostForm.Get("fileName") == "" {
+		http.Error(w, "fileName is required", http.StatusBadRequest)
+		return
+	}
+	s.nextToken++
+	token := fmt.Sprintf("upload-%d", s.nextToken)
+	writeJSON(w, map[string]string{
+		"token":     token,
+		"createUrl": s.URL + "/upload/" + token,
+	})
+}
+
+func (s *Server) receiveUpload(w http.ResponseWriter, r *http.Request) {
+	data, err := io.ReadAll(r.Body)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	s.uploads[strings.TrimPrefix(r.URL.Path, "/upload/")] = data
+	w.WriteHeader(http.StatusOK)
+}
+
+type fileToken struct {
+	Token string `json:"token"`
+}
+
+// uploaded returns the content of the first uploaded file referenced by files
+func (s *Server) uploaded(files []fileToken) ([]byte, bool) {
+	if len(files) == 0 {
+		return nil, false
+	}
+	data, ok := s.uploads[files[0].Token]
+	return data, ok
+}
+
+func (s *Server) createDataset(w http.ResponseWriter, r *http.Request) {
+	var req struct {
+		Slug      string      `json:"slug"`
+		OwnerSlug string      `json:"ownerSlug"`
+		Files     []fileToken `json:"files"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	ref := req.OwnerSlug + "/" + req.Slug
+	data, ok := s.uploaded(req.Files)
+	switch {
+	case !ok:
+		writeJSON(w, map[string]string{"error": "No files uploaded"})
+		return
+	case s.datasets[ref] != nil:
+		writeJSON(w, map[string]string{"error": "The requested title is already in use by a dataset"})
+		return
+	}
+
+	s.datasets[ref] = &Dataset{Ref: ref, Versions: [][]byte{data}}
+	writeJSON(w, map[string]string{"ref": "/datasets/" + ref, "url": "https://www.kaggle.com/datasets/" + ref, "status": "ok"})
+}
+
+func (s *Server) createDatasetVersion(w http.ResponseWriter, r *http.Request, ref string) {
+	var req struct {
+		Files []fileToken `json:"files"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	dataset := s.datasets[ref]
+	data, ok := s.uploaded(req.Files)
+	switch {
+	case dataset == nil:
+		http.Error(w, "dataset not found", http.StatusNotFound)
+		return
+	case !ok:
+		writeJSON(w, map[string]string{"error": "No files uploaded"})
+		return
+	}
+
+	dataset.Versions = append(dataset.Versions, data)
+	dataset.Polls = 0
+	writeJSON(w, map[string]string{"ref": "/datasets/" + ref, "url": "https://www.kaggle.com/datasets/" + ref, "status": "ok"})
+}
+
+func (s *Server) datasetStatus(w http.ResponseWriter, ref string) {
+	dataset := s.datasets[ref]
+	if dataset == nil {
+		http.Error(w, "dataset not found", http.StatusNotFound)
+		return
+	}
+	dataset.Polls++
+	if dataset.Polls <= s.DatasetPendingPolls {
+		writeJSON(w, "pending")
+		return
+	}
+	writeJSON(w, "ready")
+}
+
+func (s *Server) pushKernel(w http.ResponseWriter, r *http.Request) {
+	var req struct {
+		Slug               string   `json:"slug"`
+		Text               string   `json:"text"`
+		DatasetDataSources []string `json:"datasetDataSources"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	if s.quotaPushes > 0 {
+		s.quotaPushes--
+		writeJSON(w, map[string]string{"error": QuotaMessage})
+		return
+	}
+	for _, source := range req.DatasetDataSources {
+		if s.datasets[source] == nil {
+			writeJSON(w, map[string]string{"error": "Dataset not found: " + source})
+			return
+		}
+	}
+
+	kernel := s.kernels[req.Slug]
+	if kernel == nil {
+		kernel = &Kernel{Ref: req.Slug}
+		s.kernels[req.Slug] = kernel
+	}
+	// Pushing again starts a new version from the beginning of the script
+	kernel.Notebook = req.Text
+	kernel.DataSources = req.DatasetDataSources
+	kernel.Pushes++
+	kernel.Polls = 0
+	kernel.Cancelled = false
+	kernel.script = s.script
+	kernel.step = 0
+
+	writeJSON(w, map[string]interface{}{
+		"ref":           "/code/" + req.Slug,
+		"url":           "https://www.kaggle.com/code/" + req.Slug,
+		"versionNumber": kernel.Pushes,
+	})
+}
+
+// kernel finds the kernel named by the userName and kernelSlug parameters
+func (s *Server) kernel(w http.ResponseWriter, r *http.Request) *Kernel {
+	query := r.URL.Query()
+	kernel := s.kernels[query.Get("userName")+"/"+query.Get("kernelSlug")]
+	if kernel == nil {
+		http.Error(w, "kernel not found", http.StatusNotFound)
+	}
+	return kernel
+}
+
+func (s *Server) kernelStatus(w http.ResponseWriter, r *http.Request) {
+	kernel := s.kernel(w, r)
+	if kernel == nil {
+		return
+	}
+
+	status := kernel.Status()
+	kernel.Polls++
+	if kernel.step < len(kernel.script.Statuses)-1 {
+		kernel.step++
+	}
+
+	response := map[string]string{"status": status}
+	if status == "error" {
+		response["failureMessage"] = kernel.script.FailureMessage
+	}
+	writeJSON(w, response)
+}
+
+func (s *Server) kernelOutput(w http.ResponseWriter, r *http.Request) {
+	kernel := s.kernel(w, r)
+	if kernel == nil {
+		return
+	}
+
+	names := make([]string, 0, len(kernel.script.Outputs))
+	for name := range kernel.script.Outputs {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	// Two files per page so clients have to follow nextPageToken
+	start, _ := strconv.Atoi(r.URL.Query().Get("pageToken"))
+	end := start + 2
+	if end > len(names) {
+		end = len(names)
+	}
+
+	files := []map[string]string{}
+	for _, name := range names[start:end] {
+		files = append(files, map[string]string{
+			"fileName": name,
+			"url":      s.URL + "/outputs/" + kernel.Ref + "/" + name,
+		})
+	}
+
+	logJSON, _ := json.Marshal(kernel.script.Log)
+	response := map[string]interface{}{"files": files, "log": string(logJSON)}
+	if end < len(names) {
+		response["nextPageToken"] = strconv.Itoa(end)
+	}
+	writeJSON(w, response)
+}
+
+func (s *Server) serveOutput(w http.ResponseWriter, r *http.Request) {
+	parts := strings.SplitN(strings.TrimPrefix(r.URL.Path, "/outputs/"), "/", 3)
+	if len(parts) != 3 {
+		http.Error(w, "not found", http.StatusNotFound)
+		return
+	}
+	kernel := s.kernels[path.Join(parts[0], parts[1])]
+	if kernel == nil {
+		http.Error(w, "not found", http.StatusNotFound)
+		return
+	}
+	data, ok := kernel.script.Outputs[parts[2]]
+	if !ok {
+		http.Error(w, "not found", http.StatusNotFound)
+		return
+	}
+	w.Header().Set("Content-Length", strconv.Itoa(len(data)))
+	w.Write(data)
+}
+
+func (s *Server) cancelKernel(w http.ResponseWriter, r *http.Request) {
+	kernel := s.kernel(w, r)
+	if kernel == nil {
+		return
+	}
+	kernel.Cancelled = true
+	writeJSON(w, map[string]string{})
+}
+
+func writeJSON(w http.ResponseWriter, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(v)
+}
@@ -1,181 +1,392 @@
 package kaggle
 
 import (
+	"context"
 	"encoding/json"
 	"fmt"
+	"io"
+	"net/http"
+	"net/url"
 	"os"
-	"os/exec"
 	"path/filepath"
+	"regexp"
 	"strings"
+	"time"
+
+	"finetune-studio/internal/jobs/retry"
 )
 
+// Service wraps the Kaggle API calls a training run needs
 type Service struct {
-	// CLI relies on KAGGLE_USERNAME and KAGGLE_KEY env vars
-	WorkDir string
+	Client *Client
+
+	// DatasetPollInterval is how often WaitForDataset checks processing
+	DatasetPollInterval time.Duration
+}
+
+func NewService(client *Client) *Service {
+	return &Service{
+		Client:              client,
+		DatasetPollInterval: 5 * time.Second,
+	}
+}
+
+// Kernel statuses reported by the API
+const (
+	KernelQueued             = "queued"
+	KernelRunning            = "running"
+	KernelComplete           = "complete"
+	KernelError              = "error"
+	KernelCancelRequested    = "cancelRequested"
+	KernelCancelAcknowledged = "cancelAcknowledged"
+)
+
+// KernelStatus is the state of the latest run of a kernel
+type KernelStatus struct {
+	Status         string `json:"status"`
+	FailureMessage string `json:"failureMessage"`
+}
+
+// OutputFile is a file a kernel run wrote to /kaggle/working
+type OutputFile struct {
+	FileName string `json:"fileName"`
+	URL      string `json:"url"`
 }
 
-func NewService(workDir string) *Service {
-	return &Service{WorkDir: workDir}
+// KernelOutput lists the outputs of the latest run of a kernel. Log is the
+// JSON array of {stream_name, time, data} entries Kaggle records.
+type KernelOutput struct {
+	Files         []OutputFile `json:"files"`
+	Log           string       `json:"log"`
+	NextPageToken string       `json:"nextPageToken"`
 }
 
-// DatasetMetadata matches dataset-metadata.json
-type DatasetMetadata struct {
-	Title     string    `json:"title"`
-	Id        string    `json:"id"`
-	Licenses  []License `json:"licenses"`
-	IsPrivate bool      `json:"isPrivate"`
+type uploadTicket struct {
+	Token     string `json:"token"`
+	CreateURL string `json:"createUrl"`
 }
 
-type License struct {
-	Name string `json:"name"`
+type uploadedFile struct {
+	Token string `json:"token"`
 }
 
-// KernelMetadata matches kernel-metadata.json
-type KernelMetadata struct {
-	Id                 string   `json:"id"`
-	Title              string   `json:"title"`
-	CodeFile           string   `json:"code_file"`
-	Language           string   `json:"language"`
-	KernelType         string   `json:"kernel_type"`
-	IsPrivate          bool     `json:"is_private"`
-	EnableGpu          bool     `json:"enable_gpu"`
-	EnableInternet     bool     `json:"enable_internet"`
-	DatasetSources     []string `json:"dataset_sources"`
-	KernelSources      []string `json:"kernel_sources"`
-	CompetitionSources []string `json:"competition_sources"`
+type datasetNewRequest struct {
+	Title       string         `json:"title"`
+	Slug        string         `json:"slug"`
+	OwnerSlug   string         `json:"ownerSlug"`
+	LicenseName string         `json:"licenseName"`
+	IsPrivate   bool           `json:"isPrivate"`
+	Files       []uploadedFile `json:"files"`
 }
 
-// CreateDataset creates a new dataset on Kaggle from a local file
-func (s *Service) CreateDataset(name string, filePath string) (string, error) {
-	// 1. Prepare Staging Directory
-	stagingDir := filepath.Join(s.WorkDir, "staging_datasets", sanitize(name))
-	if err := os.MkdirAll(stagingDir, 0755); err != nil {
+type datasetVersionRequest struct {
+	VersionNotes      string         `json:"versionNotes"`
+	DeleteOldVersions bool           `json:"deleteOldVersions"`
+	Files             []uploadedFile `json:"files"`
+}
+
+type datasetCreateResponse struct {
+	Ref    string `json:"ref"`
+	URL    string `json:"url"`
+	Status string `json:"status"`
+	Error  string `json:"error"`
+}
+
+type kernelPushRequest struct {
+	Slug                   string   `json:"slug"`
+	NewTitle               string   `json:"newTitle"`
+	Text                   string   `json:"text"`
+	Language               string   `json:"language"`
+	KernelType             string   `json:"kernelType"`
+	IsPrivate              bool     `json:"isPrivate"`
+	EnableGpu              bool     `json:"enableGpu"`
+	EnableInternet         bool     `json:"enableInternet"`
+	DatasetDataSources     []string `json:"datasetDataSources"`
+	KernelDataSources      []string `json:"kernelDataSources"`
+	CompetitionDataSources []string `json:"competitionDataSources"`
+	CategoryIds            []string `json:"categoryIds"`
+}
+
+type kernelPushResponse struct {
+	Ref           string `json:"ref"`
+	URL           string `json:"url"`
+	VersionNumber int    `json:"versionNumber"`
+	Error         string `json:"error"`
+}
+
+// CreateDataset creates a new private dataset on Kaggle from local files
+func (s *Service) CreateDataset(ctx context.Context, name string, filePaths ...string) (string, error) {
+	files, err := s.uploadFiles(ctx, filePaths)
+	if err != nil {
 		return "", err
 	}
-	defer os.RemoveAll(stagingDir)
 
-	// 2. Copy File
-	destFile := filepath.Join(stagingDir, filepath.Base(filePath))
-	// Simulating copy (or actually copy/link)
-	// For now, assuming input is content byte array or we copy from existing path
-	// In the worker, we download from MinIO to a temp path, so we can just move/copy it.
-	// For this implementation, I'll assume filePath is accessible.
-	input, err := os.ReadFile(filePath)
+	var resp datasetCreateResponse
+	err = s.Client.doJSON(ctx, http.MethodPost, "/datasets/create/new", datasetNewRequest{
+		Title:       name,
+		Slug:        sanitize(name),
+		OwnerSlug:   s.Client.Username,
+		LicenseName: "CC0-1.0",
+		IsPrivate:   true,
+		Files:       files,
+	}, &resp)
 	if err != nil {
-		return "", fmt.Errorf("failed to read input file: %v", err)
+		return "", err
 	}
-	if err := os.WriteFile(destFile, input, 0644); err != nil {
-		return "", fmt.Errorf("failed to copy file to staging: %v", err)
+	if resp.Error != "" {
+		return "", fmt.Errorf("failed to create dataset %s: %s", name, resp.Error)
 	}
 
-	// 3. Create Metadata
-	slug := sanitize(name)
-	username := os.Getenv("KAGGLE_USERNAME") // Assuming env var is set
-	if username == "" {
-		return "", fmt.Errorf("KAGGLE_USERNAME not set")
-	}
-	ref := fmt.Sprintf("%s/%s", username, slug)
+	return s.datasetRef(resp.Ref, sanitize(name)), nil
+}
 
-	meta := DatasetMetadata{
-		Title:     name,
-		Id:        ref,
-		Licenses:  []License{{Name: "CC0-1.0"}},
-		IsPrivate: true,
+// CreateDatasetVersion uploads files as a new version of an existing dataset
+func (s *Service) CreateDatasetVersion(ctx context.Context, ref string, notes string, filePaths ...string) (string, error) {
+	owner, slug, err := splitRef(ref)
+	if err != nil {
+		return "", err
 	}
 
-	metaBytes, _ := json.MarshalIndent(meta, "", "  ")
-	if err := os.WriteFile(filepath.Join(stagingDir, "dataset-metadata.json"), metaBytes, 0644); err != nil {
+	files, err := s.uploadFiles(ctx, filePaths)
+	if err != nil {
 		return "", err
 	}
 
-	// 4. Run CLI: kaggle datasets create -p .
-	cmd := exec.Command("kaggle", "datasets", "create", "-p", stagingDir, "--dir-mode", "zip")
-	cmd.Env = os.Environ() // Pass KAGGLE_USERNAME/KEY
-	out, err := cmd.CombinedOutput()
+	var resp datasetCreateResponse
+	endpoint := fmt.Sprintf("/datasets/create/version/%s/%s", url.PathEscape(owner), url.PathEscape(slug))
+	err = s.Client.doJSON(ctx, http.MethodPost, endpoint, datasetVersionRequest{
+		VersionNotes: notes,
+		Files:        files,
+	}, &resp)
 	if err != nil {
-		return "", fmt.Errorf("kaggle cli error: %v, output: %s", err, string(out))
+		return "", err
+	}
+	if resp.Error != "" {
+		return "", fmt.Errorf("failed to version dataset %s: %s", ref, resp.Error)
 	}
 
-	return ref, nil
+	return s.datasetRef(resp.Ref, slug), nil
 }
 
-// PushKernel deploys a notebook to Kaggle
-func (s *Service) PushKernel(slug string, notebookContent []byte, datasetRefs []string) (string, error) {
-	stagingDir := filepath.Join(s.WorkDir, "staging_kernels", slug)
-	if err := os.MkdirAll(stagingDir, 0755); err != nil {
+// DatasetStatus returns the processing status of a dataset: ready, pending or error
+func (s *Service) DatasetStatus(ctx context.Context, ref string) (string, error) {
+	owner, slug, err := splitRef(ref)
+	if err != nil {
 		return "", err
 	}
-	defer os.RemoveAll(stagingDir)
 
-	// 1. Write Notebook
-	if err := os.WriteFile(filepath.Join(stagingDir, "notebook.ipynb"), notebookContent, 0644); err != nil {
+	var status string
+	endpoint := fmt.Sprintf("/datasets/status/%s/%s", url.PathEscape(owner), url.PathEscape(slug))
+	if err := s.Client.doJSON(ctx, http.MethodGet, endpoint, nil, &status); err != nil {
 		return "", err
 	}
+	return strings.ToLower(status), nil
+}
 
-	// 2. Write Metadata
-	username := os.Getenv("KAGGLE_USERNAME")
-	ref := fmt.Sprintf("%s/%s", username, slug)
+// WaitForDataset blocks until Kaggle has processed a dataset upload. Kernels
+// pushed against a dataset that is still processing start without it.
+func (s *Service) WaitForDataset(ctx context.Context, ref string) error {
+	for {
+		status, err := s.DatasetStatus(ctx, ref)
+		if err != nil {
+			return err
+		}
+		switch status {
+		case "ready":
+			return nil
+		case "error":
+			return fmt.Errorf("kaggle failed to process dataset %s", ref)
+		}
 
-	meta := KernelMetadata{
-		Id:                 ref,
-		Title:              slug, // Use slug as title for simplicity
-		CodeFile:           "notebook.ipynb",
-		Language:           "python",
-		KernelType:         "notebook",
-		IsPrivate:          true,
-		EnableGpu:          true,
-		EnableInternet:     true,
-		DatasetSources:     datasetRefs,
-		KernelSources:      []string{},
-		CompetitionSources: []string{},
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(s.DatasetPollInterval):
+		}
 	}
-	if meta.DatasetSources == nil {
-		meta.DatasetSources = []string{}
+}
+
+// PushKernel deploys a notebook to Kaggle and starts a GPU run of it
+func (s *Service) PushKernel(ctx context.Context, slug string, notebookContent []byte, datasetRefs []string) (string, error) {
+	if datasetRefs == nil {
+		datasetRefs = []string{}
 	}
 
-	metaBytes, _ := json.MarshalIndent(meta, "", "  ")
-	if err := os.WriteFile(filepath.Join(stagingDir, "kernel-metadata.json"), metaBytes, 0644); err != nil {
+	var resp kernelPushResponse
+	err := s.Client.doJSON(ctx, http.MethodPost, "/kernels/push", kernelPushRequest{
+		Slug:                   fmt.Sprintf("%s/%s", s.Client.Username, sanitize(slug)),
+		NewTitle:               slug,
+		Text:                   string(notebookContent),
+		Language:               "python",
+		KernelType:             "notebook",
+		IsPrivate:              true,
+		EnableGpu:              true,
+		EnableInternet:         true,
+		DatasetDataSources:     datasetRefs,
+		KernelDataSources:      []string{},
+		CompetitionDataSources: []string{},
+		CategoryIds:            []string{},
+	}, &resp)
+	if err != nil {
 		return "", err
 	}
+	if resp.Error != "" {
+		// Refusals such as an exhausted GPU quota come back as a successful
+		// answer carrying the message
+		apiErr := &APIError{StatusCode: http.StatusOK, Status: "push of " + slug + " refused", Body: resp.Error}
+		return "", retry.Wrap(retry.ClassifyMessage(resp.Error), apiErr)
+	}
 
-	// 3. Run CLI: kaggle kernels push -p .
-	cmd := exec.Command("kaggle", "kernels", "push", "-p", stagingDir)
-	cmd.Env = os.Environ()
-	out, err := cmd.CombinedOutput()
+	ref := strings.TrimPrefix(strings.TrimPrefix(resp.Ref, "/"), "code/")
+	if strings.Count(ref, "/") != 1 {
+		ref = fmt.Sprintf("%s/%s", s.Client.Username, sanitize(slug))
+	}
+	return ref, nil
+}
+
+// GetKernelStatus returns the status of the latest run of a kernel
+func (s *Service) GetKernelStatus(ctx context.Context, ref string) (KernelStatus, error) {
+	owner, slug, err := splitRef(ref)
 	if err != nil {
-		return "", fmt.Errorf("kaggle cli error: %v, output: %s", err, string(out))
+		return KernelStatus{}, err
 	}
 
-	return ref, nil
+	var status KernelStatus
+	endpoint := fmt.Sprintf("/kernels/status?userName=%s&kernelSlug=%s", url.QueryEscape(owner), url.QueryEscape(slug))
+	if err := s.Client.doJSON(ctx, http.MethodGet, endpoint, nil, &status); err != nil {
+		return KernelStatus{}, err
+	}
+	return status, nil
+}
+
+// ListKernelOutput lists the output files and the log of the latest run of a kernel
+func (s *Service) ListKernelOutput(ctx context.Context, ref string) (*KernelOutput, error) {
+	owner, slug, err := splitRef(ref)
+	if err != nil {
+		return nil, err
+	}
+
+	output := &KernelOutput{}
+	pageToken := ""
+	for {
+		endpoint := fmt.Sprintf("/kernels/output?userName=%s&kernelSlug=%s", url.QueryEscape(owner), url.QueryEscape(slug))
+		if pageToken != "" {
+			endpoint += "&pageToken=" + url.QueryEscape(pageToken)
+		}
+
+		var page KernelOutput
+		if err := s.Client.doJSON(ctx, http.MethodGet, endpoint, nil, &page); err != nil {
+			return nil, err
+		}
+		output.Files = append(output.Files, page.Files...)
+		if output.Log == "" {
+			output.Log = page.Log
+		}
+
+		if page.NextPageToken == "" {
+			return output, nil
+		}
+		pageToken = page.NextPageToken
+	}
+}
+
+// OpenOutputFile streams one output file of a kernel run
+func (s *Service) OpenOutputFile(ctx context.Context, file OutputFile) (io.ReadCloser, int64, error) {
+	if file.URL == "" {
+		return nil, 0, fmt.Errorf("output file %s has no download url", file.FileName)
+	}
+	return s.Client.download(ctx, file.URL)
+}
+
+// CancelKernel stops the running session of a kernel so it doesn't keep
+// using GPU quota
+func (s *Service) CancelKernel(ctx context.Context, ref string) error {
+	owner, slug, err := splitRef(ref)
+	if err != nil {
+		return err
+	}
+
+	endpoint := fmt.Sprintf("/kernels/cancel?userName=%s&kernelSlug=%s", url.QueryEscape(owner), url.QueryEscape(slug))
+	return s.Client.doJSON(ctx, http.MethodPost, endpoint, nil, nil)
+}
+
+// DatasetMountPath returns where a file of a dataset is mounted inside a kernel
+func DatasetMountPath(datasetRef string, fileName string) string {
+	slug := datasetRef[strings.LastIndex(datasetRef, "/")+1:]
+	return fmt.Sprintf("/kaggle/input/%s/%s", slug, fileName)
+}
+
+// uploadFiles uploads each file and returns the tokens referencing them
+func (s *Service) uploadFiles(ctx context.Context, filePaths []string) ([]uploadedFile, error) {
+	if len(filePaths) == 0 {
+		return nil, fmt.Errorf("no files to upload")
+	}
+	files := make([]uploadedFile, 0, len(filePaths))
+	for _, filePath := range filePaths {
+		token, err := s.uploadFile(ctx, filePath)
+		if err != nil {
+			return nil, err
+		}
+		files = append(files, uploadedFile{Token: token})
+	}
+	return files, nil
 }
 
-func (s *Service) GetKernelStatus(ref string) (string, error) {
-	// kaggle kernels status [ref]
-	cmd := exec.Command("kaggle", "kernels", "status", ref)
-	out, err := cmd.CombinedOutput()
+// uploadFile requests an upload URL for a local file, sends the file and
+// returns the token a dataset version references it by
+func (s *Service) uploadFile(ctx context.Context, filePath string) (string, error) {
+	file, err := os.Open(filePath)
+	if err != nil {
+		return "", fmt.Errorf("failed to read input file: %v", err)
+	}
+	defer file.Close()
+
+	info, err := file.Stat()
+	if err != nil {
+		return "", err
+	}
+
+	endpoint := fmt.Sprintf("/datasets/upload/file/%d/%d", info.Size(), info.ModTime().Unix())
+	form := url.Values{"fileName": {filepath.Base(filePath)}}
+	respBody, err := s.Client.doRequest(ctx, http.MethodPost, endpoint, strings.NewReader(form.Encode()), "application/x-www-form-urlencoded")
 	if err != nil {
-		return "", fmt.Errorf("failed to get status: %v, out: %s", err, string(out))
+		return "", err
+	}
+
+	var ticket uploadTicket
+	if err := json.Unmarshal(respBody, &ticket); err != nil || ticket.Token == "" || ticket.CreateURL == "" {
+		return "", fmt.Errorf("invalid upload ticket for %s: %s", filepath.Base(filePath), string(respBody))
+	}
+
+	if err := s.Client.upload(ctx, ticket.CreateURL, file, info.Size()); err != nil {
+		return "", fmt.Errorf("failed to upload %s: %w", filepath.Base(filePath), err)
 	}
+	return ticket.Token, nil
+}
 
-	output := strings.ToLower(string(out))
-	if strings.Contains(output, "complete") {
-		return "completed", nil
-	} else if strings.Contains(output, "running") || strings.Contains(output, "queued") {
-		return "running", nil
-	} else if strings.Contains(output, "error") || strings.Contains(output, "failed") {
-		return "failed", nil
-	} else if strings.Contains(output, "cancel") {
-		return "cancelled", nil
+// datasetRef normalises the ref returned by the API ("owner/slug" or a URL path)
+func (s *Service) datasetRef(returned, slug string) string {
+	ref := strings.TrimPrefix(strings.TrimPrefix(returned, "/"), "datasets/")
+	if strings.Count(ref, "/") != 1 {
+		ref = fmt.Sprintf("%s/%s", s.Client.Username, slug)
 	}
+	return ref
+}
 
-	return "unknown", nil
+func splitRef(ref string) (string, string, error) {
+	parts := strings.Split(ref, "/")
+	if len(parts) != 2 || parts[0] == "" || parts[1] == "" {
+		return "", "", fmt.Errorf("invalid kaggle reference %q, expected owner/slug", ref)
+	}
+	return parts[0], parts[1], nil
 }
 
-// Helper
+var slugInvalid = regexp.MustCompile(`[^a-z0-9-]+`)
+
+// sanitize turns a name into a Kaggle slug
 func sanitize(s string) string {
 	s = strings.ToLower(s)
 	s = strings.ReplaceAll(s, " ", "-")
-	// Remove non-alphanumeric except dash
-	// Simplified...
-	return s
+	s = slugInvalid.ReplaceAllString(s, "")
+	return strings.Trim(s, "-")
 }
@@ -0,0 +1,201 @@
+package kaggle_test
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"finetune-studio/internal/jobs/retry"
+	"finetune-studio/internal/services/kaggle"
+	"finetune-studio/internal/services/kaggle/kaggletest"
+)
+
+func newService(t *testing.T) (*kaggle.Service, *kaggletest.Server) {
+	t.Helper()
+	server := kaggletest.NewServer()
+	t.Cleanup(server.Close)
+
+	svc := kaggle.NewService(kaggle.NewClient(server.APIURL(), "tester", "secret"))
+	svc.DatasetPollInterval = time.Millisecond
+	return svc, server
+}
+
+func writeDataset(t *testing.T, content string) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "dataset.json")
+	if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestCreateDatasetAndVersion(t *testing.T) {
+	svc, server := newService(t)
+	server.DatasetPendingPolls = 2
+	ctx := context.Background()
+
+	ref, err := svc.CreateDataset(ctx, "Job 1 Dataset", writeDataset(t, `[{"text":"a"}]`))
+	if err != nil {
+		t.Fatalf("CreateDataset: %v", err)
+	}
+	if ref != "tester/job-1-dataset" {
+		t.Fatalf("ref = %q, want tester/job-1-dataset", ref)
+	}
+	if err := svc.WaitForDataset(ctx, ref); err != nil {
+		t.Fatalf("WaitForDataset: %v", err)
+	}
+
+	versionRef, err := svc.CreateDatasetVersion(ctx, ref, "second version", writeDataset(t, `[{"text":"b"}]`))
+	if err != nil {
+		t.Fatalf("CreateDatasetVersion: %v", err)
+	}
+	if versionRef != ref {
+		t.Fatalf("version ref = %q, want %q", versionRef, ref)
+	}
+
+	dataset, _ := server.Dataset(ref)
+	if len(dataset.Versions) != 2 || string(dataset.Versions[1]) != `[{"text":"b"}]` {
+		t.Fatalf("unexpected dataset versions: %q", dataset.Versions)
+	}
+}
+
+func TestKernelLifecycle(t *testing.T) {
+	svc, _ := newService(t)
+	ctx := context.Background()
+
+	datasetRef, err := svc.CreateDataset(ctx, "data", writeDataset(t, `[]`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	ref, err := svc.PushKernel(ctx, "finetune-job-1", []byte(`{"cells":[]}`), []string{datasetRef})
+	if err != nil {
+		t.Fatalf("PushKernel: %v", err)
+	}
+	if ref != "tester/finetune-job-1" {
+		t.Fatalf("ref = %q", ref)
+	}
+
+	var statuses []string
+	for i := 0; i < 4; i++ {
+		status, err := svc.GetKernelStatus(ctx, ref)
+		if err != nil {
+			t.Fatal(err)
+		}
+		statuses = append(statuses, status.Status)
+	}
+	want := "queued running complete complete"
+	if got := strings.Join(statuses, " "); got != want {
+		t.Fatalf("statuses = %q, want %q", got, want)
+	}
+
+	output, err := svc.ListKernelOutput(ctx, ref)
+	if err != nil {
+		t.Fatalf("ListKernelOutput: %v", err)
+	}
+	if len(output.Files) != len(kaggletest.DefaultScript().Outputs) {
+		t.Fatalf("got %d output files across pages, want %d", len(output.Files), len(kaggletest.DefaultScript().Outputs))
+	}
+	if !strings.Contains(output.Log, "Loading model") {
+		t.Fatalf("log not returned: %q", output.Log)
+	}
+
+	body, size, err := svc.OpenOutputFile(ctx, output.Files[0])
+	if err != nil {
+		t.Fatalf("OpenOutputFile: %v", err)
+	}
+	data, _ := io.ReadAll(body)
+	body.Close()
+	if int64(len(data)) != size || string(data) != string(kaggletest.DefaultScript().Outputs[output.Files[0].FileName]) {
+		t.Fatalf("unexpected content for %s: %q (size %d)", output.Files[0].FileName, data, size)
+	}
+}
+
+func TestKernelErrorReportsFailureMessage(t *testing.T) {
+	svc, server := newService(t)
+	server.SetScript(kaggletest.Script{
+		Statuses:       []string{"running", "error"},
+		FailureMessage: "CUDA out of memory",
+	})
+	ctx := context.Background()
+
+	ref, err := svc.PushKernel(ctx, "oom", []byte(`{}`), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	svc.GetKernelStatus(ctx, ref)
+	status, err := svc.GetKernelStatus(ctx, ref)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if status.Status != kaggle.KernelError || status.FailureMessage != "CUDA out of memory" {
+		t.Fatalf("status = %+v", status)
+	}
+}
+
+func TestCancelKernel(t *testing.T) {
+	svc, _ := newService(t)
+	ctx := context.Background()
+
+	ref, err := svc.PushKernel(ctx, "long", []byte(`{}`), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := svc.CancelKernel(ctx, ref); err != nil {
+		t.Fatalf("CancelKernel: %v", err)
+	}
+	status, _ := svc.GetKernelStatus(ctx, ref)
+	if status.Status != kaggle.KernelCancelAcknowledged {
+		t.Fatalf("status = %q, want %q", status.Status, kaggle.KernelCancelAcknowledged)
+	}
+}
+
+func TestErrorsAreClassified(t *testing.T) {
+	svc, server := newService(t)
+	ctx := context.Background()
+
+	server.QuotaExceeded(1)
+	_, err := svc.PushKernel(ctx, "quota", []byte(`{}`), nil)
+	var apiErr *kaggle.APIError
+	if !errors.As(err, &apiErr) || !apiErr.QuotaExceeded() || !strings.Contains(err.Error(), kaggletest.QuotaMessage) {
+		t.Fatalf("expected quota error, got %v", err)
+	}
+	if _, err := svc.PushKernel(ctx, "quota", []byte(`{}`), nil); err != nil {
+		t.Fatalf("push after quota error: %v", err)
+	}
+
+	server.FailNext("/kernels/status", http.StatusTooManyRequests, http.StatusBadGateway, http.StatusForbidden)
+	for _, want := range []retry.ErrorClass{retry.ClassRateLimit, retry.ClassServer, retry.ClassPermanent} {
+		_, err := svc.GetKernelStatus(ctx, "tester/quota")
+		if class := retry.Classify(err); class != want {
+			t.Fatalf("class = %q, want %q (err: %v)", class, want, err)
+		}
+	}
+}
+
+func TestQuotaExceeded(t *testing.T) {
+	tests := []struct {
+		status int
+		body   string
+		want   bool
+	}{
+		{http.StatusOK, kaggletest.QuotaMessage, true},
+		{http.StatusOK, "You have exceeded your weekly GPU quota", true},
+		{http.StatusForbidden, "Accelerator quota exhausted", true},
+		{http.StatusTooManyRequests, "Quota exceeded, try again later", true},
+		{http.StatusOK, "Kernel slug quota-analysis is already in use", false},
+		{http.StatusBadRequest, "Maximum weekly GPU quota of 30 hours reached", false},
+		{http.StatusNotFound, "dataset tester/quota-reports not found", false},
+	}
+	for _, tt := range tests {
+		err := &kaggle.APIError{StatusCode: tt.status, Body: tt.body}
+		if got := err.QuotaExceeded(); got != tt.want {
+			t.Errorf("%d %q: QuotaExceeded() = %v, want %v", tt.status, tt.body, got, tt.want)
+		}
+	}
+}
@@ -10,6 +10,7 @@ import (
 	"time"
 
 	"finetune-studio/internal/database"
+	"finetune-studio/internal/logmetrics"
 	"finetune-studio/internal/models"
 
 	"github.com/minio/minio-go/v7"
@@ -113,13 +114,19 @@ func (s *LogService) AggregateLogsFromMinIO(ctx context.Context, jobID uint) err
 	}
 
 	// Save new logs to DB
+	var saved []models.LogEntry
 	for _, entry := range logs {
 		entry.JobID = jobID
 		if err := s.SaveLogToDB(entry); err != nil {
 			log.Printf("Error saving log to DB: %v", err)
+			continue
 		}
+		saved = append(saved, entry)
 	}
 
+	// Training metrics printed by the run become metric points
+	logmetrics.Process(jobID, saved)
+
 	return nil
 }
 
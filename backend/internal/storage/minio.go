@@ -25,7 +25,7 @@ func Connect(endpoint, accessKey, secretKey string, useSSL bool) {
 }
 
 func initBuckets() {
-	buckets := []string{"datasets", "models", "logs"}
+	buckets := []string{"datasets", "models", "logs", "jobs"}
 	ctx := context.Background()
 
 	for _, bucket := range buckets {
@@ -0,0 +1,62 @@
+package sweeps
+
+import (
+	"encoding/json"
+	"sort"
+)
+
+const (
+	GoalMinimize = "minimize"
+	GoalMaximize = "maximize"
+)
+
+// Result is one trial of a sweep as shown in its summary
+type Result struct {
+	Rank    int                    `json:"rank,omitempty"` // 0 when the trial has no value for the metric
+	JobID   uint                   `json:"job_id"`
+	Status  string                 `json:"status"`
+	Params  map[string]interface{} `json:"params"`
+	Value   *float64               `json:"value"`
+	ModelID *uint                  `json:"model_id,omitempty"`
+}
+
+// MetricValue reads a numeric metric, preferring the training metrics the
+// run reported for its model over the job progress metrics
+func MetricValue(metric string, trainingMetrics, jobMetrics []byte) (float64, bool) {
+	for _, source := range [][]byte{trainingMetrics, jobMetrics} {
+		var values map[string]interface{}
+		if err := json.Unmarshal(source, &values); err != nil {
+			continue
+		}
+		if v, ok := values[metric].(float64); ok {
+			return v, true
+		}
+	}
+	return 0, false
+}
+
+// Rank orders results by value according to goal. Trials without a value
+// come last, in job order.
+func Rank(results []Result, goal string) {
+	sort.SliceStable(results, func(i, j int) bool {
+		a, b := results[i].Value, results[j].Value
+		switch {
+		case a == nil && b == nil:
+			return results[i].JobID < results[j].JobID
+		case a == nil:
+			return false
+		case b == nil:
+			return true
+		case goal == GoalMaximize:
+			return *a > *b
+		default:
+			return *a < *b
+		}
+	})
+
+	for i := range results {
+		if results[i].Value != nil {
+			results[i].Rank = i + 1
+		}
+	}
+}
@@ -0,0 +1,176 @@
+// Package sweeps expands a hyperparameter search space into trials and ranks
+// the finished trials of a sweep.
+package sweeps
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"math/rand"
+	"sort"
+	"strings"
+)
+
+const (
+	StrategyGrid   = "grid"
+	StrategyRandom = "random"
+
+	// MaxTrials bounds the number of child jobs a single sweep may create
+	MaxTrials = 100
+)
+
+// Parameters are the hyperparameters a sweep may search over
+var Parameters = []string{"learning_rate", "lora_rank", "epochs"}
+
+// integerParameters are sampled as whole numbers
+var integerParameters = map[string]bool{"lora_rank": true, "epochs": true}
+
+// Dimension is the search range of one hyperparameter: either an explicit
+// list of values, or a [min, max] range sampled by the random strategy
+type Dimension struct {
+	Values []float64 `json:"values,omitempty"`
+	Min    *float64  `json:"min,omitempty"`
+	Max    *float64  `json:"max,omitempty"`
+	Log    bool      `json:"log,omitempty"` // Sample the range on a log scale
+}
+
+// Space maps hyperparameter names to their dimension
+type Space map[string]Dimension
+
+// Trial is one point of the search space, merged into the base configuration
+type Trial map[string]interface{}
+
+// Validate checks the space can be expanded with the given strategy
+func (s Space) Validate(strategy string) error {
+	if strategy != StrategyGrid && strategy != StrategyRandom {
+		return fmt.Errorf("strategy must be %q or %q", StrategyGrid, StrategyRandom)
+	}
+	if len(s) == 0 {
+		return fmt.Errorf("search_space must define at least one of %s", strings.Join(Parameters, ", "))
+	}
+
+	for name, dim := range s {
+		if !contains(Parameters, name) {
+			return fmt.Errorf("search_space: %q cannot be searched (supported: %s)", name, strings.Join(Parameters, ", "))
+		}
+		hasRange := dim.Min != nil || dim.Max != nil
+		switch {
+		case len(dim.Values) > 0 && hasRange:
+			return fmt.Errorf("search_space.%s: set either values or min/max", name)
+		case len(dim.Values) > 0:
+			if integerParameters[name] {
+				for _, v := range dim.Values {
+					if v != math.Trunc(v) {
+						return fmt.Errorf("search_space.%s: values must be integers", name)
+					}
+				}
+			}
+		case hasRange:
+			if strategy == StrategyGrid {
+				return fmt.Errorf("search_space.%s: grid search needs a list of values", name)
+			}
+			if dim.Min == nil || dim.Max == nil || *dim.Min > *dim.Max {
+				return fmt.Errorf("search_space.%s: min and max are both required and min must not exceed max", name)
+			}
+			if dim.Log && *dim.Min <= 0 {
+				return fmt.Errorf("search_space.%s: log ranges must be positive", name)
+			}
+		default:
+			return fmt.Errorf("search_space.%s: set values or min/max", name)
+		}
+	}
+	return nil
+}
+
+// Expand returns the trials of a sweep. Grid search takes the cartesian
+// product of all values; random search draws numTrials points.
+func (s Space) Expand(strategy string, numTrials int, seed int64) ([]Trial, error) {
+	if err := s.Validate(strategy); err != nil {
+		return nil, err
+	}
+
+	names := make([]string, 0, len(s))
+	for name := range s {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	if strategy == StrategyGrid {
+		size := 1
+		for _, name := range names {
+			size *= len(s[name].Values)
+			if size > MaxTrials {
+				return nil, fmt.Errorf("grid has more than %d trials", MaxTrials)
+			}
+		}
+
+		trials := []Trial{{}}
+		for _, name := range names {
+			var next []Trial
+			for _, trial := range trials {
+				for _, v := range s[name].Values {
+					t := Trial{}
+					for k, existing := range trial {
+						t[k] = existing
+					}
+					t[name] = value(name, v)
+					next = append(next, t)
+				}
+			}
+			trials = next
+		}
+		return trials, nil
+	}
+
+	if numTrials < 1 || numTrials > MaxTrials {
+		return nil, fmt.Errorf("num_trials must be between 1 and %d", MaxTrials)
+	}
+
+	rng := rand.New(rand.NewSource(seed))
+	trials := make([]Trial, numTrials)
+	for i := range trials {
+		trials[i] = Trial{}
+		for _, name := range names {
+			trials[i][name] = value(name, s[name].sample(rng, integerParameters[name]))
+		}
+	}
+	return trials, nil
+}
+
+func (d Dimension) sample(rng *rand.Rand, integer bool) float64 {
+	if len(d.Values) > 0 {
+		return d.Values[rng.Intn(len(d.Values))]
+	}
+
+	lo, hi := *d.Min, *d.Max
+	if integer {
+		return math.Floor(lo + rng.Float64()*(math.Floor(hi)-lo+1))
+	}
+	if d.Log {
+		return math.Exp(math.Log(lo) + rng.Float64()*(math.Log(hi)-math.Log(lo)))
+	}
+	return lo + rng.Float64()*(hi-lo)
+}
+
+// value converts a sampled number to the JSON type the configuration expects
+func value(name string, v float64) interface{} {
+	if integerParameters[name] {
+		return int(v)
+	}
+	return v
+}
+
+// JSON encodes the trial as configuration overrides
+func (t Trial) JSON() []byte {
+	data, _ := json.Marshal(t)
+	return data
+}
+
+func contains(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
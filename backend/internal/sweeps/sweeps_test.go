@@ -0,0 +1,134 @@
+package sweeps
+
+import (
+	"fmt"
+	"math"
+	"reflect"
+	"testing"
+)
+
+func ptr(v float64) *float64 { return &v }
+
+func TestGridExpansion(t *testing.T) {
+	space := Space{
+		"learning_rate": {Values: []float64{1e-4, 2e-4}},
+		"lora_rank":     {Values: []float64{8, 16, 32}},
+	}
+	trials, err := space.Expand(StrategyGrid, 0, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(trials) != 6 {
+		t.Fatalf("got %d trials, want 6", len(trials))
+	}
+
+	seen := make(map[string]bool)
+	for _, trial := range trials {
+		if _, ok := trial["lora_rank"].(int); !ok {
+			t.Fatalf("lora_rank is %T, want an integer", trial["lora_rank"])
+		}
+		seen[string(trial.JSON())] = true
+	}
+	if len(seen) != 6 {
+		t.Fatalf("grid has duplicate trials: %v", trials)
+	}
+	if want := (Trial{"learning_rate": 1e-4, "lora_rank": 8}); !reflect.DeepEqual(trials[0], want) {
+		t.Fatalf("first trial %v, want %v", trials[0], want)
+	}
+}
+
+func TestGridIsBounded(t *testing.T) {
+	values := make([]float64, 11)
+	for i := range values {
+		values[i] = float64(i + 1)
+	}
+	space := Space{"lora_rank": {Values: values}, "epochs": {Values: values}}
+	if _, err := space.Expand(StrategyGrid, 0, 0); err == nil {
+		t.Fatal("121-trial grid accepted")
+	}
+}
+
+func TestRandomExpansion(t *testing.T) {
+	space := Space{
+		"learning_rate": {Min: ptr(1e-5), Max: ptr(1e-3), Log: true},
+		"epochs":        {Min: ptr(1), Max: ptr(3)},
+		"lora_rank":     {Values: []float64{8, 16}},
+	}
+	trials, err := space.Expand(StrategyRandom, 20, 42)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(trials) != 20 {
+		t.Fatalf("got %d trials, want 20", len(trials))
+	}
+	for _, trial := range trials {
+		lr := trial["learning_rate"].(float64)
+		epochs := trial["epochs"].(int)
+		rank := trial["lora_rank"].(int)
+		if lr < 1e-5 || lr > 1e-3 || epochs < 1 || epochs > 3 || (rank != 8 && rank != 16) {
+			t.Fatalf("trial out of the space: %v", trial)
+		}
+	}
+
+	// The seed makes a sweep reproducible
+	again, _ := space.Expand(StrategyRandom, 20, 42)
+	if !reflect.DeepEqual(trials, again) {
+		t.Fatal("same seed gave different trials")
+	}
+	other, _ := space.Expand(StrategyRandom, 20, 43)
+	if reflect.DeepEqual(trials, other) {
+		t.Fatal("different seeds gave the same trials")
+	}
+}
+
+func TestSpaceValidation(t *testing.T) {
+	invalid := []struct {
+		strategy string
+		space    Space
+	}{
+		{"bayesian", Space{"epochs": {Values: []float64{1}}}},
+		{StrategyGrid, Space{}},
+		{StrategyGrid, Space{"warmup_steps": {Values: []float64{10}}}},
+		{StrategyGrid, Space{"learning_rate": {Min: ptr(1e-5), Max: ptr(1e-3)}}},
+		{StrategyRandom, Space{"epochs": {Values: []float64{1.5}}}},
+		{StrategyRandom, Space{"learning_rate": {Values: []float64{1e-4}, Min: ptr(1e-5), Max: ptr(1e-3)}}},
+		{StrategyRandom, Space{"learning_rate": {Min: ptr(1e-3), Max: ptr(1e-5)}}},
+		{StrategyRandom, Space{"learning_rate": {Min: ptr(0), Max: ptr(1e-3), Log: true}}},
+		{StrategyRandom, Space{"learning_rate": {}}},
+	}
+	for _, tt := range invalid {
+		if err := tt.space.Validate(tt.strategy); err == nil {
+			t.Errorf("%s %v accepted", tt.strategy, tt.space)
+		}
+	}
+
+	space := Space{"epochs": {Values: []float64{1, 2}}}
+	for _, n := range []int{0, MaxTrials + 1} {
+		if _, err := space.Expand(StrategyRandom, n, 1); err == nil {
+			t.Errorf("%d random trials accepted", n)
+		}
+	}
+}
+
+func TestRank(t *testing.T) {
+	results := []Result{
+		{JobID: 1, Value: ptr(0.5)},
+		{JobID: 2},
+		{JobID: 3, Value: ptr(0.2)},
+		{JobID: 4, Value: ptr(math.Inf(1))},
+	}
+	Rank(results, GoalMinimize)
+
+	var order []string
+	for _, r := range results {
+		order = append(order, fmt.Sprintf("%d:%d", r.JobID, r.Rank))
+	}
+	if got := fmt.Sprint(order); got != "[3:1 1:2 4:3 2:0]" {
+		t.Fatalf("ranked %s", got)
+	}
+
+	Rank(results, GoalMaximize)
+	if results[0].JobID != 4 || results[3].JobID != 2 {
+		t.Fatalf("maximize ranked %v first and %v last", results[0].JobID, results[3].JobID)
+	}
+}
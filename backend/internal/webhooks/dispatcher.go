@@ -0,0 +1,301 @@
+package webhooks
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"finetune-studio/internal/database"
+	"finetune-studio/internal/jobs/retry"
+	"finetune-studio/internal/models"
+	"finetune-studio/internal/queue"
+	"finetune-studio/internal/secrets"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// Delivery statuses
+const (
+	DeliveryPending   = "pending"
+	DeliveryDelivered = "delivered"
+	DeliveryFailed    = "failed"
+)
+
+const (
+	// DefaultInterval is how often the dispatcher looks for new events and
+	// due deliveries
+	DefaultInterval = 5 * time.Second
+
+	// fanOutBatch bounds the events fanned out per transaction
+	fanOutBatch = 100
+
+	// deliveryLease bounds a single delivery attempt
+	deliveryLease = time.Minute
+
+	requestTimeout = 10 * time.Second
+)
+
+// Policy is the retry schedule of deliveries, about eight hours of attempts
+var Policy = retry.Policy{
+	MaxAttempts:    10,
+	InitialBackoff: retry.Duration(30 * time.Second),
+	MaxBackoff:     retry.Duration(4 * time.Hour),
+	Multiplier:     2,
+	RetryOn:        []retry.ErrorClass{retry.ClassNetwork, retry.ClassTimeout, retry.ClassRateLimit, retry.ClassServer},
+}
+
+// Dispatcher fans outbox events out to webhooks and sends the deliveries.
+// Every replica runs one; events and deliveries are claimed with SKIP LOCKED.
+type Dispatcher struct {
+	Owner    string
+	Interval time.Duration
+	Client   *http.Client
+
+	ctx    context.Context
+	cancel context.CancelFunc
+	wg     sync.WaitGroup
+}
+
+func NewDispatcher(interval time.Duration) *Dispatcher {
+	ctx, cancel := context.WithCancel(context.Background())
+	return &Dispatcher{
+		Owner:    queue.DefaultOwner(),
+		Interval: interval,
+		Client:   &http.Client{Timeout: requestTimeout},
+		ctx:      ctx,
+		cancel:   cancel,
+	}
+}
+
+func (d *Dispatcher) Start() {
+	d.wg.Add(1)
+	go func() {
+		defer d.wg.Done()
+		ticker := time.NewTicker(d.Interval)
+		defer ticker.Stop()
+		for {
+			if err := d.Run(); err != nil {
+				log.Printf("[Webhooks] %v", err)
+			}
+			select {
+			case <-d.ctx.Done():
+				return
+			case <-ticker.C:
+			}
+		}
+	}()
+	log.Printf("📨 Webhook dispatcher started, checking every %s", d.Interval)
+}
+
+func (d *Dispatcher) Stop() {
+	d.cancel()
+	d.wg.Wait()
+}
+
+// Run fans out every pending event, then sends every due delivery
+func (d *Dispatcher) Run() error {
+	for d.ctx.Err() == nil {
+		n, err := d.fanOut(time.Now())
+		if err != nil {
+			return fmt.Errorf("failed to fan out events: %w", err)
+		}
+		if n < fanOutBatch {
+			break
+		}
+	}
+
+	for d.ctx.Err() == nil {
+		delivery, err := d.claim(time.Now())
+		if err != nil {
+			return fmt.Errorf("failed to claim delivery: %w", err)
+		}
+		if delivery == nil {
+			return nil
+		}
+		d.deliver(delivery)
+	}
+	return nil
+}
+
+// fanOut creates one delivery per matching enabled webhook for a batch of
+// undispatched events, and marks the events dispatched in the same
+// transaction. Webhooks registered later don't receive earlier events.
+func (d *Dispatcher) fanOut(now time.Time) (int, error) {
+	count := 0
+	err := database.DB.Transaction(func(tx *gorm.DB) error {
+		var events []models.OutboxEvent
+		err := tx.Clauses(clause.Locking{Strength: "UPDATE", Options: "SKIP LOCKED"}).
+			Where("dispatched_at IS NULL").
+			Order("id").
+			Limit(fanOutBatch).
+			Find(&events).Error
+		if err != nil || len(events) == 0 {
+			return err
+		}
+		count = len(events)
+
+		var webhooks []models.Webhook
+		if err := tx.Where("enabled = ?", true).Find(&webhooks).Error; err != nil {
+			return err
+		}
+
+		var deliveries []models.WebhookDelivery
+		eventIDs := make([]uint, len(events))
+		for i, event := range events {
+			eventIDs[i] = event.ID
+			for _, webhook := range webhooks {
+				if Matches(filterOf(webhook.Events), event.Type) {
+					deliveries = append(deliveries, models.WebhookDelivery{
+						WebhookID: webhook.ID,
+						EventID:   event.ID,
+						EventType: event.Type,
+						Status:    DeliveryPending,
+					})
+				}
+			}
+		}
+		if len(deliveries) > 0 {
+			if err := tx.Clauses(clause.OnConflict{DoNothing: true}).CreateInBatches(deliveries, 100).Error; err != nil {
+				return err
+			}
+		}
+		return tx.Model(&models.OutboxEvent{}).Where("id IN ?", eventIDs).Update("dispatched_at", now).Error
+	})
+	return count, err
+}
+
+// claim leases the next due delivery
+func (d *Dispatcher) claim(now time.Time) (*models.WebhookDelivery, error) {
+	var delivery models.WebhookDelivery
+	err := database.DB.Transaction(func(tx *gorm.DB) error {
+		result := tx.Clauses(clause.Locking{Strength: "UPDATE", Options: "SKIP LOCKED"}).
+			Where("status = ?", DeliveryPending).
+			Where("next_attempt_at IS NULL OR next_attempt_at <= ?", now).
+			Where("lease_expires_at IS NULL OR lease_expires_at < ?", now).
+			Order("id").
+			Limit(1).
+			Find(&delivery)
+		if result.Error != nil || result.RowsAffected == 0 {
+			return result.Error
+		}
+		return tx.Exec("UPDATE webhook_deliveries SET lease_owner = ?, lease_expires_at = ? WHERE id = ?",
+			d.Owner, now.Add(deliveryLease), delivery.ID).Error
+	})
+	if err != nil || delivery.ID == 0 {
+		return nil, err
+	}
+	return &delivery, nil
+}
+
+// deliver makes one attempt at a leased delivery and records the outcome.
+// Network errors, timeouts, 408, 429 and 5xx responses are retried under
+// Policy; other responses fail the delivery until it is redelivered.
+func (d *Dispatcher) deliver(delivery *models.WebhookDelivery) {
+	status, err := d.send(delivery)
+
+	now := time.Now()
+	delivery.Attempts++
+	updates := map[string]interface{}{
+		"attempts":        delivery.Attempts,
+		"response_status": status,
+		"last_error":      "",
+		"next_attempt_at": nil,
+	}
+	switch {
+	case err == nil:
+		updates["status"] = DeliveryDelivered
+		updates["delivered_at"] = now
+	case Policy.Retryable(retry.Classify(err)) && delivery.Attempts < Policy.MaxAttempts:
+		updates["last_error"] = err.Error()
+		updates["next_attempt_at"] = now.Add(Policy.Backoff(delivery.Attempts))
+	default:
+		updates["status"] = DeliveryFailed
+		updates["last_error"] = err.Error()
+		log.Printf("[Webhooks] Delivery %d of event %d to webhook %d FAILED after %d attempts: %v",
+			delivery.ID, delivery.EventID, delivery.WebhookID, delivery.Attempts, err)
+	}
+
+	err = database.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Model(&models.WebhookDelivery{}).Where("id = ? AND lease_owner = ?", delivery.ID, d.Owner).Updates(updates).Error; err != nil {
+			return err
+		}
+		return tx.Exec("UPDATE webhook_deliveries SET lease_owner = NULL, lease_expires_at = NULL WHERE id = ? AND lease_owner = ?",
+			delivery.ID, d.Owner).Error
+	})
+	if err != nil {
+		log.Printf("[Webhooks] Failed to record delivery %d: %v", delivery.ID, err)
+	}
+}
+
+// send posts the event of a delivery and returns the HTTP status
+func (d *Dispatcher) send(delivery *models.WebhookDelivery) (int, error) {
+	var webhook models.Webhook
+	if err := database.DB.Unscoped().First(&webhook, delivery.WebhookID).Error; err != nil {
+		return 0, err
+	}
+	if webhook.DeletedAt.Valid || !webhook.Enabled {
+		return 0, retry.Wrap(retry.ClassPermanent, errors.New("webhook was deleted or disabled"))
+	}
+	secret, err := secrets.Decrypt(webhook.EncryptedSecret)
+	if err != nil {
+		return 0, retry.Wrap(retry.ClassPermanent, fmt.Errorf("failed to decrypt webhook secret: %w", err))
+	}
+
+	var event models.OutboxEvent
+	if err := database.DB.First(&event, delivery.EventID).Error; err != nil {
+		return 0, err
+	}
+	// The event id stays the same across redeliveries so receivers can
+	// deduplicate on it
+	body, _ := json.Marshal(map[string]interface{}{
+		"id":         event.ID,
+		"type":       event.Type,
+		"created_at": event.CreatedAt,
+		"data":       event.Payload,
+	})
+
+	ctx, cancel := context.WithTimeout(d.ctx, requestTimeout)
+	defer cancel()
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, webhook.URL, bytes.NewReader(body))
+	if err != nil {
+		return 0, retry.Wrap(retry.ClassPermanent, err)
+	}
+	timestamp := time.Now().Unix()
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("User-Agent", "finetune-studio-webhooks")
+	req.Header.Set(HeaderEvent, event.Type)
+	req.Header.Set(HeaderDelivery, strconv.FormatUint(uint64(delivery.ID), 10))
+	req.Header.Set(HeaderTimestamp, strconv.FormatInt(timestamp, 10))
+	req.Header.Set(HeaderSignature, Sign(secret, timestamp, body))
+
+	resp, err := d.Client.Do(req)
+	if err != nil {
+		return 0, err
+	}
+	defer resp.Body.Close()
+	snippet, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+
+	if resp.StatusCode >= 200 && resp.StatusCode < 300 {
+		return resp.StatusCode, nil
+	}
+	return resp.StatusCode, retry.Wrap(retry.ClassifyStatus(resp.StatusCode), fmt.Errorf("HTTP %d: %s", resp.StatusCode, snippet))
+}
+
+// Redeliver queues a delivery again with a fresh set of attempts
+func Redeliver(deliveryID uint) error {
+	return database.DB.Model(&models.WebhookDelivery{}).Where("id = ?", deliveryID).Updates(map[string]interface{}{
+		"status":          DeliveryPending,
+		"attempts":        0,
+		"next_attempt_at": nil,
+		"last_error":      "",
+	}).Error
+}
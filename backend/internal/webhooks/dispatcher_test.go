@@ -0,0 +1,118 @@
+package webhooks
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"finetune-studio/internal/database"
+	"finetune-studio/internal/database/databasetest"
+	"finetune-studio/internal/models"
+	"finetune-studio/internal/outbox"
+	"finetune-studio/internal/secrets"
+
+	"gorm.io/datatypes"
+)
+
+func TestDispatcherRetriesServerErrors(t *testing.T) {
+	databasetest.Open(t)
+	if err := secrets.Init("000102030405060708090a0b0c0d0e0f101112131415161718191a1b1c1d1e1f"); err != nil {
+		t.Fatal(err)
+	}
+	defer secrets.Init("")
+
+	var calls atomic.Int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		timestamp, _ := strconv.ParseInt(r.Header.Get(HeaderTimestamp), 10, 64)
+		if !Verify("whsec_test", timestamp, body, r.Header.Get(HeaderSignature)) {
+			t.Errorf("delivery signature does not verify")
+		}
+		if calls.Add(1) == 1 {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer server.Close()
+
+	encrypted, err := secrets.Encrypt("whsec_test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	webhook := models.Webhook{URL: server.URL, EncryptedSecret: encrypted, Events: datatypes.JSON(`["job.*"]`), Enabled: true}
+	if err := database.DB.Create(&webhook).Error; err != nil {
+		t.Fatal(err)
+	}
+	if err := outbox.Add(database.DB, "job.completed", map[string]interface{}{"job_id": 1}); err != nil {
+		t.Fatal(err)
+	}
+	if err := outbox.Add(database.DB, outbox.ModelReady, map[string]interface{}{"model_id": 1}); err != nil {
+		t.Fatal(err)
+	}
+
+	d := NewDispatcher(time.Minute)
+	if err := d.Run(); err != nil {
+		t.Fatal(err)
+	}
+
+	var deliveries []models.WebhookDelivery
+	database.DB.Find(&deliveries)
+	if len(deliveries) != 1 {
+		t.Fatalf("got %d deliveries, want 1 matching the job.* filter", len(deliveries))
+	}
+	delivery := deliveries[0]
+	if delivery.Status != DeliveryPending || delivery.Attempts != 1 || delivery.ResponseStatus != http.StatusServiceUnavailable || delivery.NextAttemptAt == nil {
+		t.Fatalf("503 not rescheduled: %+v", delivery)
+	}
+	if wait := time.Until(*delivery.NextAttemptAt); wait < 25*time.Second || wait > 35*time.Second {
+		t.Fatalf("next attempt in %s, want the initial backoff of 30s", wait)
+	}
+
+	// Not due yet
+	if err := d.Run(); err != nil {
+		t.Fatal(err)
+	}
+	if calls.Load() != 1 {
+		t.Fatalf("delivery sent %d times before its next attempt", calls.Load())
+	}
+
+	database.DB.Model(&delivery).Update("next_attempt_at", time.Now().Add(-time.Second))
+	if err := d.Run(); err != nil {
+		t.Fatal(err)
+	}
+	database.DB.First(&delivery, delivery.ID)
+	if delivery.Status != DeliveryDelivered || delivery.Attempts != 2 || delivery.DeliveredAt == nil {
+		t.Fatalf("retry not delivered: %+v", delivery)
+	}
+}
+
+func TestDispatcherFailsOnClientErrors(t *testing.T) {
+	databasetest.Open(t)
+	if err := secrets.Init("000102030405060708090a0b0c0d0e0f101112131415161718191a1b1c1d1e1f"); err != nil {
+		t.Fatal(err)
+	}
+	defer secrets.Init("")
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusGone)
+	}))
+	defer server.Close()
+
+	encrypted, _ := secrets.Encrypt("whsec_test")
+	database.DB.Create(&models.Webhook{URL: server.URL, EncryptedSecret: encrypted, Events: datatypes.JSON(`[]`), Enabled: true})
+	outbox.Add(database.DB, "job.failed", map[string]interface{}{"job_id": 1})
+
+	if err := NewDispatcher(time.Minute).Run(); err != nil {
+		t.Fatal(err)
+	}
+	var delivery models.WebhookDelivery
+	database.DB.First(&delivery)
+	if delivery.Status != DeliveryFailed || delivery.Attempts != 1 || delivery.NextAttemptAt != nil {
+		t.Fatalf("410 not failed permanently: %+v", delivery)
+	}
+}
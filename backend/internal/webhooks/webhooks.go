@@ -0,0 +1,120 @@
+// Package webhooks delivers outbox events to registered endpoints. Each
+// delivery is a JSON POST signed with the webhook secret:
+//
+//	X-Webhook-Signature: sha256=hex(HMAC-SHA256(secret, timestamp + "." + body))
+//
+// where timestamp is the X-Webhook-Timestamp header (Unix seconds). Receivers
+// should recompute the signature and reject stale timestamps.
+package webhooks
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net/url"
+	"strconv"
+	"strings"
+
+	"finetune-studio/internal/jobs/statemachine"
+	"finetune-studio/internal/outbox"
+)
+
+// Headers set on every delivery
+const (
+	HeaderEvent     = "X-Webhook-Event"
+	HeaderDelivery  = "X-Webhook-Delivery"
+	HeaderTimestamp = "X-Webhook-Timestamp"
+	HeaderSignature = "X-Webhook-Signature"
+)
+
+// EventTypes lists every event a webhook can subscribe to
+func EventTypes() []string {
+	types := []string{outbox.JobCreated}
+	for _, state := range []statemachine.State{
+		statemachine.Pending, statemachine.Starting, statemachine.Running, statemachine.Retrying,
+		statemachine.Cancelling, statemachine.Completed, statemachine.Failed, statemachine.Cancelled, statemachine.TimedOut,
+	} {
+		types = append(types, "job."+string(state))
+	}
+	return append(types,
+		outbox.EvaluationCreated, outbox.EvaluationCompleted, outbox.EvaluationFailed,
+		outbox.ModelReady, outbox.ModelFailed, outbox.ModelPromoted,
+	)
+}
+
+// ValidateFilter checks every entry of an event filter is a known event
+// type, "*" or a "group.*" pattern matching at least one event
+func ValidateFilter(filter []string) error {
+	for _, pattern := range filter {
+		known := false
+		for _, eventType := range EventTypes() {
+			if Matches([]string{pattern}, eventType) {
+				known = true
+				break
+			}
+		}
+		if !known {
+			return fmt.Errorf("unknown event %q", pattern)
+		}
+	}
+	return nil
+}
+
+// Matches reports whether an event type passes a filter. An empty filter
+// matches everything.
+func Matches(filter []string, eventType string) bool {
+	if len(filter) == 0 {
+		return true
+	}
+	for _, pattern := range filter {
+		switch {
+		case pattern == "*" || pattern == eventType:
+			return true
+		case strings.HasSuffix(pattern, ".*") && strings.HasPrefix(eventType, strings.TrimSuffix(pattern, "*")):
+			return true
+		}
+	}
+	return false
+}
+
+// ValidateURL accepts absolute http and https URLs
+func ValidateURL(raw string) error {
+	u, err := url.Parse(raw)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return fmt.Errorf("url must be an absolute http or https URL")
+	}
+	return nil
+}
+
+// NewSecret generates a random signing secret
+func NewSecret() (string, error) {
+	raw := make([]byte, 32)
+	if _, err := rand.Read(raw); err != nil {
+		return "", err
+	}
+	return "whsec_" + hex.EncodeToString(raw), nil
+}
+
+// Sign returns the signature header value of a body sent at timestamp
+func Sign(secret string, timestamp int64, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(strconv.FormatInt(timestamp, 10)))
+	mac.Write([]byte("."))
+	mac.Write(body)
+	return "sha256=" + hex.EncodeToString(mac.Sum(nil))
+}
+
+// Verify checks a signature header value in constant time
+func Verify(secret string, timestamp int64, body []byte, signature string) bool {
+	return hmac.Equal([]byte(Sign(secret, timestamp, body)), []byte(signature))
+}
+
+// filterOf decodes the stored event filter of a webhook
+func filterOf(events []byte) []string {
+	var filter []string
+	json.Unmarshal(events, &filter)
+	return filter
+}
@@ -0,0 +1,51 @@
+package webhooks
+
+import "testing"
+
+func TestMatches(t *testing.T) {
+	tests := []struct {
+		filter    []string
+		eventType string
+		want      bool
+	}{
+		{nil, "job.completed", true},
+		{[]string{"*"}, "model.ready", true},
+		{[]string{"job.completed"}, "job.completed", true},
+		{[]string{"job.completed"}, "job.failed", false},
+		{[]string{"job.*"}, "job.timed_out", true},
+		{[]string{"job.*"}, "model.ready", false},
+		{[]string{"evaluation.*", "model.promoted"}, "model.promoted", true},
+	}
+	for _, tt := range tests {
+		if got := Matches(tt.filter, tt.eventType); got != tt.want {
+			t.Errorf("Matches(%v, %q) = %v, want %v", tt.filter, tt.eventType, got, tt.want)
+		}
+	}
+}
+
+func TestValidateFilter(t *testing.T) {
+	if err := ValidateFilter([]string{"job.completed", "model.*", "*"}); err != nil {
+		t.Fatal(err)
+	}
+	for _, pattern := range []string{"job.done", "jobs.*", "job", ""} {
+		if err := ValidateFilter([]string{pattern}); err == nil {
+			t.Errorf("ValidateFilter accepted %q", pattern)
+		}
+	}
+}
+
+func TestSignAndVerify(t *testing.T) {
+	body := []byte(`{"id":1,"type":"job.completed"}`)
+
+	// echo -n '1700000000.{"id":1,"type":"job.completed"}' | openssl dgst -sha256 -hmac secret
+	signature := Sign("secret", 1700000000, body)
+	if want := "sha256=cb583673abe596829dc1b81caf5cef1d30a9536a6ad5fedb899cf182c4d0acbd"; signature != want {
+		t.Fatalf("signature %q, want %q", signature, want)
+	}
+	if !Verify("secret", 1700000000, body, signature) {
+		t.Fatal("signature does not verify")
+	}
+	if Verify("other", 1700000000, body, signature) || Verify("secret", 1700000001, body, signature) {
+		t.Fatal("signature verifies with another secret or timestamp")
+	}
+}
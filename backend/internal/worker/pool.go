@@ -1,251 +1,705 @@
 package worker
 
 import (
-	"bytes"
 	"context"
 	"encoding/json"
+	"errors"
+	"finetune-studio/internal/backends"
 	"finetune-studio/internal/database"
+	"finetune-studio/internal/events"
+	"finetune-studio/internal/jobs"
+	"finetune-studio/internal/jobs/retry"
+	"finetune-studio/internal/jobs/series"
+	"finetune-studio/internal/jobs/statemachine"
+	"finetune-studio/internal/jobs/trainingconfig"
+	"finetune-studio/internal/logmetrics"
 	"finetune-studio/internal/models"
-	"finetune-studio/internal/services/kaggle"
+	"finetune-studio/internal/outbox"
+	"finetune-studio/internal/queue"
 	"finetune-studio/internal/storage"
 	"fmt"
 	"io"
 	"log"
-	"os"
+	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/minio/minio-go/v7"
 	"gorm.io/datatypes"
+	"gorm.io/gorm"
 )
 
 type WorkerPool struct {
-	Workers       int
-	JobQueue      chan uint
-	Quit          chan bool
-	KaggleService *kaggle.Service
+	Workers      int
+	Queue        *queue.Queue
+	PollInterval time.Duration
+	JobTimeout   time.Duration // Default deadline for a job, counted from its first start
+
+	wake   chan struct{}
+	ctx    context.Context
+	cancel context.CancelFunc
+	wg     sync.WaitGroup
+	active atomic.Int32
+
+	mu      sync.Mutex
+	running map[uint]context.CancelCauseFunc // Jobs processed by this replica
 }
 
+// errCancelRequested is the cause of a job context cancelled by the user
+var errCancelRequested = errors.New("job cancellation requested")
+
+// holdInterval is how long a job refused by its backend waits before it is
+// considered again
+const holdInterval = time.Minute
+
+// cancelCheckInterval is how often a worker looks for cancellations made on
+// another replica
+const cancelCheckInterval = 5 * time.Second
+
 // Global instance
 var Pool *WorkerPool
 
-func NewWorkerPool(workers int, kaggleSvc *kaggle.Service) *WorkerPool {
+func NewWorkerPool(workers int, q *queue.Queue, pollInterval, jobTimeout time.Duration) *WorkerPool {
+	ctx, cancel := context.WithCancel(context.Background())
 	return &WorkerPool{
-		Workers:       workers,
-		JobQueue:      make(chan uint, 100),
-		Quit:          make(chan bool),
-		KaggleService: kaggleSvc,
+		Workers:      workers,
+		Queue:        q,
+		PollInterval: pollInterval,
+		JobTimeout:   jobTimeout,
+		wake:         make(chan struct{}, workers),
+		ctx:          ctx,
+		cancel:       cancel,
+		running:      make(map[uint]context.CancelCauseFunc),
 	}
 }
 
 func (w *WorkerPool) Start() {
 	for i := 0; i < w.Workers; i++ {
+		w.wg.Add(1)
 		go w.worker(i)
 	}
-	log.Printf("🚀 Worker Pool started with %d workers", w.Workers)
+	log.Printf("🚀 Worker Pool started with %d workers (queue owner %s)", w.Workers, w.Queue.Owner)
 }
 
-func (w *WorkerPool) worker(id int) {
-	for jobID := range w.JobQueue {
-		w.processJob(id, jobID)
+// Stop stops claiming jobs and waits up to timeout for the workers to hand
+// their jobs back to the queue. Unfinished jobs are resumed by whichever
+// replica claims them next.
+func (w *WorkerPool) Stop(timeout time.Duration) {
+	w.cancel()
+
+	done := make(chan struct{})
+	go func() {
+		w.wg.Wait()
+		close(done)
+	}()
+
+	select {
+	case <-done:
+	case <-time.After(timeout):
+		log.Printf("⚠️ Worker pool did not stop within %s", timeout)
 	}
 }
 
-func (w *WorkerPool) processJob(workerID int, jobID uint) {
-	log.Printf("[Worker %d] Processing Job %d", workerID, jobID)
+// Notify wakes an idle worker after a job has been added to the queue
+func (w *WorkerPool) Notify() {
+	select {
+	case w.wake <- struct{}{}:
+	default:
+	}
+}
 
-	var job models.Job
-	if err := database.DB.Preload("Dataset").First(&job, jobID).Error; err != nil {
-		log.Printf("[Worker %d] Job %d not found: %v", workerID, jobID, err)
-		return
+// CancelJob interrupts a job processed by this replica. It returns false when
+// the job runs elsewhere; that worker notices the cancelling status within
+// cancelCheckInterval.
+func (w *WorkerPool) CancelJob(jobID uint) bool {
+	w.mu.Lock()
+	cancel, ok := w.running[jobID]
+	w.mu.Unlock()
+
+	if ok {
+		cancel(errCancelRequested)
 	}
+	return ok
+}
 
-	// 1. Mark as Starting
-	updateJobStatus(&job, "starting")
+// RequestCancel cancels a job on behalf of actor. Jobs without a backend run
+// are cancelled right away; anything else goes through cancelling until a
+// worker has stopped the run. Transition errors are returned as they come
+// from the state machine.
+func (w *WorkerPool) RequestCancel(job *models.Job, actor, reason string) error {
+	target := statemachine.Cancelling
+	if job.Status == string(statemachine.Pending) || (job.Status == string(statemachine.Retrying) && job.RunRef == "") {
+		target = statemachine.Cancelled
+	}
 
-	// Check if Kaggle is configured
-	if os.Getenv("KAGGLE_USERNAME") == "" || os.Getenv("KAGGLE_KEY") == "" {
-		log.Printf("[Worker %d] Kaggle not configured, running in SIMULATION mode", workerID)
-		w.processJobSimulated(workerID, &job)
-		return
+	if err := statemachine.Transition(job, target, actor, reason); err != nil {
+		return err
 	}
 
-	// === KAGGLE MODE ===
-	log.Printf("[Worker %d] Running Job %d via Kaggle", workerID, jobID)
-	w.processJobKaggle(workerID, &job)
+	if target == statemachine.Cancelling {
+		w.CancelJob(job.ID)
+		return nil
+	}
+	updateJobMetrics(job, map[string]interface{}{"cancelled_at": time.Now().Format(time.RFC3339)})
+	release(job)
+	return nil
 }
 
-func (w *WorkerPool) processJobKaggle(workerID int, job *models.Job) {
-	kernelRef := job.KaggleKernelID
+// Active returns the number of jobs this replica is processing
+func (w *WorkerPool) Active() int {
+	return int(w.active.Load())
+}
 
-	if kernelRef == "" {
-		// 1. Download dataset from MinIO to temp file
-		tmpDir := fmt.Sprintf("/tmp/job_%d", job.ID)
-		os.MkdirAll(tmpDir, 0755)
-		defer os.RemoveAll(tmpDir)
+func (w *WorkerPool) worker(id int) {
+	defer w.wg.Done()
 
-		datasetFile := fmt.Sprintf("%s/dataset.json", tmpDir)
-		obj, err := storage.Client.GetObject(context.Background(), "datasets", job.Dataset.FilePath, minio.GetObjectOptions{})
-		if err != nil {
-			updateJobFailed(job, fmt.Sprintf("Failed to download dataset from MinIO: %v", err))
+	for {
+		if w.ctx.Err() != nil {
 			return
 		}
 
-		buf := new(bytes.Buffer)
-		buf.ReadFrom(obj)
-		obj.Close()
-		if err := os.WriteFile(datasetFile, buf.Bytes(), 0644); err != nil {
-			updateJobFailed(job, fmt.Sprintf("Failed to write dataset: %v", err))
+		job, err := w.Queue.Claim()
+		if err != nil {
+			log.Printf("[Worker %d] Failed to claim job: %v", id, err)
+		}
+		if job == nil {
+			select {
+			case <-w.ctx.Done():
+				return
+			case <-w.wake:
+			case <-time.After(w.PollInterval):
+			}
+			continue
+		}
+
+		w.processClaimed(id, job)
+	}
+}
+
+// processClaimed runs a leased job while a supervisor keeps the lease alive
+// and watches for cancellation. Losing the lease cancels the job context so
+// two workers never drive the same job.
+func (w *WorkerPool) processClaimed(workerID int, job *models.Job) {
+	ctx, cancel := context.WithCancelCause(w.ctx)
+	defer cancel(nil)
+
+	w.active.Add(1)
+	defer w.active.Add(-1)
+
+	w.mu.Lock()
+	w.running[job.ID] = cancel
+	w.mu.Unlock()
+	defer func() {
+		w.mu.Lock()
+		delete(w.running, job.ID)
+		w.mu.Unlock()
+	}()
+
+	go func() {
+		heartbeat := time.NewTicker(w.Queue.LeaseDuration / 3)
+		defer heartbeat.Stop()
+		cancelCheck := time.NewTicker(cancelCheckInterval)
+		defer cancelCheck.Stop()
+
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-heartbeat.C:
+				if err := w.Queue.Heartbeat(job.ID); err != nil {
+					log.Printf("[Worker %d] Heartbeat for job %d failed: %v", workerID, job.ID, err)
+					if errors.Is(err, queue.ErrLeaseLost) {
+						cancel(err)
+						return
+					}
+				}
+			case <-cancelCheck.C:
+				var status string
+				database.DB.Model(&models.Job{}).Select("status").Where("id = ?", job.ID).Scan(&status)
+				if status == string(statemachine.Cancelling) {
+					cancel(errCancelRequested)
+					return
+				}
+			}
+		}
+	}()
+
+	w.processJob(ctx, workerID, job)
+
+	if err := w.Queue.Release(job.ID); err != nil {
+		log.Printf("[Worker %d] Failed to release job %d: %v", workerID, job.ID, err)
+	}
+}
+
+func (w *WorkerPool) processJob(ctx context.Context, workerID int, job *models.Job) {
+	log.Printf("[Worker %d] Processing Job %d", workerID, job.ID)
+
+	// Jobs created before pluggable backends only know their Kaggle kernel
+	if job.Backend == "" && job.KaggleKernelID != "" {
+		job.Backend = "kaggle"
+		job.RunRef = job.KaggleKernelID
+	}
+	if job.Backend == "" {
+		name, err := backends.Resolve(job.Configuration)
+		if err != nil {
+			updateJobFailed(job, err.Error())
 			return
 		}
-		log.Printf("[Worker %d] Dataset downloaded to %s (%d bytes)", workerID, datasetFile, buf.Len())
+		job.Backend = name
+	}
 
-		// 2. Upload dataset to Kaggle
-		updateJobMetrics(job, map[string]interface{}{"stage": "uploading_dataset"})
-		datasetName := fmt.Sprintf("job-%d-dataset", job.ID)
-		datasetRef, err := w.KaggleService.CreateDataset(datasetName, datasetFile)
+	backend, err := backends.Get(job.Backend)
+	if err != nil {
+		updateJobFailed(job, err.Error())
+		return
+	}
+
+	policy, err := retry.PolicyFromConfig(job.Configuration)
+	if err != nil {
+		log.Printf("[Worker %d] Job %d: %v, using default retry policy", workerID, job.ID, err)
+	}
+
+	// Backends with limited capacity may hold new runs back. Held jobs stay
+	// queued and their deadline doesn't start.
+	if admitter, ok := backend.(backends.Admitter); ok && job.RunRef == "" && isStartStatus(job.Status) {
+		admitted, reason, err := admitter.Admit(ctx, job)
 		if err != nil {
-			updateJobFailed(job, fmt.Sprintf("Failed to upload dataset to Kaggle: %v", err))
+			reason = fmt.Sprintf("could not check %s capacity: %v", backend.Name(), err)
+		}
+		if !admitted {
+			holdJob(job, reason, holdInterval)
 			return
 		}
-		log.Printf("[Worker %d] Dataset uploaded to Kaggle: %s", workerID, datasetRef)
+	}
 
-		// 3. Read notebook template and push kernel
-		updateJobStatus(job, "running")
-		updateJobMetrics(job, map[string]interface{}{"stage": "pushing_kernel", "kaggle_dataset": datasetRef})
+	// 1. Mark as Starting. Jobs already starting or running are resumed from
+	// a previous owner and don't count as a new attempt.
+	if job.StartedAt == nil {
+		now := time.Now()
+		job.StartedAt = &now
+	}
 
-		notebookBytes, err := os.ReadFile("/app/templates/finetune-kernel.ipynb")
+	// The deadline is fixed on first start so that retries and resumes
+	// after a restart don't extend it
+	if job.DeadlineAt == nil {
+		timeout, err := jobs.Timeout(job.Configuration, w.JobTimeout)
 		if err != nil {
-			updateJobFailed(job, fmt.Sprintf("Failed to read notebook template: %v", err))
+			log.Printf("[Worker %d] Job %d: %v, using default timeout %s", workerID, job.ID, err, w.JobTimeout)
+		}
+		deadline := job.StartedAt.Add(timeout)
+		job.DeadlineAt = &deadline
+	}
+	ctx, cancel := context.WithDeadline(ctx, *job.DeadlineAt)
+	defer cancel()
+
+	if job.Status == string(statemachine.Pending) || job.Status == string(statemachine.Retrying) {
+		job.Attempts++
+		database.DB.Save(job)
+		reason := fmt.Sprintf("attempt %d/%d claimed by %s", job.Attempts, policy.MaxAttempts, w.Queue.Owner)
+		if !updateJobStatus(job, statemachine.Starting, reason) {
 			return
 		}
+	} else {
+		database.DB.Save(job)
+	}
+
+	// Cancelled while no worker held it: only the run needs stopping
+	if job.Status == string(statemachine.Cancelling) {
+		w.stopCancelled(workerID, backend, job)
+		return
+	}
+
+	log.Printf("[Worker %d] Running Job %d via %s backend (attempt %d)", workerID, job.ID, backend.Name(), job.Attempts)
+	w.runJob(ctx, workerID, backend, policy, job)
+}
 
-		kernelSlug := fmt.Sprintf("finetune-job-%d", job.ID)
-		kernelRef, err = w.KaggleService.PushKernel(kernelSlug, notebookBytes, []string{datasetRef})
+func (w *WorkerPool) runJob(ctx context.Context, workerID int, backend backends.Backend, policy retry.Policy, job *models.Job) {
+	if job.RunRef == "" {
+		ref, err := backend.Submit(ctx, job)
 		if err != nil {
-			updateJobFailed(job, fmt.Sprintf("Failed to push kernel: %v", err))
+			if ctx.Err() != nil {
+				w.interrupted(ctx, workerID, backend, job)
+				return
+			}
+			var hold *backends.HoldError
+			if errors.As(err, &hold) {
+				holdJob(job, hold.Reason, hold.RetryAfter)
+				return
+			}
+			retryOrFail(job, policy, fmt.Sprintf("submission to %s", backend.Name()), err, true)
 			return
 		}
-		job.KaggleKernelID = kernelRef
+		job.RunRef = ref
+		job.RunAttempt = job.Attempts
 		database.DB.Save(job)
-		log.Printf("[Worker %d] Kernel pushed: %s", workerID, kernelRef)
+		log.Printf("[Worker %d] Job %d submitted to %s: %s", workerID, job.ID, backend.Name(), ref)
 	} else {
-		log.Printf("[Worker %d] Resuming job %d with existing kernel %s", workerID, job.ID, kernelRef)
+		log.Printf("[Worker %d] Resuming job %d with existing %s run %s", workerID, job.ID, backend.Name(), job.RunRef)
 	}
 
-	// 4. Poll kernel status
-	updateJobMetrics(job, map[string]interface{}{"stage": "training", "kernel_ref": kernelRef})
+	if !updateJobStatus(job, statemachine.Running, fmt.Sprintf("submitted to %s as %s", backend.Name(), job.RunRef)) {
+		return
+	}
+
+	// 2. Poll run status
+	pollErrors := 0
 	for {
-		// Check cancellation
-		database.DB.First(job, job.ID)
-		if job.Status == "cancelled" {
-			log.Printf("[Worker %d] Job %d cancelled", workerID, job.ID)
-			return
+		wait := backend.PollInterval()
+
+		status, err := backend.Status(ctx, job)
+		if err != nil && ctx.Err() == nil {
+			// Transient poll errors are retried in place with backoff; once
+			// they exhaust the policy the job is retried as a whole and
+			// resumes polling the same run.
+			pollErrors++
+			log.Printf("[Worker %d] Error polling status (%d/%d): %v", workerID, pollErrors, policy.MaxAttempts, err)
+			if !policy.Retryable(retry.Classify(err)) || pollErrors >= policy.MaxAttempts {
+				retryOrFail(job, policy, fmt.Sprintf("status polling on %s", backend.Name()), err, false)
+				if job.Status == string(statemachine.Failed) {
+					// The run may still be going: don't leave it using the backend
+					if err := backend.Cancel(ctx, job); err != nil {
+						log.Printf("[Worker %d] Failed to cancel %s run %s: %v", workerID, backend.Name(), job.RunRef, err)
+					}
+				}
+				return
+			}
+			wait = policy.Backoff(pollErrors)
+		} else if err == nil {
+			pollErrors = 0
 		}
 
-		status, err := w.KaggleService.GetKernelStatus(kernelRef)
-		if err != nil {
-			log.Printf("[Worker %d] Error polling status: %v", workerID, err)
+		// Don't log spam, just update
+		if status.Metrics != nil {
+			updateJobMetrics(job, status.Metrics)
 		}
 
-		// Don't log spam, just update
-		updateJobMetrics(job, map[string]interface{}{
-			"stage":         "training",
-			"kernel_status": status,
-			"kernel_ref":    kernelRef,
-		})
-
-		if status == "completed" {
-			updateJobStatus(job, "completed")
-			log.Printf("[Worker %d] Job %d completed on Kaggle!", workerID, job.ID)
-
-			// Create model record after successful completion
-			w.handleKernelComplete(job)
+		switch status.State {
+		case backends.RunCompleted:
+			w.syncLogs(ctx, backend, job)
+
+			// The model is listed as importing while the outputs are copied
+			model, err := importingModel(job)
+			if err != nil {
+				retryOrFail(job, policy, "model registration", err, false)
+				return
+			}
+
+			artifacts, err := backend.FetchArtifacts(ctx, job)
+			if err != nil {
+				if ctx.Err() != nil {
+					w.interrupted(ctx, workerID, backend, job)
+					return
+				}
+				retryOrFail(job, policy, fmt.Sprintf("artifact download from %s", backend.Name()), err, false)
+				if job.Status == string(statemachine.Failed) {
+					setModelStatus(model, "failed")
+				}
+				return
+			}
+			if !updateJobStatus(job, statemachine.Completed, fmt.Sprintf("%s run completed", backend.Name())) {
+				setModelStatus(model, "failed")
+				return
+			}
+			log.Printf("[Worker %d] Job %d completed on %s!", workerID, job.ID, backend.Name())
+
+			w.handleKernelComplete(job, model, artifacts)
 			return
-		} else if status == "failed" {
-			updateJobFailed(job, "Kaggle kernel execution failed")
+		case backends.RunFailed:
+			w.syncLogs(ctx, backend, job)
+			reason := status.Message
+			if reason == "" {
+				reason = fmt.Sprintf("%s run failed", backend.Name())
+			}
+			retryOrFail(job, policy, fmt.Sprintf("training on %s", backend.Name()), retry.Wrap(retry.ClassRunFailed, errors.New(reason)), true)
+			return
+		case backends.RunCancelled:
+			w.syncLogs(ctx, backend, job)
+			updateJobStatus(job, statemachine.Cancelled, fmt.Sprintf("%s run cancelled outside of the API", backend.Name()))
 			return
 		}
 
-		time.Sleep(30 * time.Second) // Poll every 30s
+		select {
+		case <-ctx.Done():
+			w.interrupted(ctx, workerID, backend, job)
+			return
+		case <-time.After(wait):
+		}
 	}
 }
 
-func (w *WorkerPool) processJobSimulated(workerID int, job *models.Job) {
-	updateJobStatus(job, "running")
+// interrupted handles a job whose context ended before the run finished. A
+// cancellation or a missed deadline stops the run; shutdown or a lost lease
+// leave the job as is for its next owner.
+func (w *WorkerPool) interrupted(ctx context.Context, workerID int, backend backends.Backend, job *models.Job) {
+	if errors.Is(context.Cause(ctx), errCancelRequested) {
+		database.DB.First(job, job.ID)
+		w.stopCancelled(workerID, backend, job)
+		return
+	}
+	if !errors.Is(ctx.Err(), context.DeadlineExceeded) {
+		log.Printf("[Worker %d] Job %d handed back to the queue", workerID, job.ID)
+		return
+	}
+
+	// The job context is done, give the cleanup its own budget
+	cleanupCtx, cancel := context.WithTimeout(context.Background(), time.Minute)
+	defer cancel()
 
-	config := make(map[string]interface{})
-	_ = json.Unmarshal([]byte(job.Configuration), &config)
-	epochs := 5
-	if e, ok := config["epochs"].(float64); ok {
-		epochs = int(e)
+	if job.RunRef != "" {
+		if err := backend.Cancel(cleanupCtx, job); err != nil {
+			log.Printf("[Worker %d] Failed to cancel %s run %s: %v", workerID, backend.Name(), job.RunRef, err)
+		}
+		w.syncLogs(cleanupCtx, backend, job)
 	}
 
-	for i := 1; i <= epochs; i++ {
-		database.DB.First(job, job.ID)
-		if job.Status == "cancelled" {
-			log.Printf("[Worker %d] Job %d cancelled", workerID, job.ID)
-			return
+	reason := fmt.Sprintf("job exceeded its deadline of %s (started %s)",
+		job.DeadlineAt.Format(time.RFC3339), job.StartedAt.Format(time.RFC3339))
+	updateJobMetrics(job, map[string]interface{}{"stage": "timed_out", "error": reason})
+	if updateJobStatus(job, statemachine.TimedOut, reason) {
+		log.Printf("[Job %d] TIMED OUT: %s", job.ID, reason)
+	}
+}
+
+// stopCancelled stops the run of a cancelling job and confirms the
+// cancellation. If the backend can't be reached the job stays cancelling and
+// is picked up again later to retry the stop.
+func (w *WorkerPool) stopCancelled(workerID int, backend backends.Backend, job *models.Job) {
+	ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+	defer cancel()
+
+	reason := "cancelled by user"
+	if job.RunRef != "" {
+		if err := backend.Cancel(ctx, job); err != nil {
+			class := retry.Classify(err)
+			if retry.DefaultPolicy().Retryable(class) {
+				next := time.Now().Add(30 * time.Second)
+				job.NextAttemptAt = &next
+				database.DB.Save(job)
+				log.Printf("[Worker %d] Failed to stop %s run %s, will retry: %v", workerID, backend.Name(), job.RunRef, err)
+				return
+			}
+			reason = fmt.Sprintf("cancelled by user, but the %s run could not be stopped: %v", backend.Name(), err)
+		} else {
+			reason = fmt.Sprintf("cancelled by user, %s run %s stopped", backend.Name(), job.RunRef)
 		}
+		w.syncLogs(ctx, backend, job)
+	}
 
-		time.Sleep(5 * time.Second)
+	updateJobMetrics(job, map[string]interface{}{"cancelled_at": time.Now().Format(time.RFC3339)})
+	if updateJobStatus(job, statemachine.Cancelled, reason) {
+		log.Printf("[Job %d] CANCELLED: %s", job.ID, reason)
+	}
+}
 
-		metrics := map[string]interface{}{
-			"mode":         "simulation",
-			"epoch":        i,
-			"total_epochs": epochs,
-			"loss":         0.5 - (float64(i) * 0.05),
-			"accuracy":     0.5 + (float64(i) * 0.08),
-			"time_elapsed": fmt.Sprintf("%ds", i*5),
+// holdJob puts a job back in the queue until retryAfter because its backend
+// has no capacity. A job that was already starting returns to pending and the
+// attempt is not counted.
+func holdJob(job *models.Job, reason string, retryAfter time.Duration) {
+	next := time.Now().Add(retryAfter)
+	job.NextAttemptAt = &next
+	updateJobMetrics(job, map[string]interface{}{
+		"stage":           "held",
+		"hold_reason":     reason,
+		"next_attempt_at": next,
+	})
+
+	if job.Status == string(statemachine.Starting) {
+		job.Attempts--
+		if job.Attempts == 0 {
+			// Never ran: the deadline starts when the job really starts
+			job.StartedAt = nil
+			job.DeadlineAt = nil
 		}
-		metricsJSON, _ := json.Marshal(metrics)
-		job.Metrics = datatypes.JSON(metricsJSON)
 		database.DB.Save(job)
+		updateJobStatus(job, statemachine.Pending, reason)
+	}
+	log.Printf("[Job %d] HELD until %s: %s", job.ID, next.Format(time.RFC3339), reason)
+}
+
+func isStartStatus(status string) bool {
+	return status == string(statemachine.Pending) || status == string(statemachine.Retrying)
+}
 
-		log.Printf("[Worker %d] Job %d - Epoch %d/%d (simulated)", workerID, job.ID, i, epochs)
+// retryOrFail schedules another attempt when err is transient under the
+// job's retry policy and attempts remain, and fails the job otherwise. With
+// resubmit the next attempt starts a new run instead of resuming the current one.
+func retryOrFail(job *models.Job, policy retry.Policy, stage string, err error, resubmit bool) {
+	class := retry.Classify(err)
+	transient := policy.Retryable(class)
+
+	failure := map[string]interface{}{
+		"stage":        stage,
+		"error":        err.Error(),
+		"error_class":  class,
+		"transient":    transient,
+		"attempt":      job.Attempts,
+		"max_attempts": policy.MaxAttempts,
 	}
 
-	updateJobStatus(job, "completed")
-	log.Printf("[Worker %d] Job %d completed (simulated)", workerID, job.ID)
+	if transient && job.Attempts < policy.MaxAttempts {
+		delay := policy.Backoff(job.Attempts)
+		next := time.Now().Add(delay)
+		job.NextAttemptAt = &next
+		if resubmit {
+			job.RunRef = ""
+		}
+		failure["next_attempt_at"] = next
+		updateJobMetrics(job, failure)
+
+		reason := fmt.Sprintf("transient %s error during %s (attempt %d/%d), retrying in %s: %v",
+			class, stage, job.Attempts, policy.MaxAttempts, delay, err)
+		if updateJobStatus(job, statemachine.Retrying, reason) {
+			log.Printf("[Job %d] RETRYING: %s", job.ID, reason)
+		}
+		return
+	}
 
-	// Create model record after successful completion
-	w.handleKernelComplete(job)
+	var reason string
+	if transient {
+		reason = fmt.Sprintf("transient %s error during %s, giving up after %d attempts: %v", class, stage, job.Attempts, err)
+	} else {
+		reason = fmt.Sprintf("permanent %s error during %s: %v", class, stage, err)
+	}
+	failure["error"] = reason
+	updateJobMetrics(job, failure)
+	if updateJobStatus(job, statemachine.Failed, reason) {
+		log.Printf("[Job %d] FAILED: %s", job.ID, reason)
+	}
 }
 
-func updateJobStatus(job *models.Job, status string) {
-	job.Status = status
-	database.DB.Save(job)
+// syncLogs stores the backend log lines that are not in the database yet.
+// Backends return every line of the current run, so lines are counted per run.
+func (w *WorkerPool) syncLogs(ctx context.Context, backend backends.Backend, job *models.Job) {
+	entries, err := backend.FetchLogs(ctx, job)
+	if err != nil {
+		log.Printf("[Job %d] Failed to fetch %s logs: %v", job.ID, backend.Name(), err)
+		return
+	}
+	for i := range entries {
+		entries[i].Attempt = job.RunAttempt
+	}
+
+	var stored int64
+	database.DB.Model(&models.LogEntry{}).
+		Where("job_id = ? AND source = ? AND attempt = ?", job.ID, backend.Name(), job.RunAttempt).
+		Count(&stored)
+	if int64(len(entries)) <= stored {
+		return
+	}
+
+	newEntries := entries[stored:]
+	if err := database.DB.CreateInBatches(newEntries, 100).Error; err != nil {
+		log.Printf("[Job %d] Failed to save %s logs: %v", job.ID, backend.Name(), err)
+		return
+	}
+	logmetrics.Process(job.ID, newEntries)
+}
+
+// updateJobStatus moves the job through the state machine on behalf of the
+// worker. It returns false when the move was rejected, typically because the
+// job was cancelled in the meantime.
+func updateJobStatus(job *models.Job, status statemachine.State, reason string) bool {
+	if err := statemachine.Transition(job, status, statemachine.ActorWorker, reason); err != nil {
+		log.Printf("[Job %d] Cannot move to %s: %v", job.ID, status, err)
+		return false
+	}
+	release(job)
+	return true
+}
+
+// release lets the backend of a job that reached a terminal state free what
+// it still holds for the job
+func release(job *models.Job) {
+	if !statemachine.IsTerminal(statemachine.State(job.Status)) {
+		return
+	}
+	backend, err := backends.Get(job.Backend)
+	if err != nil {
+		return
+	}
+	if releaser, ok := backend.(backends.Releaser); ok {
+		releaser.Release(job)
+	}
 }
 
 func updateJobMetrics(job *models.Job, metrics map[string]interface{}) {
+	// Progress read from the training logs outlives the snapshots
+	if _, ok := metrics[logmetrics.ProgressKey]; !ok {
+		var stored struct {
+			Progress datatypes.JSON
+		}
+		database.DB.Raw("SELECT metrics->? AS progress FROM jobs WHERE id = ?", logmetrics.ProgressKey, job.ID).Scan(&stored)
+		if len(stored.Progress) > 0 && string(stored.Progress) != "null" {
+			withProgress := map[string]interface{}{logmetrics.ProgressKey: json.RawMessage(stored.Progress)}
+			for key, value := range metrics {
+				withProgress[key] = value
+			}
+			metrics = withProgress
+		}
+	}
+
 	metricsJSON, _ := json.Marshal(metrics)
 	job.Metrics = datatypes.JSON(metricsJSON)
-	database.DB.Save(job)
+	if err := database.DB.Save(job).Error; err != nil {
+		return
+	}
+	events.Default.Publish(events.Event{Type: events.TypeMetrics, JobID: job.ID, Metrics: metricsJSON})
+
+	// Keep the history the snapshot replaces
+	if _, err := series.Record(series.FromSnapshot(job.ID, metrics, time.Now())); err != nil {
+		log.Printf("[Job %d] Failed to record metric points: %v", job.ID, err)
+	}
 }
 
 func updateJobFailed(job *models.Job, reason string) {
-	job.Status = "failed"
-	metricsJSON, _ := json.Marshal(map[string]interface{}{"error": reason})
-	job.Metrics = datatypes.JSON(metricsJSON)
-	database.DB.Save(job)
-	log.Printf("[Job %d] FAILED: %s", job.ID, reason)
+	updateJobMetrics(job, map[string]interface{}{"error": reason})
+	if updateJobStatus(job, statemachine.Failed, reason) {
+		log.Printf("[Job %d] FAILED: %s", job.ID, reason)
+	}
 }
 
-// handleKernelComplete creates a model record after job completion
-func (w *WorkerPool) handleKernelComplete(job *models.Job) {
-	log.Printf("[Job %d] Creating model record", job.ID)
+// importingModel returns the model record of a job, creating it with the
+// importing status on the first completed attempt
+func importingModel(job *models.Job) (*models.Model, error) {
+	var model models.Model
+	err := database.DB.Where(models.Model{JobID: &job.ID}).
+		Attrs(models.Model{
+			Name:          fmt.Sprintf("Model from Job %d", job.ID),
+			Description:   fmt.Sprintf("Fine-tuned model from dataset: %s", job.Dataset.Name),
+			Type:          "lora",
+			ParentModelID: job.ParentModelID,
+			StoragePath:   fmt.Sprintf("%d", job.ID),
+			Status:        "importing",
+		}).
+		FirstOrCreate(&model).Error
+	if err != nil {
+		return nil, err
+	}
+	if model.Status != "importing" {
+		database.DB.Model(&model).Update("status", "importing")
+	}
+	return &model, nil
+}
 
-	// Parse job configuration to get base model
-	config := make(map[string]interface{})
-	json.Unmarshal([]byte(job.Configuration), &config)
+// handleKernelComplete fills the model record from the stored artifacts and
+// marks it ready
+func (w *WorkerPool) handleKernelComplete(job *models.Job, model *models.Model, artifacts []backends.Artifact) {
+	log.Printf("[Job %d] Registering %d artifacts for model %d", job.ID, len(artifacts), model.ID)
 
-	baseModel := "llama-3.2-3b"
-	if bm, ok := config["base_model"].(string); ok && bm != "" {
-		baseModel = bm
+	// Jobs created before configurations were validated fall back to the defaults
+	trainingConfig, err := trainingconfig.Parse(job.Configuration)
+	if err != nil {
+		trainingConfig = trainingconfig.Default()
 	}
 
+	manifest := backends.NewManifest(artifacts)
+
 	// Fetch metrics from MinIO if available
 	ctx := context.Background()
 	metricsPath := fmt.Sprintf("%d/metrics.json", job.ID)
+	if manifest.Metrics != nil {
+		metricsPath = manifest.Metrics.Path
+	}
 	var trainingMetrics map[string]interface{}
 
 	obj, err := storage.Client.GetObject(ctx, "models", metricsPath, minio.GetObjectOptions{})
@@ -263,32 +717,46 @@ func (w *WorkerPool) handleKernelComplete(job *models.Job) {
 	}
 
 	metricsJSON, _ := json.Marshal(trainingMetrics)
+	manifestJSON, _ := json.Marshal(manifest)
+
+	model.BaseModel = trainingConfig.BaseModel
+	model.LoRAAdaptersPath = fmt.Sprintf("%s/lora_adapters", model.StoragePath)
+	model.GGUFPath = fmt.Sprintf("%s/gguf", model.StoragePath)
+	if len(manifest.GGUF) > 0 {
+		model.GGUFPath = manifest.GGUF[0].Path
+	}
+	model.Files = datatypes.JSON(manifestJSON)
+	model.TrainingMetrics = datatypes.JSON(metricsJSON)
+	model.TotalSize = manifest.TotalSize
+
+	// Backends that leave their outputs in place report no artifacts
+	if len(artifacts) == 0 {
+		modelStorage := storage.NewModelStorage(storage.Client)
+		if size, err := modelStorage.CalculateTotalSize(ctx, model.StoragePath); err == nil {
+			model.TotalSize = size
+		}
+	}
 
-	// Create model record
-	modelPath := fmt.Sprintf("%d", job.ID)
-	model := models.Model{
-		Name:             fmt.Sprintf("Model from Job %d", job.ID),
-		Description:      fmt.Sprintf("Fine-tuned model from dataset: %s", job.Dataset.Name),
-		BaseModel:        baseModel,
-		Type:             "lora",
-		JobID:            &job.ID,
-		StoragePath:      modelPath,
-		LoRAAdaptersPath: fmt.Sprintf("%s/lora_adapters", modelPath),
-		GGUFPath:         fmt.Sprintf("%s/gguf", modelPath),
-		TrainingMetrics:  datatypes.JSON(metricsJSON),
-		Status:           "ready",
-	}
-
-	// Calculate total size
-	modelStorage := storage.NewModelStorage(storage.Client)
-	if size, err := modelStorage.CalculateTotalSize(ctx, modelPath); err == nil {
-		model.TotalSize = size
-	}
-
-	if err := database.DB.Create(&model).Error; err != nil {
-		log.Printf("[Job %d] Failed to create model record: %v", job.ID, err)
+	// The files are recorded before the model becomes downloadable
+	if err := database.DB.Save(model).Error; err != nil {
+		log.Printf("[Job %d] Failed to save model files: %v", job.ID, err)
+		return
+	}
+	if err := setModelStatus(model, "ready"); err != nil {
+		log.Printf("[Job %d] Failed to mark model %d ready: %v", job.ID, model.ID, err)
 		return
 	}
 
-	log.Printf("[Job %d] Model record created: ID=%d", job.ID, model.ID)
+	log.Printf("[Job %d] Model %d ready (%d files, %d bytes)", job.ID, model.ID, len(artifacts), model.TotalSize)
+}
+
+// setModelStatus updates the status of a model and records the model.ready or
+// model.failed webhook event in the same transaction
+func setModelStatus(model *models.Model, status string) error {
+	return database.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Model(model).Update("status", status).Error; err != nil {
+			return err
+		}
+		return outbox.Add(tx, "model."+status, outbox.Model(model))
+	})
 }
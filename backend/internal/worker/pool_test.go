@@ -0,0 +1,159 @@
+package worker
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"finetune-studio/internal/backends"
+	"finetune-studio/internal/database"
+	"finetune-studio/internal/database/databasetest"
+	"finetune-studio/internal/jobs/retry"
+	"finetune-studio/internal/jobs/statemachine"
+	"finetune-studio/internal/models"
+	"finetune-studio/internal/queue"
+
+	"gorm.io/datatypes"
+)
+
+// fakeBackend runs forever, or fails every status poll with statusErr, and
+// prints logs of its current run
+type fakeBackend struct {
+	statusErr error
+	logs      []string
+	cancelled []uint
+	released  []uint
+}
+
+func (b *fakeBackend) Name() string { return "fake" }
+
+func (b *fakeBackend) Submit(ctx context.Context, job *models.Job) (string, error) {
+	return "run-1", nil
+}
+
+func (b *fakeBackend) Status(ctx context.Context, job *models.Job) (backends.RunStatus, error) {
+	if b.statusErr != nil {
+		return backends.RunStatus{}, b.statusErr
+	}
+	return backends.RunStatus{State: backends.RunRunning}, nil
+}
+
+func (b *fakeBackend) Cancel(ctx context.Context, job *models.Job) error {
+	b.cancelled = append(b.cancelled, job.ID)
+	return nil
+}
+
+func (b *fakeBackend) FetchArtifacts(ctx context.Context, job *models.Job) ([]backends.Artifact, error) {
+	return nil, nil
+}
+
+func (b *fakeBackend) FetchLogs(ctx context.Context, job *models.Job) ([]models.LogEntry, error) {
+	var entries []models.LogEntry
+	for _, line := range b.logs {
+		entries = append(entries, models.LogEntry{JobID: job.ID, Level: "info", Message: line, Source: b.Name(), Timestamp: time.Now()})
+	}
+	return entries, nil
+}
+
+func (b *fakeBackend) PollInterval() time.Duration { return time.Millisecond }
+
+func (b *fakeBackend) Release(job *models.Job) {
+	b.released = append(b.released, job.ID)
+}
+
+func TestPermanentPollErrorReleasesRun(t *testing.T) {
+	databasetest.Open(t)
+	// Like a Kaggle account whose key was revoked
+	backend := &fakeBackend{statusErr: retry.Wrap(retry.ClassPermanent, errors.New("403 forbidden"))}
+	backends.Register(backend)
+
+	job := models.Job{Status: string(statemachine.Starting), Backend: backend.Name(), RunRef: "run-1", Attempts: 1}
+	if err := database.DB.Create(&job).Error; err != nil {
+		t.Fatal(err)
+	}
+
+	w := &WorkerPool{}
+	w.runJob(context.Background(), 1, backend, retry.DefaultPolicy(), &job)
+
+	database.DB.First(&job, job.ID)
+	if job.Status != string(statemachine.Failed) {
+		t.Fatalf("job is %s, want failed", job.Status)
+	}
+	if len(backend.cancelled) != 1 || len(backend.released) != 1 {
+		t.Fatalf("run cancelled %d times and released %d times, want once each", len(backend.cancelled), len(backend.released))
+	}
+}
+
+func TestDirectCancelReleasesRun(t *testing.T) {
+	databasetest.Open(t)
+	backend := &fakeBackend{}
+	backends.Register(backend)
+
+	job := models.Job{Status: string(statemachine.Pending), Backend: backend.Name()}
+	if err := database.DB.Create(&job).Error; err != nil {
+		t.Fatal(err)
+	}
+	if err := (&WorkerPool{}).RequestCancel(&job, statemachine.ActorAPI, "test"); err != nil {
+		t.Fatal(err)
+	}
+	if job.Status != string(statemachine.Cancelled) || len(backend.released) != 1 {
+		t.Fatalf("job %s released %d times", job.Status, len(backend.released))
+	}
+}
+
+func TestSyncLogsCountsLinesPerRun(t *testing.T) {
+	databasetest.Open(t)
+	backend := &fakeBackend{}
+	job := models.Job{Status: string(statemachine.Running), Backend: backend.Name(), RunRef: "run-1", Attempts: 1, RunAttempt: 1}
+	if err := database.DB.Create(&job).Error; err != nil {
+		t.Fatal(err)
+	}
+	w := &WorkerPool{}
+
+	backend.logs = []string{"a", "b"}
+	w.syncLogs(context.Background(), backend, &job)
+	backend.logs = []string{"a", "b", "c"}
+	w.syncLogs(context.Background(), backend, &job)
+
+	// The retry starts a new run whose logs start over
+	job.Attempts, job.RunAttempt = 2, 2
+	backend.logs = []string{"x", "y"}
+	w.syncLogs(context.Background(), backend, &job)
+
+	var messages []string
+	database.DB.Model(&models.LogEntry{}).Where("job_id = ?", job.ID).Order("id").Pluck("message", &messages)
+	if got := strings.Join(messages, ","); got != "a,b,c,x,y" {
+		t.Fatalf("stored %s, want a,b,c,x,y", got)
+	}
+}
+
+func TestJobTimesOutAtItsDeadline(t *testing.T) {
+	databasetest.Open(t)
+	backend := &fakeBackend{}
+	backends.Register(backend)
+
+	job := models.Job{Status: string(statemachine.Pending), Backend: backend.Name(), Configuration: datatypes.JSON(`{"timeout": "100ms"}`)}
+	if err := database.DB.Create(&job).Error; err != nil {
+		t.Fatal(err)
+	}
+
+	w := &WorkerPool{Queue: queue.New("test", time.Minute), JobTimeout: time.Hour}
+	start := time.Now()
+	w.processJob(context.Background(), 1, &job)
+
+	database.DB.First(&job, job.ID)
+	if job.Status != string(statemachine.TimedOut) {
+		t.Fatalf("job is %s, want timed_out", job.Status)
+	}
+	if elapsed := time.Since(start); elapsed > 5*time.Second {
+		t.Fatalf("job ran for %s past its 100ms timeout", elapsed)
+	}
+	if job.DeadlineAt == nil || job.DeadlineAt.Sub(*job.StartedAt) != 100*time.Millisecond {
+		t.Fatalf("deadline %v for a job started at %v", job.DeadlineAt, job.StartedAt)
+	}
+	if len(backend.cancelled) != 1 || len(backend.released) != 1 {
+		t.Fatalf("run cancelled %d times and released %d times, want once each", len(backend.cancelled), len(backend.released))
+	}
+}
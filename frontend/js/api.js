@@ -85,12 +85,13 @@ class API {
 
     // ========== JOBS ==========
 
-    async createJob(datasetId, configuration) {
+    async createJob(datasetId, configuration, presetId = null) {
         return this.request('/jobs', {
             method: 'POST',
             body: JSON.stringify({
                 dataset_id: datasetId,
                 configuration: configuration,
+                preset_id: presetId,
             }),
         });
     }
@@ -109,6 +110,19 @@ class API {
         return this.request(`/jobs/${id}`, { method: 'DELETE' });
     }
 
+    // ========== PRESETS ==========
+
+    async listPresets() {
+        return this.request('/presets?limit=100');
+    }
+
+    async createPreset(name, description, configuration) {
+        return this.request('/presets', {
+            method: 'POST',
+            body: JSON.stringify({ name, description, configuration }),
+        });
+    }
+
     // Stream logs using SSE
     streamLogs(jobId, onMessage, onError) {
         const url = `${this.baseUrl}/jobs/${jobId}/logs`;
@@ -127,6 +141,38 @@ class API {
         return eventSource; // Return so caller can close it
     }
 
+    // Stream job status and metric changes using SSE. onEvent receives the
+    // snapshot, status and metrics events; the stream ends with onEnd once the
+    // job finished. The browser reconnects on its own after errors.
+    streamJobEvents(jobId, onEvent, onEnd) {
+        const url = `${this.baseUrl}/jobs/${jobId}/events/stream`;
+        const eventSource = new EventSource(url);
+
+        ['snapshot', 'status', 'metrics'].forEach(type => {
+            eventSource.addEventListener(type, (event) => {
+                if (onEvent) onEvent(JSON.parse(event.data));
+            });
+        });
+
+        eventSource.addEventListener('end', () => {
+            eventSource.close();
+            if (onEnd) onEnd();
+        });
+
+        return eventSource; // Return so caller can close it
+    }
+
+    // Metric series of a job as Chart.js datasets; compare lists other job
+    // ids to overlay
+    async getJobMetrics(jobId, { names = [], downsample, compare = [] } = {}) {
+        const params = new URLSearchParams();
+        if (names.length) params.set('names', names.join(','));
+        if (downsample !== undefined) params.set('downsample', downsample);
+        if (compare.length) params.set('compare', compare.join(','));
+        const query = params.toString();
+        return this.request(`/jobs/${jobId}/metrics${query ? '?' + query : ''}`);
+    }
+
     async getLogs(jobId, limit = 100) {
         return this.request(`/jobs/${jobId}/logs?limit=${limit}`);
     }
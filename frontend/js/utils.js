@@ -61,9 +61,11 @@ function getStatusBadge(status) {
         running: '<span class="badge badge-primary">Running</span>',
         completed: '<span class="badge badge-success">Completed</span>',
         failed: '<span class="badge badge-danger">Failed</span>',
+        cancelling: '<span class="badge badge-warning">Cancelling</span>',
         cancelled: '<span class="badge badge-warning">Cancelled</span>',
         ready: '<span class="badge badge-success">Ready</span>',
         uploading: '<span class="badge badge-info">Uploading</span>',
+        importing: '<span class="badge badge-info">Importing</span>',
         error: '<span class="badge badge-danger">Error</span>',
     };
 
@@ -148,11 +150,13 @@ function estimateVRAM(config) {
 }
 
 // Parse metrics from job
+// Values read from the training logs fill in what the latest snapshot lacks
 function parseMetrics(job) {
     try {
-        return typeof job.metrics === 'string'
+        const metrics = typeof job.metrics === 'string'
             ? JSON.parse(job.metrics)
             : job.metrics || {};
+        return metrics && metrics.progress ? { ...metrics.progress, ...metrics } : metrics || {};
     } catch (e) {
         return {};
     }
@@ -4,7 +4,7 @@ import time
 
 job_payload = {
     "dataset_id": 1,
-    "configuration": {"epochs": 3, "batch_size": 4, "learning_rate": "2e-5"}
+    "configuration": {"epochs": 3, "batch_size": 4, "learning_rate": 2e-5}
 }
 
 req = urllib.request.Request(